@@ -42,6 +42,11 @@ despliegue de aplicaciones como Laravel y Node.js.`,
 	commands.AddSiteCommand(rootCmd, nil)
 	commands.AddSecureCommand(rootCmd, nil)
 	commands.AddDeployCommand(rootCmd, nil)
+	commands.AddAppCommand(rootCmd, nil)
+	commands.AddEnvCommand(rootCmd, nil)
+	commands.AddSecretCommand(rootCmd, nil)
+	commands.AddDBCommand(rootCmd, nil)
+	commands.AddBackupCommand(rootCmd, nil)
 	commands.AddSelfUpdateCommand(rootCmd, nil)
 
 	// Comando para verificar el estado del sistema
@@ -0,0 +1,307 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// siteApp reúne lo necesario para controlar la aplicación de un sitio
+type siteApp struct {
+	state   *utils.SiteState
+	manager utils.ProcessManager
+	process utils.AppProcess
+}
+
+// AddAppCommand agrega el comando app al comando raíz
+func AddAppCommand(rootCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var lines int
+	var follow bool
+	var instances int
+
+	appCmd := &cobra.Command{
+		Use:   "app",
+		Short: "Controlar la aplicación en ejecución de un sitio",
+		Long: `Inicia, detiene, reinicia y consulta la aplicación de un sitio.
+Las aplicaciones Node.js y Laravel Octane se controlan con el gestor de procesos
+con el que se desplegaron (PM2 o systemd); los sitios Laravel, con el servicio
+PHP-FPM de su versión de PHP.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+			return utils.ValidateDomain(domain)
+		},
+	}
+	appCmd.PersistentFlags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	appCmd.MarkPersistentFlagRequired("domain")
+
+	// Acciones simples sobre el proceso
+	actions := []struct {
+		use   string
+		short string
+		run   func(pm utils.ProcessManager, app utils.AppProcess) error
+		done  string
+	}{
+		{"start", "Iniciar la aplicación", utils.ProcessManager.Start, "iniciada"},
+		{"stop", "Detener la aplicación", utils.ProcessManager.Stop, "detenida"},
+		{"restart", "Reiniciar la aplicación", utils.ProcessManager.Restart, "reiniciada"},
+		{"reload", "Recargar la aplicación sin cortar el servicio", utils.ProcessManager.Reload, "recargada"},
+	}
+	for _, action := range actions {
+		action := action
+		appCmd.AddCommand(&cobra.Command{
+			Use:   action.use,
+			Short: action.short,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				app, err := loadSiteApp(domain, cfg)
+				if err != nil {
+					return err
+				}
+				run := action.run
+				if app.manager.Name() == utils.ProcessManagerPHPFPM {
+					service := app.manager.(*utils.PHPFPMManager).ServiceName()
+					pool, hasPool := app.state.PHPFPMPool()
+					switch {
+					case hasPool && action.use == "restart":
+						// Recargar reinicia los procesos del pool del sitio sin cortar los demás pools
+						fmt.Printf("Reiniciando los procesos del pool %s\n", filepath.Base(pool.ConfPath()))
+						run = utils.ProcessManager.Reload
+					case hasPool && action.use == "stop":
+						fmt.Printf("Advertencia: el pool del sitio se ejecuta en %s; detenerlo detiene también los pools de los demás sitios con PHP %s\n",
+							service, app.state.PHPVersion)
+					case !hasPool && action.use != "reload":
+						fmt.Printf("Advertencia: %s es compartido por todos los sitios con PHP %s\n", service, app.state.PHPVersion)
+					}
+				}
+				if err := run(app.manager, app.process); err != nil {
+					return err
+				}
+				fmt.Printf("Aplicación %s %s (%s)\n", domain, action.done, app.manager.Name())
+				return nil
+			},
+		})
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Mostrar el estado y el consumo de la aplicación",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := loadSiteApp(domain, cfg)
+			if err != nil {
+				return err
+			}
+			info, err := app.manager.Info(app.process)
+			if err != nil {
+				return err
+			}
+			printAppStatus(app, info)
+			return nil
+		},
+	}
+	appCmd.AddCommand(statusCmd)
+
+	scaleCmd := &cobra.Command{
+		Use:   "scale",
+		Short: "Cambiar la cantidad de instancias de la aplicación",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if instances < 1 {
+				return utils.NewError(utils.ErrorValidacion, "la cantidad de instancias debe ser al menos 1", nil)
+			}
+			app, err := loadSiteApp(domain, cfg)
+			if err != nil {
+				return err
+			}
+			if err := app.manager.Scale(app.process, instances); err != nil {
+				return err
+			}
+
+			// Conservar la cantidad de instancias en la configuración y en los próximos despliegues
+			app.state.Instances = instances
+			if err := app.manager.Install(app.state.AppProcess()); err != nil {
+				fmt.Printf("Advertencia: %v\n", err)
+			}
+			if err := utils.SaveSiteState(app.state); err != nil {
+				fmt.Printf("Advertencia: no se pudo guardar el estado del sitio: %v\n", err)
+			}
+			fmt.Printf("Aplicación %s escalada a %d instancias\n", domain, instances)
+			return nil
+		},
+	}
+	scaleCmd.Flags().IntVarP(&instances, "instances", "n", 0, "Cantidad de instancias (obligatorio)")
+	scaleCmd.MarkFlagRequired("instances")
+	appCmd.AddCommand(scaleCmd)
+
+	logsCmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Mostrar los logs de la aplicación",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			app, err := loadSiteApp(domain, cfg)
+			if err != nil {
+				return err
+			}
+			return utils.TailLogs(app.logFiles(), lines, follow)
+		},
+	}
+	logsCmd.Flags().IntVarP(&lines, "lines", "n", 50, "Cantidad de líneas a mostrar")
+	logsCmd.Flags().BoolVarP(&follow, "follow", "f", false, "Seguir los logs en tiempo real")
+	appCmd.AddCommand(logsCmd)
+
+	// Agregar comando al comando raíz
+	rootCmd.AddCommand(appCmd)
+}
+
+// loadSiteApp obtiene el gestor y el proceso de la aplicación de un sitio a partir de su estado
+func loadSiteApp(domain string, cfg *config.Config) (*siteApp, error) {
+	state, err := utils.LoadSiteState(domain)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("no hay información registrada para %s; créalo con 'sm site' o despliégalo con 'sm deploy'", domain), nil)
+	}
+
+	app := &siteApp{state: state, process: state.AppProcess()}
+	switch {
+	case state.Type == "laravel" && state.RunsProcess():
+		// Laravel con Octane se controla con su gestor de procesos
+		app.manager, err = utils.NewProcessManager(state.ProcessManager)
+		if err != nil {
+			return nil, err
+		}
+	case state.Type == "nodejs":
+		if state.AppDir == "" || state.ProcessManager == "" {
+			return nil, utils.NewError(utils.ErrorValidacion,
+				fmt.Sprintf("no hay una aplicación desplegada registrada para %s; despliégala con 'sm deploy' o ejecuta 'sm deploy reset-pm2 -d %s'", domain, domain), nil)
+		}
+		app.manager, err = utils.NewProcessManager(state.ProcessManager)
+		if err != nil {
+			return nil, err
+		}
+	case state.Type == "laravel":
+		// Los sitios creados antes de registrar la versión de PHP se detectan por su configuración de Nginx
+		if state.PHPVersion == "" {
+			state.PHPVersion = utils.DetectPHPVersion(filepath.Join(cfg.SitesAvailable, domain+".conf"))
+		}
+		if state.PHPVersion == "" {
+			return nil, utils.NewError(utils.ErrorValidacion,
+				fmt.Sprintf("no se pudo determinar la versión de PHP de %s", domain), nil)
+		}
+		app.manager = &utils.PHPFPMManager{Version: state.PHPVersion}
+	default:
+		return nil, utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("el sitio %s (%s) no ejecuta un proceso de aplicación propio", domain, state.Type), nil)
+	}
+	return app, nil
+}
+
+// logFiles devuelve los archivos de log existentes de la aplicación
+func (a *siteApp) logFiles() []string {
+	var candidates []string
+	switch a.state.Type {
+	case "laravel":
+		logsDir := filepath.Join(a.state.HomeDir, "logs")
+		if a.state.RunsProcess() {
+			candidates = append(candidates, a.process.ErrorLog(), a.process.OutputLog())
+		}
+		candidates = append(candidates, filepath.Join(logsDir, fmt.Sprintf("%s_error.log", a.state.Domain)))
+		// El log general de Nginx solo pertenece al sitio si es el dominio principal del usuario
+		if filepath.Base(a.state.HomeDir) == a.state.Domain {
+			candidates = append(candidates, filepath.Join(logsDir, "error.log"))
+		}
+		if a.state.AppDir != "" {
+			candidates = append(candidates, filepath.Join(a.state.AppDir, "storage", "logs", "laravel.log"))
+		}
+	default:
+		candidates = []string{a.process.ErrorLog(), a.process.OutputLog()}
+	}
+
+	var files []string
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// printAppStatus muestra el estado y el consumo de recursos de la aplicación
+func printAppStatus(app *siteApp, info *utils.ProcessInfo) {
+	if app.state.Type == "laravel" && app.state.RunsProcess() {
+		fmt.Printf("Aplicación:  %s (Octane %s con %s, puerto %d)\n", app.state.Domain, app.state.Octane.Server, app.manager.Name(), app.process.Port)
+		fmt.Printf("Comando:     %s\n", app.process.Command)
+	} else if app.state.Type == "laravel" {
+		if pool, ok := app.state.PHPFPMPool(); ok {
+			fmt.Printf("Sitio:       %s (PHP-FPM %s, pool %s)\n", app.state.Domain, app.state.PHPVersion, filepath.Base(pool.ConfPath()))
+			fmt.Printf("Socket:      %s\n", pool.Socket())
+		} else {
+			fmt.Printf("Sitio:       %s (PHP-FPM %s, pool compartido)\n", app.state.Domain, app.state.PHPVersion)
+		}
+	} else {
+		fmt.Printf("Aplicación:  %s (%s, puerto %d)\n", app.state.Domain, app.manager.Name(), app.process.Port)
+		fmt.Printf("Comando:     %s\n", app.process.Command)
+		if app.process.NodeVersion != "" {
+			fmt.Printf("Node.js:     v%s\n", app.process.NodeVersion)
+		}
+	}
+	if app.state.AppDir != "" {
+		fmt.Printf("Directorio:  %s\n", app.state.AppDir)
+	}
+	if app.state.Type == "laravel" {
+		for _, worker := range app.state.Queue.Workers {
+			fmt.Printf("Worker:      %s [%s]\n", worker, app.state.Queue.EffectiveManager())
+		}
+		if app.state.Scheduler {
+			fmt.Println("Programador: schedule:run cada minuto (cron del usuario)")
+		}
+	}
+
+	fmt.Printf("Estado:      %s\n", info.Status)
+	if len(info.PIDs) > 0 {
+		pids := make([]string, len(info.PIDs))
+		for i, pid := range info.PIDs {
+			pids[i] = fmt.Sprint(pid)
+		}
+		fmt.Printf("PID:         %s\n", strings.Join(pids, ", "))
+	}
+	if info.Instances > 1 {
+		fmt.Printf("Instancias:  %d\n", info.Instances)
+	}
+	if info.CPUTime > 0 {
+		fmt.Printf("CPU:         %s acumulado\n", info.CPUTime.Truncate(time.Millisecond))
+	} else {
+		fmt.Printf("CPU:         %.1f%%\n", info.CPU)
+	}
+	fmt.Printf("Memoria:     %s\n", formatBytes(info.Memory))
+	fmt.Printf("Reinicios:   %d\n", info.Restarts)
+	if info.Uptime > 0 {
+		fmt.Printf("Activa:      %s\n", info.Uptime)
+	}
+}
+
+// formatBytes expresa una cantidad de bytes en la unidad más adecuada
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
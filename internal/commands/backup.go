@@ -0,0 +1,271 @@
+// internal/commands/backup.go
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// backupSettings son las opciones comunes de las copias de bases de datos
+type backupSettings struct {
+	dir       string
+	encrypt   bool
+	parallel  int
+	retention utils.BackupRetention
+}
+
+// addFlags agrega los flags de destino, cifrado y retención
+func (s *backupSettings) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.dir, "dir", "", "Directorio global de copias (por defecto <home del sitio>/backups/db o backup_dir de la configuración)")
+	cmd.Flags().BoolVar(&s.encrypt, "encrypt", false, "Cifrar las copias con la clave "+utils.BackupKeyPath())
+	cmd.Flags().IntVar(&s.parallel, "parallel", 2, "Sitios que se copian a la vez con --all")
+	cmd.Flags().IntVar(&s.retention.Daily, "keep-daily", 7, "Copias diarias que se conservan")
+	cmd.Flags().IntVar(&s.retention.Weekly, "keep-weekly", 4, "Copias semanales que se conservan")
+	cmd.Flags().IntVar(&s.retention.Monthly, "keep-monthly", 6, "Copias mensuales que se conservan")
+}
+
+// args devuelve los flags que reproducen los ajustes, para el servicio de las copias programadas
+func (s *backupSettings) args() []string {
+	args := []string{
+		"--parallel=" + strconv.Itoa(s.parallel),
+		"--keep-daily=" + strconv.Itoa(s.retention.Daily),
+		"--keep-weekly=" + strconv.Itoa(s.retention.Weekly),
+		"--keep-monthly=" + strconv.Itoa(s.retention.Monthly),
+	}
+	if s.encrypt {
+		args = append(args, "--encrypt")
+	}
+	if s.dir != "" {
+		args = append(args, "--dir="+s.dir)
+	}
+	return args
+}
+
+// AddBackupCommand agrega el comando backup al comando raíz
+func AddBackupCommand(rootCmd *cobra.Command, cfg *config.Config) {
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Copias de seguridad de las bases de datos",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+
+	var domain, name string
+	var all bool
+	settings := &backupSettings{}
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Copiar las bases de datos de un sitio o de todos los sitios",
+		Long: `Guarda una copia de las bases de datos vinculadas al sitio (sm db): pg_dump en formato
+personalizado para PostgreSQL y mysqldump --single-transaction comprimido con gzip para MySQL.
+Después aplica la política de retención: se conservan la última copia y la más reciente de
+cada uno de los últimos N días, semanas y meses.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if settings.parallel < 1 {
+				return utils.NewError(utils.ErrorValidacion, "--parallel debe ser al menos 1", nil)
+			}
+			if all {
+				if domain != "" || name != "" {
+					return utils.NewError(utils.ErrorValidacion, "--all copia todos los sitios; no use -d ni --name", nil)
+				}
+				return backupAllSites(cfg, settings)
+			}
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+			return backupSite(domain, name, cfg, settings)
+		},
+	}
+	dbCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio")
+	dbCmd.Flags().StringVar(&name, "name", "", "Copiar solo esta base de datos del sitio")
+	dbCmd.Flags().BoolVar(&all, "all", false, "Copiar las bases de datos de todos los sitios")
+	settings.addFlags(dbCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Listar las copias de las bases de datos de un sitio",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+			backups, err := utils.ListDatabaseBackups(siteBackupDir(domain, cfg, settings.dir), name)
+			if err != nil {
+				return err
+			}
+			if len(backups) == 0 {
+				fmt.Printf("No hay copias de las bases de datos de %s\n", domain)
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "FECHA\tBASE DE DATOS\tMOTOR\tTAMAÑO\tCIFRADA\tARCHIVO")
+			for _, b := range backups {
+				encrypted := "no"
+				if b.Encrypted {
+					encrypted = "sí"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", b.CreatedAt.Format("2006-01-02 15:04:05"),
+					b.Database, b.Engine, formatBytes(uint64(b.Size)), encrypted, b.Path)
+			}
+			return w.Flush()
+		},
+	}
+	listCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio")
+	listCmd.Flags().StringVar(&name, "name", "", "Mostrar solo las copias de esta base de datos")
+	listCmd.Flags().StringVar(&settings.dir, "dir", "", "Directorio global de copias")
+
+	var onCalendar string
+	var remove bool
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Programar las copias de todos los sitios con un timer de systemd",
+		Long: `Instala el timer ` + utils.BackupTimerName() + `, que ejecuta 'sm backup db --all' con los
+flags de cifrado, destino y retención indicados. Use --remove para desinstalarlo.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if remove {
+				if err := utils.RemoveBackupTimer(); err != nil {
+					return err
+				}
+				fmt.Println("Copias programadas desinstaladas")
+				return nil
+			}
+			if settings.parallel < 1 {
+				return utils.NewError(utils.ErrorValidacion, "--parallel debe ser al menos 1", nil)
+			}
+			executable, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("error al obtener la ruta de sm: %v", err)
+			}
+			command := append([]string{executable, "backup", "db", "--all"}, settings.args()...)
+			if err := utils.InstallBackupTimer(onCalendar, command); err != nil {
+				return err
+			}
+			fmt.Printf("Copias programadas (%s) con %s\n", onCalendar, utils.BackupTimerName())
+			fmt.Printf("Consulte la próxima ejecución con 'systemctl list-timers %s'\n", utils.BackupTimerName())
+			return nil
+		},
+	}
+	scheduleCmd.Flags().StringVar(&onCalendar, "on-calendar", "*-*-* 03:00:00", "Programación de systemd (OnCalendar)")
+	scheduleCmd.Flags().BoolVar(&remove, "remove", false, "Desinstalar las copias programadas")
+	settings.addFlags(scheduleCmd)
+
+	backupCmd.AddCommand(dbCmd, listCmd, scheduleCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+// siteBackupDir devuelve el directorio de copias de un sitio: <dir>/<dominio> si se indica un
+// directorio global (flag o backup_dir de la configuración) o <home del sitio>/backups/db
+func siteBackupDir(domain string, cfg *config.Config, dir string) string {
+	if dir == "" && cfg != nil {
+		dir = cfg.BackupDir
+	}
+	if dir != "" {
+		return filepath.Join(dir, domain)
+	}
+	_, homeDir := siteOwner(domain)
+	if state, err := utils.LoadSiteState(domain); err == nil && state != nil && state.HomeDir != "" {
+		homeDir = state.HomeDir
+	}
+	return filepath.Join(homeDir, "backups", "db")
+}
+
+// backupSite copia las bases de datos de un sitio y aplica la política de retención
+func backupSite(domain, name string, cfg *config.Config, settings *backupSettings) error {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		db, err := utils.FindSiteDatabase(domain, name)
+		if err != nil {
+			return err
+		}
+		databases = []utils.SiteDatabase{*db}
+	}
+	if len(databases) == 0 {
+		return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("el sitio %s no tiene bases de datos vinculadas", domain), nil)
+	}
+
+	dir := siteBackupDir(domain, cfg, settings.dir)
+	for _, db := range databases {
+		backup, err := utils.BackupDatabase(db, dir, settings.encrypt)
+		if err != nil {
+			return fmt.Errorf("error al copiar la base de datos %s: %v", db.Name, err)
+		}
+		fmt.Printf("[%s] Copia de %s guardada en %s (%s)\n", domain, db.Name, backup.Path, formatBytes(uint64(backup.Size)))
+
+		expired, err := utils.PruneDatabaseBackups(dir, db.Name, settings.retention)
+		if err != nil {
+			return err
+		}
+		if len(expired) > 0 {
+			fmt.Printf("[%s] %d copia(s) antigua(s) de %s eliminada(s)\n", domain, len(expired), db.Name)
+		}
+	}
+	return nil
+}
+
+// backupAllSites copia las bases de datos de todos los sitios, con como máximo
+// settings.parallel sitios a la vez. Un error en un sitio no detiene los demás.
+func backupAllSites(cfg *config.Config, settings *backupSettings) error {
+	domains, err := utils.SiteDatabaseDomains()
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		fmt.Println("No hay bases de datos vinculadas a ningún sitio")
+		return nil
+	}
+	if settings.encrypt {
+		if err := utils.EnsureBackupKey(); err != nil {
+			return err
+		}
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, settings.parallel)
+	for _, domain := range domains {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(domain string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := backupSite(domain, "", cfg, settings); err != nil {
+				fmt.Printf("[%s] Error: %v\n", domain, err)
+				mu.Lock()
+				failed = append(failed, domain)
+				mu.Unlock()
+			}
+		}(domain)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return utils.NewError(utils.ErrorComando,
+			fmt.Sprintf("fallaron las copias de %d de %d sitio(s): %s", len(failed), len(domains), strings.Join(failed, ", ")), nil)
+	}
+	fmt.Printf("Copias de %d sitio(s) completadas\n", len(domains))
+	return nil
+}
@@ -0,0 +1,459 @@
+// internal/commands/db.go
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// dbCommandOptions son los flags comunes de los subcomandos de db
+type dbCommandOptions struct {
+	domain   string
+	name     string
+	waitLock bool
+	restart  bool
+}
+
+// AddDBCommand agrega el comando db al comando raíz
+func AddDBCommand(rootCmd *cobra.Command, cfg *config.Config) {
+	opts := &dbCommandOptions{}
+
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Gestionar las bases de datos de los sitios",
+		Long: `Crea y administra bases de datos PostgreSQL y MySQL/MariaDB vinculadas a un sitio.
+Cada base de datos tiene un usuario propio con acceso solo a ella; su contraseña se guarda
+en los secretos cifrados del sitio y sus credenciales se escriben en el archivo .env.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+	dbCmd.PersistentFlags().StringVarP(&opts.domain, "domain", "d", "", "Dominio del sitio")
+	dbCmd.PersistentFlags().BoolVar(&opts.waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+
+	addDBCreateCommand(dbCmd, opts, &cfg)
+	addDBDropCommand(dbCmd, opts)
+	addDBListCommand(dbCmd, opts)
+	addDBAccessCommands(dbCmd, opts, &cfg)
+	addDBRestoreCommands(dbCmd, opts, &cfg)
+	rootCmd.AddCommand(dbCmd)
+}
+
+// withSiteLock valida el dominio y ejecuta run con el sitio bloqueado
+func (o *dbCommandOptions) withSiteLock(operation string, run func() error) error {
+	if err := utils.ValidateDomain(o.domain); err != nil {
+		return err
+	}
+	lock, err := utils.AcquireSiteLock(o.domain, operation, o.waitLock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return run()
+}
+
+// addDBCreateCommand agrega el subcomando create
+func addDBCreateCommand(dbCmd *cobra.Command, opts *dbCommandOptions, cfg **config.Config) {
+	var engine, user, envPrefix string
+	var adopt bool
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Crear una base de datos para un sitio",
+		Long: `Crea una base de datos y un usuario con acceso solo a ella, y escribe sus credenciales
+en el .env del sitio. La primera base de datos usa las variables DB_* y DATABASE_URL; las
+siguientes usan el prefijo indicado con --env-prefix (por defecto, el nombre en mayúsculas).
+Si la base de datos o el usuario ya existen en el servidor sin estar vinculados a ningún sitio,
+el comando falla salvo que se indique --adopt: entonces se vinculan al sitio y se cambia la
+contraseña del usuario.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.withSiteLock("db create", func() error {
+				engineType, err := utils.ParseDatabaseEngine(engine)
+				if err != nil {
+					return err
+				}
+				db, err := newSiteDatabase(opts.domain, engineType, opts.name, user, envPrefix)
+				if err != nil {
+					return err
+				}
+				vars, err := provisionSiteDatabase(opts.domain, db, adopt)
+				if err != nil {
+					return err
+				}
+				return writeDatabaseEnv(opts.domain, vars, "db create", opts.restart, *cfg)
+			})
+		},
+	}
+	createCmd.Flags().StringVarP(&engine, "engine", "e", string(utils.DBTypePostgreSQL), "Motor de base de datos (postgresql, mysql)")
+	createCmd.Flags().StringVar(&opts.name, "name", "", "Nombre de la base de datos (por defecto se deriva del dominio)")
+	createCmd.Flags().StringVar(&user, "user", "", "Usuario de la base de datos (por defecto, el nombre de la base de datos)")
+	createCmd.Flags().StringVar(&envPrefix, "env-prefix", "", "Prefijo de las variables del .env")
+	createCmd.Flags().BoolVar(&adopt, "adopt", false, "Vincular la base de datos o el usuario si ya existen en el servidor, cambiando su contraseña")
+	createCmd.Flags().BoolVar(&opts.restart, "restart", false, "Reiniciar la aplicación y regenerar la caché de configuración de Laravel")
+	dbCmd.AddCommand(createCmd)
+}
+
+// addDBDropCommand agrega el subcomando drop
+func addDBDropCommand(dbCmd *cobra.Command, opts *dbCommandOptions) {
+	var yes bool
+	dropCmd := &cobra.Command{
+		Use:   "drop",
+		Short: "Eliminar una base de datos de un sitio y su usuario",
+		Long: `Elimina la base de datos y su usuario del servidor, la desvincula del sitio y borra sus
+credenciales de los secretos. El .env actual conserva las variables.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.withSiteLock("db drop", func() error {
+				db, err := utils.FindSiteDatabase(opts.domain, opts.name)
+				if err != nil {
+					return err
+				}
+				if !yes && !confirmDatabaseName(db.Name) {
+					return utils.NewError(utils.ErrorValidacion, "operación cancelada", nil)
+				}
+
+				server, err := utils.NewDatabaseServer(db.Engine)
+				if err != nil {
+					return err
+				}
+				if err := server.DropDatabase(db.Name); err != nil {
+					return err
+				}
+				if err := server.DropUser(db.User); err != nil {
+					return err
+				}
+				if err := unlinkSiteDatabase(opts.domain, *db); err != nil {
+					return err
+				}
+				fmt.Printf("Base de datos %s y usuario %s eliminados\n", db.Name, db.User)
+				fmt.Printf("El .env actual conserva las credenciales; elimínelas con 'sm env unset -d %s'\n", opts.domain)
+				return nil
+			})
+		},
+	}
+	dropCmd.Flags().StringVar(&opts.name, "name", "", "Base de datos a eliminar (si el sitio tiene varias)")
+	dropCmd.Flags().BoolVarP(&yes, "yes", "y", false, "No pedir confirmación")
+	dbCmd.AddCommand(dropCmd)
+}
+
+// addDBListCommand agrega el subcomando list
+func addDBListCommand(dbCmd *cobra.Command, opts *dbCommandOptions) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Listar las bases de datos de un sitio o de todos los sitios",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domains := []string{opts.domain}
+			if opts.domain == "" {
+				var err error
+				if domains, err = utils.SiteDatabaseDomains(); err != nil {
+					return err
+				}
+			} else if err := utils.ValidateDomain(opts.domain); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SITIO\tMOTOR\tBASE DE DATOS\tUSUARIO\tSERVIDOR\tVARIABLES\tCREADA")
+			count := 0
+			for _, domain := range domains {
+				databases, err := utils.LoadSiteDatabases(domain)
+				if err != nil {
+					return err
+				}
+				for _, db := range databases {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s:%d\t%s_*\t%s\n", domain, db.Engine, db.Name, db.User,
+						db.Host, db.Port, db.EnvPrefix, db.CreatedAt.Format("2006-01-02"))
+					count++
+				}
+			}
+			if count == 0 {
+				fmt.Println("No hay bases de datos vinculadas")
+				return nil
+			}
+			return w.Flush()
+		},
+	}
+	dbCmd.AddCommand(listCmd)
+}
+
+// newSiteDatabase completa los datos de una base de datos nueva con los valores por defecto
+// del sitio y los valida
+func newSiteDatabase(domain string, engine utils.DatabaseType, name, user, envPrefix string) (utils.SiteDatabase, error) {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return utils.SiteDatabase{}, err
+	}
+	if name == "" {
+		name = utils.DatabaseNameForDomain(domain)
+	}
+	if user == "" {
+		user = utils.DatabaseUserForName(name)
+	}
+	if envPrefix == "" {
+		envPrefix = utils.PrimaryDatabaseEnvPrefix
+		for _, db := range databases {
+			if db.EnvPrefix == utils.PrimaryDatabaseEnvPrefix {
+				envPrefix = strings.ToUpper(name)
+			}
+		}
+	}
+
+	server, err := utils.NewDatabaseServer(engine)
+	if err != nil {
+		return utils.SiteDatabase{}, err
+	}
+	db := utils.SiteDatabase{
+		Engine:    engine,
+		Name:      name,
+		User:      user,
+		Host:      "localhost",
+		Port:      server.DefaultPort(),
+		EnvPrefix: envPrefix,
+	}
+	if err := db.Validate(); err != nil {
+		return db, err
+	}
+	for _, linked := range databases {
+		switch {
+		case linked.Name == db.Name && linked.Engine == db.Engine:
+			return db, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("la base de datos %s ya está vinculada a %s", db.Name, domain), nil)
+		case linked.EnvPrefix == db.EnvPrefix:
+			return db, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("el prefijo %s ya lo usa la base de datos %s; indique otro con --env-prefix", db.EnvPrefix, linked.Name), nil)
+		}
+	}
+	return db, nil
+}
+
+// provisionSiteDatabase crea en el servidor la base de datos y su usuario, o los actualiza si
+// ya existen, la vincula al sitio y guarda sus credenciales en los secretos. Devuelve las
+// variables del .env con las credenciales. La base de datos o el usuario que ya existen sin
+// estar vinculados al sitio solo se toman con adopt.
+func provisionSiteDatabase(domain string, db utils.SiteDatabase, adopt bool) (map[string]string, error) {
+	server, err := utils.NewDatabaseServer(db.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.Check(); err != nil {
+		return nil, err
+	}
+	// No adoptar la base de datos ni el usuario de otro sitio: se cambiaría su contraseña
+	owner, err := utils.DatabaseLinkedElsewhere(domain, db)
+	if err != nil {
+		return nil, err
+	}
+	if owner != "" {
+		return nil, utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("la base de datos %s o el usuario %s ya están vinculados a %s; indique otros con --name y --user", db.Name, db.User, owner), nil)
+	}
+
+	userExists, err := server.UserExists(db.User)
+	if err != nil {
+		return nil, err
+	}
+	dbExists, err := server.DatabaseExists(db.Name)
+	if err != nil {
+		return nil, err
+	}
+	if (userExists || dbExists) && !adopt {
+		linked, err := databaseLinkedTo(domain, db)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			return nil, utils.NewError(utils.ErrorValidacion,
+				fmt.Sprintf("la base de datos %s o el usuario %s ya existen en el servidor y no están vinculados a %s; para vincularlos y cambiar la contraseña del usuario use 'sm db create -d %s -e %s --name %s --user %s --adopt'",
+					db.Name, db.User, domain, domain, db.Engine, db.Name, db.User), nil)
+		}
+	}
+
+	store, err := utils.LoadSecretStore(domain)
+	if err != nil {
+		return nil, err
+	}
+	password, ok := store.Get(db.PasswordKey())
+	if !ok || password == "" {
+		if password, err = utils.GenerateSecret(dbPasswordLength); err != nil {
+			return nil, err
+		}
+	}
+
+	if userExists {
+		fmt.Printf("El usuario %s ya existe; se actualiza su contraseña\n", db.User)
+		err = server.SetPassword(db.User, password)
+	} else {
+		err = server.CreateUser(db.User, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if dbExists {
+		fmt.Printf("La base de datos %s ya existe; se vincula al sitio\n", db.Name)
+		err = server.Grant(db.Name, db.User)
+	} else {
+		err = server.CreateDatabase(db.Name, db.User)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := linkSiteDatabase(domain, db); err != nil {
+		return nil, err
+	}
+	vars := db.EnvVars(password)
+	for key, value := range vars {
+		store.Set(key, value)
+	}
+	if err := store.Save(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Base de datos %s %s lista para %s (usuario %s)\n", db.Engine, db.Name, domain, db.User)
+	return vars, nil
+}
+
+// databaseLinkedTo indica si la base de datos y su usuario ya están vinculados al sitio
+func databaseLinkedTo(domain string, db utils.SiteDatabase) (bool, error) {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return false, err
+	}
+	for _, linked := range databases {
+		if linked.Engine == db.Engine && linked.Name == db.Name && linked.User == db.User {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// linkSiteDatabase agrega la base de datos a las vinculadas al sitio
+func linkSiteDatabase(domain string, db utils.SiteDatabase) error {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return err
+	}
+	db.CreatedAt = time.Now()
+	for i := range databases {
+		if databases[i].Name == db.Name && databases[i].Engine == db.Engine {
+			db.CreatedAt = databases[i].CreatedAt
+			databases[i] = db
+			return utils.SaveSiteDatabases(domain, databases)
+		}
+	}
+	return utils.SaveSiteDatabases(domain, append(databases, db))
+}
+
+// unlinkSiteDatabase desvincula la base de datos del sitio y borra sus credenciales de los secretos
+func unlinkSiteDatabase(domain string, db utils.SiteDatabase) error {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return err
+	}
+	kept := databases[:0]
+	for _, linked := range databases {
+		if linked.Name != db.Name || linked.Engine != db.Engine {
+			kept = append(kept, linked)
+		}
+	}
+	if err := utils.SaveSiteDatabases(domain, kept); err != nil {
+		return err
+	}
+
+	store, err := utils.LoadSecretStore(domain)
+	if err != nil {
+		return err
+	}
+	for _, key := range db.EnvKeys() {
+		store.Unset(key)
+	}
+	return store.Save()
+}
+
+// writeDatabaseEnv escribe las credenciales en el .env de la aplicación activa. Si el sitio aún
+// no está desplegado, se escribirán desde los secretos en el primer despliegue.
+func writeDatabaseEnv(domain string, vars map[string]string, source string, restart bool, cfg *config.Config) error {
+	app, err := resolveEnvApp(domain)
+	if err != nil {
+		fmt.Println("Las credenciales se escribirán en el .env en el próximo despliegue")
+		return nil
+	}
+
+	recordEnvBefore(domain, app.envPath())
+	env, err := readAppEnv(app, true)
+	if err != nil {
+		return err
+	}
+	for key, value := range vars {
+		env.Set(key, value)
+	}
+	if err := writeAppEnv(app, env); err != nil {
+		return err
+	}
+	recordEnvSnapshot(domain, app.envPath(), utils.EnvSnapshot{Source: source})
+	fmt.Printf("Credenciales escritas en %s\n", app.envPath())
+
+	if !restart {
+		fmt.Println("Los cambios se aplicarán al reiniciar la aplicación (use --restart para hacerlo ahora)")
+		return nil
+	}
+	return applyEnvChanges(app, cfg)
+}
+
+// confirmDatabaseName pide escribir el nombre de la base de datos antes de una operación destructiva
+func confirmDatabaseName(name string) bool {
+	fmt.Printf("Esta operación no se puede deshacer. Escriba el nombre de la base de datos (%s) para confirmar: ", name)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	return strings.TrimSpace(answer) == name
+}
+
+// ensureDeployDatabase crea la base de datos principal de un sitio al desplegar y devuelve las
+// variables del .env con sus credenciales. Si el sitio ya tiene una, se reutiliza.
+func ensureDeployDatabase(domain string, engine utils.DatabaseType) (map[string]string, error) {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range databases {
+		if db.EnvPrefix != utils.PrimaryDatabaseEnvPrefix {
+			continue
+		}
+		if db.Engine != engine {
+			fmt.Printf("Advertencia: el sitio ya usa la base de datos %s %s; se omite %s\n", db.Engine, db.Name, engine)
+		}
+		store, err := utils.LoadSecretStore(domain)
+		if err != nil {
+			return nil, err
+		}
+		if password, ok := store.Get(db.PasswordKey()); ok {
+			return db.EnvVars(password), nil
+		}
+		// Sin contraseña guardada se vuelve a provisionar con una nueva
+		return provisionSiteDatabase(domain, db, false)
+	}
+
+	fmt.Println("Creando la base de datos del sitio...")
+	db, err := newSiteDatabase(domain, engine, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	return provisionSiteDatabase(domain, db, false)
+}
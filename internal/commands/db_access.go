@@ -0,0 +1,150 @@
+// internal/commands/db_access.go
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// addDBAccessCommands agrega los subcomandos users, passwd y shell al comando db
+func addDBAccessCommands(dbCmd *cobra.Command, opts *dbCommandOptions, cfg **config.Config) {
+	usersCmd := &cobra.Command{
+		Use:   "users",
+		Short: "Mostrar los usuarios de las bases de datos de un sitio",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := utils.ValidateDomain(opts.domain); err != nil {
+				return err
+			}
+			databases, err := utils.LoadSiteDatabases(opts.domain)
+			if err != nil {
+				return err
+			}
+			if len(databases) == 0 {
+				fmt.Printf("%s no tiene bases de datos vinculadas\n", opts.domain)
+				return nil
+			}
+			store, err := utils.LoadSecretStore(opts.domain)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "USUARIO\tMOTOR\tBASE DE DATOS\tEN EL SERVIDOR\tCONTRASEÑA")
+			for _, db := range databases {
+				status := "no disponible"
+				if server, err := utils.NewDatabaseServer(db.Engine); err == nil {
+					if exists, err := server.UserExists(db.User); err == nil {
+						status = "no existe"
+						if exists {
+							status = "sí"
+						}
+					}
+				}
+				password := "falta en los secretos"
+				if _, ok := store.Get(db.PasswordKey()); ok {
+					password = db.PasswordKey()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", db.User, db.Engine, db.Name, status, password)
+			}
+			return w.Flush()
+		},
+	}
+
+	passwdCmd := &cobra.Command{
+		Use:   "passwd",
+		Short: "Cambiar la contraseña del usuario de una base de datos",
+		Long: `Genera una contraseña nueva para el usuario de la base de datos, la guarda en los
+secretos del sitio y actualiza el .env de la aplicación.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.withSiteLock("db passwd", func() error {
+				db, err := utils.FindSiteDatabase(opts.domain, opts.name)
+				if err != nil {
+					return err
+				}
+				server, err := utils.NewDatabaseServer(db.Engine)
+				if err != nil {
+					return err
+				}
+				store, err := utils.LoadSecretStore(opts.domain)
+				if err != nil {
+					return err
+				}
+				password, err := utils.GenerateSecret(dbPasswordLength)
+				if err != nil {
+					return err
+				}
+
+				// Guardar la contraseña antes de cambiarla en el servidor, para no dejar al sitio
+				// con una contraseña que no está en ninguna parte
+				vars := db.EnvVars(password)
+				previous := make(map[string]string)
+				for key, value := range vars {
+					if old, ok := store.Get(key); ok {
+						previous[key] = old
+					}
+					store.Set(key, value)
+				}
+				if err := store.Save(); err != nil {
+					return err
+				}
+				if err := server.SetPassword(db.User, password); err != nil {
+					// El servidor conserva la contraseña anterior: volver a guardarla
+					for key := range vars {
+						if old, ok := previous[key]; ok {
+							store.Set(key, old)
+						} else {
+							store.Unset(key)
+						}
+					}
+					if saveErr := store.Save(); saveErr != nil {
+						fmt.Printf("Advertencia: no se pudo restaurar la contraseña anterior en los secretos: %v\n", saveErr)
+					}
+					return err
+				}
+				fmt.Printf("Contraseña del usuario %s cambiada\n", db.User)
+				return writeDatabaseEnv(opts.domain, vars, "db passwd", opts.restart, *cfg)
+			})
+		},
+	}
+	passwdCmd.Flags().StringVar(&opts.name, "name", "", "Base de datos (si el sitio tiene varias)")
+	passwdCmd.Flags().BoolVar(&opts.restart, "restart", false, "Reiniciar la aplicación y regenerar la caché de configuración de Laravel")
+
+	shellCmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Abrir una consola SQL con el usuario de la base de datos",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := utils.ValidateDomain(opts.domain); err != nil {
+				return err
+			}
+			db, err := utils.FindSiteDatabase(opts.domain, opts.name)
+			if err != nil {
+				return err
+			}
+			store, err := utils.LoadSecretStore(opts.domain)
+			if err != nil {
+				return err
+			}
+			password, ok := store.Get(db.PasswordKey())
+			if !ok {
+				return utils.NewError(utils.ErrorValidacion,
+					fmt.Sprintf("falta la contraseña de %s en los secretos; genere una con 'sm db passwd -d %s'", db.User, opts.domain), nil)
+			}
+			server, err := utils.NewDatabaseServer(db.Engine)
+			if err != nil {
+				return err
+			}
+			return server.Shell(db.Name, db.User, password, db.Host, db.Port)
+		},
+	}
+	shellCmd.Flags().StringVar(&opts.name, "name", "", "Base de datos (si el sitio tiene varias)")
+
+	dbCmd.AddCommand(usersCmd, passwdCmd, shellCmd)
+}
@@ -0,0 +1,280 @@
+// internal/commands/db_restore.go
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// preRestoreDir es el subdirectorio de las copias previas a una restauración. La política de
+// retención de 'sm backup db' no lo recorre, así que esas copias se conservan hasta borrarlas.
+const preRestoreDir = "pre-restore"
+
+// addDBRestoreCommands agrega los subcomandos restore y clone al comando db
+func addDBRestoreCommands(dbCmd *cobra.Command, opts *dbCommandOptions, cfg **config.Config) {
+	var dir string
+	var yes bool
+	restoreCmd := &cobra.Command{
+		Use:   "restore <copia>",
+		Short: "Restaurar una base de datos de un sitio desde una copia",
+		Long: `Reemplaza el contenido de la base de datos por el de una copia de 'sm backup db'. La copia
+puede indicarse por su ruta, por su nombre dentro del directorio de copias del sitio o con
+"latest" para usar la más reciente. Antes de restaurar se comprueba que la copia se pueda leer
+completa y se guarda una copia del contenido actual en el subdirectorio ` + preRestoreDir + `.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.withSiteLock("db restore", func() error {
+				backupDir := siteBackupDir(opts.domain, *cfg, dir)
+				db, path, err := resolveDatabaseBackup(opts.domain, opts.name, args[0], backupDir)
+				if err != nil {
+					return err
+				}
+				store, err := utils.LoadSecretStore(opts.domain)
+				if err != nil {
+					return err
+				}
+				password, _ := store.Get(db.PasswordKey())
+				fmt.Printf("Se restaurará %s desde %s\n", db.Name, path)
+				if !yes && !confirmDatabaseName(db.Name) {
+					return utils.NewError(utils.ErrorValidacion, "operación cancelada", nil)
+				}
+
+				safety, err := preRestoreBackup(opts.domain, *db, backupDir)
+				if err != nil {
+					return err
+				}
+				if err := utils.RestoreDatabase(*db, password, path); err != nil {
+					printPreRestoreHint(opts.domain, safety)
+					return err
+				}
+				fmt.Printf("Base de datos %s restaurada desde %s\n", db.Name, filepath.Base(path))
+				return nil
+			})
+		},
+	}
+	restoreCmd.Flags().StringVar(&opts.name, "name", "", "Base de datos a restaurar (si el sitio tiene varias)")
+	restoreCmd.Flags().StringVar(&dir, "dir", "", "Directorio global de copias")
+	restoreCmd.Flags().BoolVarP(&yes, "yes", "y", false, "No pedir confirmación")
+
+	var from, to, fromName, toName, anonymize string
+	cloneCmd := &cobra.Command{
+		Use:   "clone",
+		Short: "Copiar la base de datos de un sitio en la de otro",
+		Long: `Reemplaza el contenido de la base de datos del sitio de destino por una copia de la del
+sitio de origen y escribe sus credenciales en el .env del destino. Si el destino no tiene una
+base de datos vinculada, se crea una con el mismo motor. Con --anonymize se ejecuta un script
+SQL sobre la copia, por ejemplo para borrar datos personales; si el script falla, la copia se
+descarta. Antes de reemplazarla se guarda una copia del contenido actual del destino.`,
+		Example: `  sm db clone --from example.com --to staging.example.com --anonymize anonimizar.sql`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := utils.ValidateDomain(from); err != nil {
+				return err
+			}
+			if anonymize != "" && !utils.PathExists(anonymize) {
+				return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no existe el script %s", anonymize), nil)
+			}
+			target := &dbCommandOptions{domain: to, waitLock: opts.waitLock}
+			return target.withSiteLock("db clone", func() error {
+				src, err := utils.FindSiteDatabase(from, fromName)
+				if err != nil {
+					return err
+				}
+				dst, created, err := cloneTargetDatabase(to, toName, src.Engine)
+				if err != nil {
+					return err
+				}
+				if from == to && dst.Name == src.Name {
+					return utils.NewError(utils.ErrorValidacion, "el origen y el destino son la misma base de datos", nil)
+				}
+
+				fmt.Printf("Se copiará %s (%s) en %s (%s)\n", src.Name, from, dst.Name, to)
+				if !created && !yes && !confirmDatabaseName(dst.Name) {
+					return utils.NewError(utils.ErrorValidacion, "operación cancelada", nil)
+				}
+
+				store, err := utils.LoadSecretStore(to)
+				if err != nil {
+					return err
+				}
+				password, ok := store.Get(dst.PasswordKey())
+
+				var safety *utils.DatabaseBackup
+				if !created {
+					if safety, err = preRestoreBackup(to, *dst, siteBackupDir(to, *cfg, dir)); err != nil {
+						return err
+					}
+				}
+				if err := utils.CopyDatabase(*src, *dst, password); err != nil {
+					printPreRestoreHint(to, safety)
+					return err
+				}
+				fmt.Printf("Base de datos %s copiada en %s\n", src.Name, dst.Name)
+				if anonymize != "" {
+					if !ok {
+						err = utils.NewError(utils.ErrorValidacion,
+							fmt.Sprintf("falta la contraseña de %s en los secretos para ejecutar %s", dst.User, anonymize), nil)
+					} else {
+						err = anonymizeDatabase(*dst, password, anonymize)
+					}
+					if err != nil {
+						discardClone(*dst)
+						printPreRestoreHint(to, safety)
+						return err
+					}
+					fmt.Printf("Script %s ejecutado sobre %s\n", anonymize, dst.Name)
+				}
+				if !ok {
+					fmt.Printf("Falta la contraseña de %s en los secretos; genere una con 'sm db passwd -d %s'\n", dst.User, to)
+					return nil
+				}
+				return writeDatabaseEnv(to, dst.EnvVars(password), "db clone", opts.restart, *cfg)
+			})
+		},
+	}
+	cloneCmd.Flags().StringVar(&from, "from", "", "Dominio del sitio de origen")
+	cloneCmd.Flags().StringVar(&to, "to", "", "Dominio del sitio de destino")
+	cloneCmd.Flags().StringVar(&fromName, "from-name", "", "Base de datos de origen (si el sitio tiene varias)")
+	cloneCmd.Flags().StringVar(&toName, "to-name", "", "Base de datos de destino (si el sitio tiene varias)")
+	cloneCmd.Flags().StringVar(&anonymize, "anonymize", "", "Script SQL que se ejecuta sobre la copia con el usuario de la base de datos de destino")
+	cloneCmd.Flags().StringVar(&dir, "dir", "", "Directorio global de copias")
+	cloneCmd.Flags().BoolVarP(&yes, "yes", "y", false, "No pedir confirmación")
+	cloneCmd.Flags().BoolVar(&opts.restart, "restart", false, "Reiniciar la aplicación de destino y regenerar la caché de configuración de Laravel")
+	cloneCmd.MarkFlagRequired("from")
+	cloneCmd.MarkFlagRequired("to")
+
+	dbCmd.AddCommand(restoreCmd, cloneCmd)
+}
+
+// resolveDatabaseBackup devuelve la base de datos que se restaura y la ruta de la copia. Sin
+// --name se usa la base de datos a la que pertenece la copia, si está vinculada al sitio.
+func resolveDatabaseBackup(domain, name, arg, backupDir string) (*utils.SiteDatabase, string, error) {
+	if name == "" {
+		if parsed, ok := utils.ParseBackupName(arg); ok {
+			if _, err := utils.FindSiteDatabase(domain, parsed.Database); err == nil {
+				name = parsed.Database
+			}
+		}
+	}
+	db, err := utils.FindSiteDatabase(domain, name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if arg == "latest" {
+		backups, err := utils.ListDatabaseBackups(backupDir, db.Name)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(backups) == 0 {
+			return nil, "", utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no hay copias de %s en %s", db.Name, backupDir), nil)
+		}
+		return db, backups[0].Path, nil
+	}
+	for _, path := range []string{arg, filepath.Join(backupDir, arg)} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return db, path, nil
+		}
+	}
+	return nil, "", utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no se encontró la copia %s", arg), nil)
+}
+
+// cloneTargetDatabase devuelve la base de datos de destino de una clonación. Si el sitio no
+// tiene una con ese nombre, la crea con el motor indicado; created indica si es nueva.
+func cloneTargetDatabase(domain, name string, engine utils.DatabaseType) (db *utils.SiteDatabase, created bool, err error) {
+	databases, err := utils.LoadSiteDatabases(domain)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(databases) > 0 {
+		if name == "" {
+			db, err = utils.FindSiteDatabase(domain, "")
+			return db, false, err
+		}
+		for i := range databases {
+			if databases[i].Name == name {
+				return &databases[i], false, nil
+			}
+		}
+	}
+
+	fmt.Printf("%s no tiene la base de datos de destino; se crea\n", domain)
+	newDB, err := newSiteDatabase(domain, engine, name, "", "")
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := provisionSiteDatabase(domain, newDB, false); err != nil {
+		return nil, false, err
+	}
+	return &newDB, true, nil
+}
+
+// preRestoreBackup guarda el contenido actual de la base de datos antes de reemplazarlo. La
+// copia se cifra si ya existe la clave de las copias cifradas.
+func preRestoreBackup(domain string, db utils.SiteDatabase, backupDir string) (*utils.DatabaseBackup, error) {
+	server, err := utils.NewDatabaseServer(db.Engine)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := server.DatabaseExists(db.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	encrypt := utils.PathExists(utils.BackupKeyPath())
+	backup, err := utils.BackupDatabase(db, filepath.Join(backupDir, preRestoreDir), encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("error al guardar la copia previa de %s: %v", db.Name, err)
+	}
+	fmt.Printf("[%s] Copia previa de %s guardada en %s\n", domain, db.Name, backup.Path)
+	return backup, nil
+}
+
+// printPreRestoreHint indica cómo recuperar el contenido anterior tras un fallo
+func printPreRestoreHint(domain string, safety *utils.DatabaseBackup) {
+	if safety == nil {
+		return
+	}
+	fmt.Printf("El contenido anterior puede recuperarse con 'sm db restore -d %s --name %s %s'\n",
+		domain, safety.Database, safety.Path)
+}
+
+// anonymizeDatabase ejecuta el script sobre la copia conectado como el usuario de la base de
+// datos, que no puede acceder a otras bases de datos
+func anonymizeDatabase(db utils.SiteDatabase, password, script string) error {
+	file, err := os.Open(script)
+	if err != nil {
+		return fmt.Errorf("error al abrir el script %s: %v", script, err)
+	}
+	defer file.Close()
+
+	server, err := utils.NewDatabaseServer(db.Engine)
+	if err != nil {
+		return err
+	}
+	if err := server.RunScript(db.Name, db.User, password, db.Host, db.Port, file); err != nil {
+		return utils.NewError(utils.ErrorComando, fmt.Sprintf("el script %s falló", script), err)
+	}
+	return nil
+}
+
+// discardClone vacía la base de datos de destino para no dejar en ella datos sin anonimizar
+func discardClone(db utils.SiteDatabase) {
+	server, err := utils.NewDatabaseServer(db.Engine)
+	if err == nil {
+		err = server.ResetDatabase(db.Name, db.User)
+	}
+	if err != nil {
+		fmt.Printf("Advertencia: no se pudo vaciar %s, que puede contener datos sin anonimizar: %v\n", db.Name, err)
+		return
+	}
+	fmt.Printf("Se descartó la copia: %s quedó vacía\n", db.Name)
+}
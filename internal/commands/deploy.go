@@ -7,7 +7,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +32,174 @@ type DeployOptions struct {
 	RepoOwner    string
 	RepoName     string
 	Backup       bool
+	Manifest     *utils.ProjectManifest
+	// Releases: el código se construye en ReleaseDir y se publica en CurrentDir,
+	// un enlace simbólico estable que apunta a la release activa
+	ReleaseDir      string
+	CurrentDir      string
+	AppSubdir       string
+	PreviousRelease string
+	Port            int
+	StartCommand    string
+	HealthCheck     utils.HealthCheckOptions
+	// Historial: identificador del despliegue (también nombre de la release) y registro
+	ReleaseID string
+	Recorder  *utils.DeployRecorder
+	// Gestor de procesos (pm2, systemd) y estado del despliegue anterior
+	ProcessManager string
+	PreviousState  *utils.SiteState
+	// Ajustes del proceso Node.js (modo cluster, instancias, memoria, argumentos de node)
+	Tuning utils.ProcessTuning
+	// Versión de Node.js pedida con --node y versión instalada que usa la aplicación
+	NodeSpec    string
+	NodeVersion string
+	// Permitir instalar dependencias aunque no coincidan con el archivo de bloqueo
+	AllowLockfileDrift bool
+	// Detener el despliegue si el .env no pasa la verificación contra .env.example
+	StrictEnv bool
+	// Build estático servido por Nginx: directorio generado dentro de la aplicación y si
+	// las rutas desconocidas responden con index.html
+	StaticDir string
+	SPA       bool
+	// Next.js con output: 'standalone' y variables de entorno adicionales del proceso
+	NextStandalone bool
+	ProcessEnv     map[string]string
+	// Workers de colas y programador de tareas de Laravel
+	Queue     utils.QueueConfig
+	Scheduler bool
+	// Octane ejecuta la aplicación Laravel como proceso detrás de un proxy de Nginx
+	Octane utils.OctaneConfig
+	// Configuración de sitemanager y configuración de Nginx anterior al despliegue
+	Config      *config.Config
+	NginxBackup []byte
+}
+
+// processFlags agrupa los flags que ajustan el proceso de una aplicación Node.js
+type processFlags struct {
+	cluster      bool
+	instances    int
+	maxMemory    string
+	restartDelay time.Duration
+	nodeArgs     []string
+}
+
+// addProcessFlags registra los flags de ajuste del proceso en un comando
+func addProcessFlags(cmd *cobra.Command, f *processFlags) {
+	cmd.Flags().BoolVar(&f.cluster, "cluster", false, "Ejecutar la aplicación en modo cluster de PM2")
+	cmd.Flags().IntVar(&f.instances, "instances", 0, "Instancias en modo cluster (0 = una por CPU)")
+	cmd.Flags().StringVar(&f.maxMemory, "max-memory", "", "Memoria máxima por instancia antes de reiniciar (por ejemplo 512M)")
+	cmd.Flags().DurationVar(&f.restartDelay, "restart-delay", 0, "Espera entre reinicios automáticos (por ejemplo 3s)")
+	cmd.Flags().StringSliceVar(&f.nodeArgs, "node-args", nil, "Argumentos para node (por ejemplo --max-old-space-size=512)")
+}
+
+// apply combina los ajustes guardados del sitio con los flags indicados en la línea de comandos
+func (f *processFlags) apply(base utils.ProcessTuning, changed func(name string) bool) (utils.ProcessTuning, error) {
+	tuning := base
+	if changed("cluster") {
+		tuning.ExecMode = utils.ExecModeFork
+		if f.cluster {
+			tuning.ExecMode = utils.ExecModeCluster
+		}
+	}
+	if changed("instances") {
+		tuning.Instances = f.instances
+		// Pedir más de una instancia implica el modo cluster
+		if f.instances > 1 && !changed("cluster") {
+			tuning.ExecMode = utils.ExecModeCluster
+		}
+	}
+	if changed("max-memory") {
+		tuning.MaxMemory = strings.ToUpper(f.maxMemory)
+	}
+	if changed("restart-delay") {
+		tuning.RestartDelay = int(f.restartDelay.Milliseconds())
+	}
+	if changed("node-args") {
+		tuning.NodeArgs = f.nodeArgs
+	}
+	if err := tuning.Validate(); err != nil {
+		return tuning, err
+	}
+	return tuning, nil
+}
+
+// laravelFlags agrupa los flags de los workers de colas, del programador de tareas y de Octane
+type laravelFlags struct {
+	workers    int
+	connection string
+	queue      string
+	manager    string
+	scheduler  bool
+	octane     string
+}
+
+// addLaravelFlags registra los flags de colas, programador y Octane en un comando
+func addLaravelFlags(cmd *cobra.Command, f *laravelFlags) {
+	cmd.Flags().IntVar(&f.workers, "queue-workers", 0, "Procesos de 'php artisan queue:work' (0 = sin workers)")
+	cmd.Flags().StringVar(&f.connection, "queue-connection", "", "Conexión de colas de los workers (por defecto QUEUE_CONNECTION)")
+	cmd.Flags().StringVar(&f.queue, "queue", "", "Colas que procesan los workers, separadas por comas")
+	cmd.Flags().StringVar(&f.manager, "queue-manager", "", "Gestor de los workers: systemd o supervisor")
+	cmd.Flags().BoolVar(&f.scheduler, "scheduler", false, "Instalar el cron del programador de tareas (schedule:run)")
+	cmd.Flags().StringVar(&f.octane, "octane", "", "Ejecutar con Laravel Octane: swoole, roadrunner o frankenphp (none vuelve a PHP-FPM)")
+}
+
+// applyQueue combina la configuración guardada del sitio, el manifiesto y los flags, en ese orden de prioridad
+func (f *laravelFlags) applyQueue(base utils.QueueConfig, scheduler bool, manifest *utils.ProjectManifest, changed func(name string) bool) (utils.QueueConfig, bool, error) {
+	queue := base
+	if manifest != nil {
+		if manifest.Queue.Manager != "" {
+			queue.Manager = manifest.Queue.Manager
+		}
+		if manifest.Queue.Workers != nil {
+			queue.Workers = manifest.Queue.Workers
+		}
+		if manifest.Scheduler != nil {
+			scheduler = *manifest.Scheduler
+		}
+	}
+
+	if changed("queue-manager") {
+		queue.Manager = f.manager
+	}
+	// Los flags definen un único worker que reemplaza a los configurados
+	if changed("queue-workers") || changed("queue-connection") || changed("queue") {
+		processes := 1
+		if changed("queue-workers") {
+			processes = f.workers
+		}
+		queue.Workers = nil
+		if processes > 0 {
+			queue.Workers = []utils.QueueWorker{{Connection: f.connection, Queue: f.queue, Processes: processes}}
+		}
+	}
+	if changed("scheduler") {
+		scheduler = f.scheduler
+	}
+
+	if err := queue.Validate(); err != nil {
+		return queue, scheduler, utils.NewError(utils.ErrorValidacion, "configuración de colas inválida", err)
+	}
+	return queue, scheduler, nil
+}
+
+// applyOctane combina la configuración de Octane guardada, la del manifiesto y el flag --octane
+func (f *laravelFlags) applyOctane(base utils.OctaneConfig, manifest *utils.ProjectManifest, changed func(name string) bool) (utils.OctaneConfig, error) {
+	octane := base
+	if manifest != nil && manifest.Octane.Enabled() {
+		octane = manifest.Octane
+	}
+	if changed("octane") {
+		if f.octane == "none" {
+			octane = utils.OctaneConfig{}
+		} else {
+			octane.Server = f.octane
+		}
+	}
+
+	if err := octane.Validate(); err != nil {
+		return octane, utils.NewError(utils.ErrorValidacion, "configuración de Octane inválida", err)
+	}
+	return octane, nil
 }
 
 // AddDeployCommand agrega el comando deploy al comando raíz
@@ -44,6 +211,9 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	var opts DeployOptions
 	var useSSH bool
 	var dbType string // Declaración de la variable para el tipo de base de datos
+	var waitLock bool // Esperar si otro proceso tiene el bloqueo del sitio
+	var process processFlags
+	var laravel laravelFlags
 
 	// Crear comando deploy
 	deployCmd := &cobra.Command{
@@ -60,6 +230,8 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				}
 			}
 
+			opts.Config = cfg
+
 			if opts.Domain == "" {
 				return fmt.Errorf("el dominio es obligatorio")
 			}
@@ -135,61 +307,27 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return fmt.Errorf("el sitio %s no existe, primero crea el sitio con 'sm site'", opts.Domain)
 			}
 
-			// Crear la estructura de directorios necesaria
-			fmt.Printf("Creando estructura de directorios en %s...\n", filepath.Dir(opts.AppDir))
-
-			// Crear el directorio apps si no existe
-			appsDir := filepath.Join(opts.HomeDir, "apps")
-			if _, err := os.Stat(appsDir); os.IsNotExist(err) {
-				fmt.Printf("Creando directorio apps en %s...\n", appsDir)
-				if err := os.MkdirAll(appsDir, 0755); err != nil {
-					return fmt.Errorf("error al crear directorio apps: %v", err)
-				}
-			}
-
-			// Crear todos los directorios padres necesarios
-			if err := os.MkdirAll(filepath.Dir(opts.AppDir), 0755); err != nil {
-				return fmt.Errorf("error al crear directorios padres: %v", err)
+			// Evitar despliegues simultáneos del mismo sitio
+			lock, err := utils.AcquireSiteLock(opts.Domain, "deploy", waitLock)
+			if err != nil {
+				return err
 			}
+			defer lock.Release()
 
-			// Cambiar propietario de los directorios padres
-			chownCmd := exec.Command("chown", "-R", fmt.Sprintf("%s:%s", opts.User, opts.User), filepath.Join(opts.HomeDir, "apps"))
-			if output, err := chownCmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("error al cambiar propietario de los directorios padres: %v\n%s", err, output)
+			// Registrar el despliegue en el historial del sitio
+			opts.ReleaseID = newReleaseName()
+			recorder, recErr := utils.StartDeployRecord(opts.ReleaseID, opts.Domain, opts.Repository, opts.Branch)
+			if recErr != nil {
+				fmt.Printf("Advertencia: no se pudo registrar el despliegue en el historial: %v\n", recErr)
 			}
+			opts.Recorder = recorder
 
-			// Generar nombre para la clave SSH
-			if opts.UseSSH {
-				// Sanitizar nombres para usarlos en el nombre de archivo
-				domainSafe := strings.ReplaceAll(opts.Domain, ".", "_")
-				ownerSafe := strings.ReplaceAll(opts.RepoOwner, "-", "_")
-				repoSafe := strings.ReplaceAll(opts.RepoName, "-", "_")
-
-				keyName := fmt.Sprintf("%s_%s_%s", domainSafe, ownerSafe, repoSafe)
-				opts.SSHKeyPath = filepath.Join(opts.HomeDir, ".ssh", keyName)
-
-				// Clonar repositorio
-				if err := cloneRepository(&opts); err != nil {
-					return err
-				}
-
-				// Configurar entorno según el tipo de aplicación
-				switch opts.Type {
-				case "laravel":
-					if err := deployLaravel(&opts); err != nil {
-						return err
-					}
-				case "nodejs":
-					if err := deployNodejs(&opts, dbType); err != nil {
-						return err
-					}
-				default:
-					return fmt.Errorf("tipo de aplicación no soportado: %s", opts.Type)
-				}
+			err = runDeploy(cmd, &opts, dbType, &process, &laravel)
+			recorder.Finish(err)
+			if recorder != nil {
+				fmt.Printf("Registro del despliegue: sm deploy log -d %s %s\n", opts.Domain, opts.ReleaseID)
 			}
-
-			fmt.Printf("Aplicación desplegada correctamente en %s\n", opts.Domain)
-			return nil
+			return err
 		},
 	}
 	// Agregar flags
@@ -199,7 +337,19 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	deployCmd.Flags().StringVarP(&opts.Type, "type", "t", "", "Tipo de aplicación (laravel, nodejs)")
 	deployCmd.Flags().StringVarP(&opts.Environment, "env", "e", "production", "Entorno (development, production)")
 	deployCmd.Flags().BoolVarP(&useSSH, "ssh", "s", false, "Usar SSH para clonar el repositorio")
-	deployCmd.Flags().StringVar(&dbType, "database", "", "Tipo de base de datos a configurar (postgresql, mysql)")
+	deployCmd.Flags().StringVar(&dbType, "database", "", "Tipo de base de datos a crear para el sitio (postgresql, mysql)")
+	deployCmd.Flags().StringVar(&opts.HealthCheck.Path, "health-path", "/", "Ruta HTTP para verificar la aplicación tras el despliegue")
+	deployCmd.Flags().IntVar(&opts.HealthCheck.ExpectedStatus, "health-status", 0, "Código HTTP esperado (por defecto cualquier código menor a 400)")
+	deployCmd.Flags().StringVar(&opts.HealthCheck.BodyContains, "health-body", "", "Texto que debe contener la respuesta")
+	deployCmd.Flags().DurationVar(&opts.HealthCheck.Timeout, "health-timeout", utils.DefaultHealthTimeout, "Tiempo máximo de reintentos de la verificación")
+	deployCmd.Flags().BoolVar(&opts.HealthCheck.Disabled, "no-health-check", false, "No verificar la aplicación por HTTP tras el despliegue")
+	deployCmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+	deployCmd.Flags().StringVar(&opts.ProcessManager, "process-manager", utils.ProcessManagerPM2, "Gestor de procesos para Node.js y Laravel Octane (pm2, systemd)")
+	addProcessFlags(deployCmd, &process)
+	addLaravelFlags(deployCmd, &laravel)
+	deployCmd.Flags().BoolVar(&opts.AllowLockfileDrift, "allow-lockfile-drift", false, "Instalar dependencias aunque no coincidan con el archivo de bloqueo")
+	deployCmd.Flags().BoolVar(&opts.StrictEnv, "strict", false, "Cancelar el despliegue si el .env tiene variables faltantes, vacías requeridas o con valores de ejemplo")
+	deployCmd.Flags().StringVar(&opts.NodeSpec, "node", "", "Versión de Node.js (por defecto la de .nvmrc, .node-version o engines.node)")
 
 	// Marcar flags obligatorios
 	deployCmd.MarkFlagRequired("domain")
@@ -259,12 +409,62 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return fmt.Errorf("el directorio de la aplicación no existe: %s", opts.AppDir)
 			}
 
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			// Evitar reconfigurar PM2 mientras otra operación modifica el sitio
+			lock, err := utils.AcquireSiteLock(opts.Domain, "deploy reset-pm2", waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+
+			// Ubicar la release activa y su manifiesto
+			currentDir, err := findCurrentAppDir(opts.AppDir)
+			if err != nil {
+				return err
+			}
+			opts.CurrentDir = currentDir
+			manifest, err := utils.LoadProjectManifest(currentDir)
+			if err != nil {
+				return err
+			}
+			opts.Manifest = manifest
+			if manifest != nil {
+				opts.AppSubdir = manifest.Subdirectory
+			}
+			opts.AppDir = liveAppDir(&opts)
+
+			// Conservar el gestor de procesos con el que se desplegó el sitio
+			state, err := utils.LoadSiteState(opts.Domain)
+			if err != nil {
+				return err
+			}
+			opts.PreviousState = state
+			var tuning utils.ProcessTuning
+			if state != nil {
+				opts.ProcessManager = state.ProcessManager
+				opts.NodeVersion = state.NodeVersion
+				tuning = state.ProcessTuning
+			}
+			if opts.Tuning, err = process.apply(tuning, cmd.Flags().Changed); err != nil {
+				return err
+			}
+
 			return resetPM2(&opts)
 		},
 	}
 
 	// Agregar flags al subcomando reset-pm2
 	resetPM2Cmd.Flags().StringVarP(&opts.Domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	resetPM2Cmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+	addProcessFlags(resetPM2Cmd, &process)
 	resetPM2Cmd.MarkFlagRequired("domain")
 
 	// Agregar subcomando reset-pm2 al comando deploy
@@ -304,6 +504,22 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return fmt.Errorf("el directorio de la aplicación no existe: %s", opts.AppDir)
 			}
 
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			// Evitar eliminar el proyecto mientras otra operación lo modifica
+			lock, err := utils.AcquireSiteLock(opts.Domain, "deploy remove", waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+
 			return removeDeployedProject(&opts)
 		},
 	}
@@ -311,15 +527,185 @@ func AddDeployCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	// Agregar flags al subcomando remove
 	removeCmd.Flags().StringVarP(&opts.Domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
 	removeCmd.Flags().BoolVar(&opts.Backup, "backup", false, "Hacer backup de la carpeta del proyecto antes de eliminar")
+	removeCmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
 	removeCmd.MarkFlagRequired("domain")
 
 	// Agregar subcomando remove al comando deploy
 	deployCmd.AddCommand(removeCmd)
 
+	// Agregar subcomandos de historial
+	addDeployHistoryCommands(deployCmd, cfg)
+
 	// Agregar comando al comando raíz
 	rootCmd.AddCommand(deployCmd)
 }
 
+// runDeploy ejecuta las etapas del despliegue registrando cada una en el historial
+func runDeploy(cmd *cobra.Command, opts *DeployOptions, dbType string, process *processFlags, laravel *laravelFlags) error {
+	rec := opts.Recorder
+
+	// Estado del despliegue anterior, usado para conservar el gestor de procesos y revertir
+	previous, err := utils.LoadSiteState(opts.Domain)
+	if err != nil {
+		fmt.Printf("Advertencia: %v\n", err)
+	}
+	opts.PreviousState = previous
+	if !cmd.Flags().Changed("process-manager") && previous != nil && previous.ProcessManager != "" {
+		opts.ProcessManager = previous.ProcessManager
+	}
+	if _, err := utils.NewProcessManager(opts.ProcessManager); err != nil {
+		return err
+	}
+	var tuning utils.ProcessTuning
+	if previous != nil {
+		tuning = previous.ProcessTuning
+	}
+	if opts.Tuning, err = process.apply(tuning, cmd.Flags().Changed); err != nil {
+		return err
+	}
+
+	// Crear la estructura de directorios necesaria
+	fmt.Printf("Creando estructura de directorios en %s...\n", filepath.Dir(opts.AppDir))
+
+	// Crear el directorio apps si no existe
+	appsDir := filepath.Join(opts.HomeDir, "apps")
+	if _, err := os.Stat(appsDir); os.IsNotExist(err) {
+		fmt.Printf("Creando directorio apps en %s...\n", appsDir)
+		if err := os.MkdirAll(appsDir, 0755); err != nil {
+			return fmt.Errorf("error al crear directorio apps: %v", err)
+		}
+	}
+
+	// Crear todos los directorios padres necesarios
+	if err := os.MkdirAll(filepath.Dir(opts.AppDir), 0755); err != nil {
+		return fmt.Errorf("error al crear directorios padres: %v", err)
+	}
+
+	// Cambiar propietario de los directorios padres
+	chownCmd := exec.Command("chown", "-R", fmt.Sprintf("%s:%s", opts.User, opts.User), filepath.Join(opts.HomeDir, "apps"))
+	if output, err := chownCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario de los directorios padres: %v\n%s", err, output)
+	}
+
+	// Generar nombre para la clave SSH
+	if opts.UseSSH {
+		// Sanitizar nombres para usarlos en el nombre de archivo
+		domainSafe := strings.ReplaceAll(opts.Domain, ".", "_")
+		ownerSafe := strings.ReplaceAll(opts.RepoOwner, "-", "_")
+		repoSafe := strings.ReplaceAll(opts.RepoName, "-", "_")
+
+		keyName := fmt.Sprintf("%s_%s_%s", domainSafe, ownerSafe, repoSafe)
+		opts.SSHKeyPath = filepath.Join(opts.HomeDir, ".ssh", keyName)
+	}
+
+	// Clonar repositorio y cargar su manifiesto
+	err = rec.Step("clonar", func() error {
+		if err := cloneRepository(opts); err != nil {
+			return err
+		}
+		if rec != nil {
+			rec.Record.Release = opts.ReleaseDir
+			rec.Record.Commit = releaseCommit(opts)
+		}
+
+		if err := loadDeployManifest(opts, cmd.Flags().Changed("type")); err != nil {
+			return err
+		}
+
+		// Conservar el .env de la release activa
+		return carryOverEnv(opts)
+	})
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		rec.Record.Type = opts.Type
+	}
+
+	// Colas, programador y Octane de Laravel: estado guardado, manifiesto y flags
+	if opts.Type == "laravel" {
+		var base utils.QueueConfig
+		var scheduler bool
+		if previous != nil && previous.Type == "laravel" {
+			base, scheduler = previous.Queue, previous.Scheduler
+		}
+		if opts.Queue, opts.Scheduler, err = laravel.applyQueue(base, scheduler, opts.Manifest, cmd.Flags().Changed); err != nil {
+			return err
+		}
+		var octane utils.OctaneConfig
+		if previous != nil && previous.Type == "laravel" {
+			octane = previous.Octane
+		}
+		if opts.Octane, err = laravel.applyOctane(octane, opts.Manifest, cmd.Flags().Changed); err != nil {
+			return err
+		}
+	}
+
+	// Configurar la verificación de salud: los flags tienen prioridad sobre el manifiesto
+	if opts.Manifest != nil {
+		applyManifestHealth(&opts.HealthCheck, opts.Manifest.Health, cmd.Flags().Changed)
+	}
+
+	// Construir la release según el tipo de aplicación
+	err = rec.Step("construir", func() error {
+		switch opts.Type {
+		case "laravel":
+			return deployLaravel(opts, dbType)
+		case "nodejs":
+			return deployNodejs(opts, dbType)
+		default:
+			return fmt.Errorf("tipo de aplicación no soportado: %s", opts.Type)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	recordDeployEnv(opts)
+
+	// Publicar la nueva release
+	if err := rec.Step("activar", func() error { return activateRelease(opts) }); err != nil {
+		return err
+	}
+
+	// Iniciar y verificar la aplicación; si falla, volver a la release anterior
+	deployErr := rec.Step("iniciar", func() error { return startApplication(opts) })
+	if deployErr == nil {
+		deployErr = rec.Step("verificar", func() error { return verifyDeployment(opts) })
+	}
+	if deployErr != nil {
+		fmt.Printf("Error: %v\n", deployErr)
+		if opts.PreviousRelease == "" {
+			return fmt.Errorf("el despliegue falló y no hay una release anterior a la cual volver: %v", deployErr)
+		}
+		if err := rec.Step("revertir", func() error { return rollbackRelease(opts) }); err != nil {
+			return fmt.Errorf("el despliegue falló (%v) y no se pudo restaurar la release anterior: %v", deployErr, err)
+		}
+		if rec != nil {
+			rec.Record.Status = utils.DeployStatusRolledBack
+		}
+		return fmt.Errorf("el despliegue falló y se restauró la release anterior: %v", deployErr)
+	}
+
+	if err := saveSiteState(opts); err != nil {
+		fmt.Printf("Advertencia: no se pudo guardar el estado del sitio: %v\n", err)
+	}
+	pruneReleases(opts)
+
+	fmt.Printf("Aplicación desplegada correctamente en %s\n", opts.Domain)
+	return nil
+}
+
+// releaseCommit devuelve el commit desplegado en la release
+func releaseCommit(opts *DeployOptions) string {
+	cmd := exec.Command("su", "-c", "git rev-parse HEAD", opts.User)
+	cmd.Dir = opts.ReleaseDir
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
 // cloneRepository clona el repositorio Git
 func cloneRepository(opts *DeployOptions) error {
 	// Extraer el nombre del repositorio de la URL
@@ -345,15 +731,14 @@ func cloneRepository(opts *DeployOptions) error {
 	}
 
 	// Construir la ruta del directorio de la aplicación
-	// Usar el dominio completo como directorio principal y el nombre del repositorio como subdirectorio
-	var appDir string
-	if opts.IsSubdomain {
-		// Para subdominios, usar la estructura /home/parentdomain/apps/subdomain/reponame
-		appDir = filepath.Join(opts.HomeDir, "apps", opts.Domain, repoName)
-	} else {
-		// Para dominios principales, usar la estructura /home/domain/apps/domain/reponame
-		appDir = filepath.Join(opts.HomeDir, "apps", opts.Domain, repoName)
-	}
+	// La ruta estable /home/<dominio>/apps/<dominio>/<repo> es un enlace simbólico a la
+	// release activa; cada despliegue se clona en apps/<dominio>/releases/<fecha>
+	opts.CurrentDir = filepath.Join(opts.HomeDir, "apps", opts.Domain, repoName)
+	if opts.ReleaseID == "" {
+		opts.ReleaseID = newReleaseName()
+	}
+	opts.ReleaseDir = filepath.Join(releasesDir(opts), opts.ReleaseID)
+	appDir := opts.ReleaseDir
 	opts.AppDir = appDir
 
 	// Crear la estructura de directorios necesaria
@@ -365,21 +750,17 @@ func cloneRepository(opts *DeployOptions) error {
 		return fmt.Errorf("error al crear directorios padres: %v", err)
 	}
 
+	// Los despliegues anteriores a las releases se conservan como release
+	if err := migrateLegacyLayout(opts); err != nil {
+		return err
+	}
+
 	// Cambiar propietario de los directorios padres
 	chownCmd := exec.Command("chown", "-R", fmt.Sprintf("%s:%s", opts.User, opts.User), filepath.Join(opts.HomeDir, "apps"))
 	if output, err := chownCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error al cambiar propietario de los directorios padres: %v\n%s", err, output)
 	}
 
-	// Verificar si el directorio de la aplicación ya existe
-	if _, err := os.Stat(appDir); err == nil {
-		// Eliminar solo el directorio de esta aplicación específica
-		fmt.Printf("Eliminando directorio de la aplicación existente en %s...\n", appDir)
-		if err := os.RemoveAll(appDir); err != nil {
-			return fmt.Errorf("error al eliminar directorio de la aplicación: %v", err)
-		}
-	}
-
 	// Si vamos a usar SSH, necesitamos manejar las claves
 	if opts.UseSSH {
 		if err := setupSSHKey(opts); err != nil {
@@ -409,7 +790,9 @@ func cloneRepository(opts *DeployOptions) error {
 		)
 	}
 
-	if output, err := gitCmd.CombinedOutput(); err != nil {
+	output, err := gitCmd.CombinedOutput()
+	opts.Recorder.LogCommand(fmt.Sprintf("git clone --branch %s %s", opts.Branch, opts.Repository), output)
+	if err != nil {
 		return fmt.Errorf("error al clonar repositorio: %v\n%s", err, output)
 	}
 
@@ -530,7 +913,7 @@ Host %s
 }
 
 // deployLaravel configura y despliega una aplicación Laravel
-func deployLaravel(opts *DeployOptions) error {
+func deployLaravel(opts *DeployOptions, dbType string) error {
 	// Esta es una implementación básica, puede ser expandida según necesidades
 	fmt.Printf("Desplegando aplicación Laravel en %s...\n", opts.Domain)
 
@@ -544,6 +927,11 @@ func deployLaravel(opts *DeployOptions) error {
 		return fmt.Errorf("no se encontró el archivo artisan en %s, ¿es una aplicación Laravel?", opts.AppDir)
 	}
 
+	// storage se comparte entre releases
+	if err := linkSharedStorage(opts); err != nil {
+		return err
+	}
+
 	// Crear directorios necesarios
 	dirsToCreate := []string{
 		filepath.Join(opts.AppDir, "bootstrap/cache"),
@@ -572,8 +960,8 @@ func deployLaravel(opts *DeployOptions) error {
 	storageDir := filepath.Join(opts.AppDir, "storage")
 	bootstrapCacheDir := filepath.Join(opts.AppDir, "bootstrap/cache")
 
-	// Dar permisos recursivos a storage
-	chmodCmd := exec.Command("chmod", "-R", "775", storageDir)
+	// Dar permisos recursivos a storage (enlace al directorio compartido)
+	chmodCmd := exec.Command("chmod", "-R", "775", storageDir+"/")
 	if output, err := chmodCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error al configurar permisos de storage: %v\n%s", err, output)
 	}
@@ -603,7 +991,7 @@ func deployLaravel(opts *DeployOptions) error {
 			envStr = strings.ReplaceAll(envStr, "APP_DEBUG=true", "APP_DEBUG=false")
 
 			// Escribir el archivo .env modificado
-			if err := os.WriteFile(envPath, []byte(envStr), 0644); err != nil {
+			if err := os.WriteFile(envPath, []byte(envStr), utils.EnvFileMode); err != nil {
 				return fmt.Errorf("error al escribir .env: %v", err)
 			}
 
@@ -615,68 +1003,84 @@ func deployLaravel(opts *DeployOptions) error {
 		}
 	}
 
-	// Ejecutar comandos como el usuario del sitio
-	commands := []string{
-		// Instalar dependencias con feedback
-		"composer install --no-dev --optimize-autoloader --no-interaction --prefer-dist",
-		// Generar clave de aplicación
-		"php artisan key:generate",
-		// Crear enlace simbólico para storage
-		"php artisan storage:link",
-		// Ejecutar migraciones, pero permitir que falle (por si la BD no está configurada)
-		"php artisan migrate --force || echo 'Error en migraciones. Verifica la configuración de la base de datos'",
-		// Optimizaciones
-		"php artisan config:cache",
-		"php artisan route:cache || echo 'No se pudieron cachear las rutas'",
-		"php artisan view:cache",
+	// Crear la base de datos del sitio; sus credenciales se escriben con los demás secretos
+	if dbType != "" {
+		engine, err := utils.ParseDatabaseEngine(dbType)
+		if err != nil {
+			return err
+		}
+		if _, err := ensureDeployDatabase(opts.Domain, engine); err != nil {
+			return err
+		}
 	}
 
-	for _, cmdStr := range commands {
-		cmd := exec.Command("su", "-c", cmdStr, opts.User)
-		cmd.Dir = opts.AppDir // Establecer el directorio de trabajo
-		output, err := cmd.CombinedOutput()
-		fmt.Printf("Ejecutando: %s\n", cmdStr)
-		fmt.Printf("Salida: %s\n", output)
+	// Escribir los secretos del sitio en el .env
+	if err := renderSecretsEnv(opts.Domain, opts.AppDir, opts.User); err != nil {
+		return err
+	}
 
-		// Para algunos comandos, queremos continuar incluso si fallan
-		if err != nil && !strings.Contains(cmdStr, "echo 'Error") && !strings.Contains(cmdStr, "echo 'No se") {
-			return fmt.Errorf("error al ejecutar comando '%s': %v\n%s", cmdStr, err, output)
-		}
+	// Verificar las variables requeridas por el manifiesto y comparar el .env con .env.example
+	if err := checkRequiredEnv(opts); err != nil {
+		return err
+	}
+	if err := verifyDeployEnv(opts, nil, "APP_KEY"); err != nil {
+		return err
 	}
 
-	// Configurar directorios públicos
-	var publicHtmlPath string
-	if opts.IsSubdomain {
-		// Para subdominios, usar una carpeta específica dentro de public_html
-		publicHtmlPath = filepath.Join(opts.HomeDir, "public_html", opts.Domain)
-		// Asegurarse de que el directorio existe
-		if err := os.MkdirAll(filepath.Dir(publicHtmlPath), 0755); err != nil {
-			return fmt.Errorf("error al crear directorio para subdominio: %v", err)
+	// Instalar dependencias: el manifiesto reemplaza la instalación autodetectada
+	if opts.Manifest != nil && len(opts.Manifest.Hooks.Build) > 0 {
+		if err := runManifestSteps(opts, "build", opts.Manifest.Hooks.Build); err != nil {
+			return err
 		}
 	} else {
-		// Para dominio principal, usar public_html directamente
-		publicHtmlPath = filepath.Join(opts.HomeDir, "public_html")
+		if err := runLaravelCommands(opts, []string{
+			// Instalar dependencias con feedback
+			"composer install --no-dev --optimize-autoloader --no-interaction --prefer-dist",
+		}); err != nil {
+			return err
+		}
+		// Compilar los assets del frontend (Vite o Laravel Mix)
+		if err := buildLaravelAssets(opts); err != nil {
+			return err
+		}
 	}
 
-	appPublicPath := filepath.Join(opts.AppDir, "public")
+	// Ejecutar comandos como el usuario del sitio
+	if err := runLaravelCommands(opts, []string{
+		// Generar clave de aplicación
+		"php artisan key:generate",
+		// Crear enlace simbólico para storage
+		"php artisan storage:link",
+	}); err != nil {
+		return err
+	}
 
-	// Eliminar carpeta existente
-	if err := os.RemoveAll(publicHtmlPath); err != nil {
-		return fmt.Errorf("error al eliminar directorio público existente: %v", err)
+	// Pasos previos a las migraciones declarados en el manifiesto
+	if opts.Manifest != nil {
+		if err := runManifestSteps(opts, "pre_migrate", opts.Manifest.Hooks.PreMigrate); err != nil {
+			return err
+		}
 	}
 
-	// Crear enlace simbólico
-	if err := os.Symlink(appPublicPath, publicHtmlPath); err != nil {
-		return fmt.Errorf("error al crear enlace simbólico: %v", err)
+	if err := runLaravelCommands(opts, []string{
+		// Ejecutar migraciones, pero permitir que falle (por si la BD no está configurada)
+		"php artisan migrate --force || echo 'Error en migraciones. Verifica la configuración de la base de datos'",
+		// Optimizaciones
+		"php artisan config:cache",
+		"php artisan route:cache || echo 'No se pudieron cachear las rutas'",
+		"php artisan view:cache",
+	}); err != nil {
+		return err
 	}
 
-	// Cambiar propietario del enlace
-	cmd = exec.Command("chown", "-h", fmt.Sprintf("%s:%s", opts.User, opts.User), publicHtmlPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario del enlace: %v\n%s", err, output)
+	// Octane ejecuta la aplicación como proceso propio en lugar de PHP-FPM
+	if opts.Octane.Enabled() {
+		if err := prepareOctane(opts); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Aplicación Laravel desplegada correctamente en %s\n", opts.Domain)
+	fmt.Printf("Aplicación Laravel construida correctamente en %s\n", opts.AppDir)
 	return nil
 }
 
@@ -710,6 +1114,23 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 		fmt.Println("Proyecto con TypeScript: Sí")
 	}
 
+	// Preparar la versión de Node.js que pide el proyecto
+	if err := resolveNodeVersion(opts); err != nil {
+		return err
+	}
+
+	// Los builds estáticos los sirve Nginx en lugar de un gestor de procesos
+	applyManifestOverrides(projectInfo, opts.Manifest)
+	opts.NextStandalone = projectInfo.NextStandalone
+	if projectInfo.Static {
+		opts.StaticDir, opts.SPA = projectInfo.OutputDir, projectInfo.SPA
+		fmt.Printf("Build estático: Nginx servirá %s sin un proceso de Node.js\n", opts.StaticDir)
+	} else if opts.ProcessManager == utils.ProcessManagerPM2 {
+		if err := utils.ValidatePM2Cluster(opts.Tuning, opts.NodeVersion); err != nil {
+			return err
+		}
+	}
+
 	// AQUÍ ES DONDE DEBEMOS COLOCAR NUESTRA LÓGICA DE SELECCIÓN DE BASE DE DATOS
 	// Si se especificó un tipo de base de datos mediante flag, forzar su uso
 	if dbType != "" {
@@ -728,85 +1149,20 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 	}
 
 	// Determinar puerto para la aplicación
-	var port int
-	if opts.IsSubdomain {
-		// Para subdominios, usar un puerto aleatorio
-		h := fnv.New32a()
-		h.Write([]byte(opts.Domain))
-		port = 3001 + int(h.Sum32()%999) // Puertos entre 3001 y 3999
-		fmt.Printf("Generando puerto aleatorio para subdominio: %d\n", port)
-	} else {
-		// Para dominios principales, usar un puerto aleatorio
-		h := fnv.New32a()
-		h.Write([]byte(opts.Domain))
-		port = 3001 + int(h.Sum32()%999) // Puertos entre 3001 y 3999
-		fmt.Printf("Generando puerto aleatorio para dominio principal: %d\n", port)
-	}
-
-	// Actualizar la configuración de Nginx con el nuevo puerto
-	nginxConfPath := filepath.Join(opts.HomeDir, "nginx", fmt.Sprintf("%s.conf", opts.Domain))
-	if _, err := os.Stat(nginxConfPath); err == nil {
-		// Leer el archivo
-		confData, err := os.ReadFile(nginxConfPath)
-		if err != nil {
-			return fmt.Errorf("error al leer configuración Nginx: %v", err)
-		}
-
-		// Reemplazar el puerto en la configuración
-		confStr := string(confData)
-		var newConf string
-
-		// Buscar y reemplazar cualquier proxy_pass existente
-		if strings.Contains(confStr, "proxy_pass http://localhost:") {
-			// Extraer el puerto actual
-			portParts := strings.Split(confStr, "proxy_pass http://localhost:")
-			if len(portParts) > 1 {
-				portEnd := strings.Index(portParts[1], ";")
-				if portEnd > 0 {
-					oldPort := portParts[1][:portEnd]
-					// Reemplazar el puerto antiguo con el nuevo
-					newConf = strings.ReplaceAll(confStr, "proxy_pass http://localhost:"+oldPort, fmt.Sprintf("proxy_pass http://localhost:%d", port))
-				} else {
-					// Si no se puede extraer el puerto, simplemente reemplazar toda la línea
-					newConf = strings.ReplaceAll(confStr, "proxy_pass http://localhost:", fmt.Sprintf("proxy_pass http://localhost:%d", port))
-				}
-			} else {
-				// Si no se puede extraer el puerto, simplemente reemplazar toda la línea
-				newConf = strings.ReplaceAll(confStr, "proxy_pass http://localhost:", fmt.Sprintf("proxy_pass http://localhost:%d", port))
-			}
-		} else {
-			// Si no hay proxy_pass, agregar uno nuevo
-			// Buscar la ubicación correcta para agregar el proxy_pass
-			if strings.Contains(confStr, "location / {") {
-				newConf = strings.ReplaceAll(confStr, "location / {", fmt.Sprintf("location / {\n        proxy_pass http://localhost:%d;", port))
-			} else if strings.Contains(confStr, "location /") {
-				newConf = strings.ReplaceAll(confStr, "location /", fmt.Sprintf("location / {\n        proxy_pass http://localhost:%d;", port))
-			} else {
-				// Si no se encuentra una ubicación adecuada, agregar al final
-				newConf = confStr + fmt.Sprintf("\n    location / {\n        proxy_pass http://localhost:%d;\n    }", port)
-			}
-		}
-
-		// Escribir el archivo
-		if err := os.WriteFile(nginxConfPath, []byte(newConf), 0644); err != nil {
-			return fmt.Errorf("error al escribir configuración Nginx: %v", err)
-		}
-
-		// Cambiar propietario del archivo de configuración
-		chownCmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), nginxConfPath)
-		if output, err := chownCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("error al cambiar propietario del archivo de configuración: %v\n%s", err, output)
-		}
+	port := appPort(opts)
+	opts.Port = port
 
-		// Recargar Nginx
-		reloadCmd := exec.Command("systemctl", "reload", "nginx")
-		if output, err := reloadCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("error al recargar Nginx: %v\n%s", err, output)
+	// Actualizar la configuración de Nginx con el nuevo puerto. Los builds estáticos no usan
+	// proxy: su configuración se genera al activar la release.
+	if !projectInfo.Static {
+		if err := updateNginxProxyPort(opts); err != nil {
+			return err
 		}
+	}
 
-		fmt.Printf("Configuración de Nginx actualizada para usar el puerto %d\n", port)
-	} else {
-		fmt.Printf("No se encontró archivo de configuración Nginx en %s\n", nginxConfPath)
+	// Las variables requeridas por el manifiesto implican configurar el archivo .env
+	if opts.Manifest != nil && len(opts.Manifest.Env.Required) > 0 {
+		projectInfo.RequiresEnv = true
 	}
 
 	// Verificar si necesita variables de entorno
@@ -815,6 +1171,8 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 
 		// Variables de entorno predeterminadas según el framework
 		userEnvVars := make(map[string]string)
+		// Comentarios que se agregan al archivo .env
+		var envNotes []string
 
 		// Si es una aplicación con una base de datos
 		if projectInfo.RequiresDatabase {
@@ -823,16 +1181,15 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 			// Configurar base de datos según el tipo
 			switch projectInfo.DBType {
 			case "postgresql":
-				// Usar la función mejorada de configuración de PostgreSQL
-				pgEnvVars, pgErr := setupPostgreSQLDatabase(opts, projectInfo)
+				pgEnvVars, pgErr := setupNodeDatabase(opts, utils.DBTypePostgreSQL, projectInfo)
 				if pgErr != nil {
 					fmt.Printf("Advertencia: error al configurar PostgreSQL: %v\n", pgErr)
 					fmt.Println("Se omitirá la configuración automática de la base de datos.")
 					fmt.Println("Por favor, configure PostgreSQL manualmente y actualice el archivo .env")
 
 					// Agregar variables de entorno de respaldo para que Prisma no falle
-					dbName := strings.ReplaceAll(opts.Domain, ".", "_")
-					dbUser := opts.User
+					dbName := utils.DatabaseNameForDomain(opts.Domain)
+					dbUser := utils.DatabaseUserForName(dbName)
 					dbPassword := "dev_password_please_change" // Contraseña temporal que debe cambiarse
 
 					// Configurar variables de entorno de respaldo
@@ -845,9 +1202,10 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 					userEnvVars["DB_USERNAME"] = dbUser
 					userEnvVars["DB_PASSWORD"] = dbPassword
 
-					// Agregar comentario al principio del archivo .env
-					userEnvVars["# IMPORTANTE"] = "La configuración de PostgreSQL no pudo completarse automáticamente."
-					userEnvVars["# POR FAVOR"] = "Modifique las credenciales de la base de datos manualmente."
+					// Dejar constancia en el archivo .env
+					envNotes = append(envNotes,
+						"IMPORTANTE: La configuración de PostgreSQL no pudo completarse automáticamente.",
+						"POR FAVOR: Modifique las credenciales de la base de datos manualmente.")
 				} else {
 					// Agregar variables de entorno de PostgreSQL
 					for key, value := range pgEnvVars {
@@ -855,36 +1213,15 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 					}
 				}
 			case "mysql":
-				// Código existente para MySQL
-				dbName := strings.ReplaceAll(opts.Domain, ".", "_")
-				dbUser := strings.ReplaceAll(opts.User, "-", "_")
-				dbPassword := generateRandomPassword(16)
-
-				dbOpts := &utils.DatabaseOptions{
-					Type:      utils.DBTypeMySQL,
-					Host:      "localhost",
-					Port:      3306,
-					Name:      dbName,
-					User:      dbUser,
-					Password:  dbPassword,
-					Charset:   "utf8mb4",
-					Collation: "utf8mb4_unicode_ci",
-				}
-
-				// Crear base de datos
 				fmt.Println("Creando base de datos MySQL...")
-				if err := utils.CreateDatabase(dbOpts); err != nil {
+				mysqlEnvVars, err := setupNodeDatabase(opts, utils.DBTypeMySQL, projectInfo)
+				if err != nil {
 					fmt.Printf("Advertencia: error al crear base de datos: %v\n", err)
 					// Continuar aunque haya error en la creación de la base de datos
 				} else {
-					// Agregar URL de conexión a las variables de entorno
-					userEnvVars["DATABASE_URL"] = utils.BuildDatabaseURL(dbOpts)
-					userEnvVars["DB_CONNECTION"] = "mysql"
-					userEnvVars["DB_HOST"] = "localhost"
-					userEnvVars["DB_PORT"] = "3306"
-					userEnvVars["DB_DATABASE"] = dbName
-					userEnvVars["DB_USERNAME"] = dbUser
-					userEnvVars["DB_PASSWORD"] = dbPassword
+					for key, value := range mysqlEnvVars {
+						userEnvVars[key] = value
+					}
 				}
 			default:
 				fmt.Printf("Tipo de base de datos no soportado: %s\n", projectInfo.DBType)
@@ -932,13 +1269,14 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 
 			// Asegurar que PWA está habilitada en producción
 			userEnvVars["NEXT_PUBLIC_PWA_ENABLED"] = "true"
-		case utils.FrameworkExpress:
+		case utils.FrameworkExpress, utils.FrameworkFastify, utils.FrameworkHono, utils.FrameworkKoa,
+			utils.FrameworkNuxtJS, utils.FrameworkRemix, utils.FrameworkAstro, utils.FrameworkSvelteKit:
 			userEnvVars["NODE_ENV"] = "production"
 			userEnvVars["PORT"] = fmt.Sprintf("%d", port) // Asegurarse de que el puerto se establece correctamente
 		}
 
 		// Configurar archivo .env
-		if err := utils.ConfigureNodeJSEnv(opts.AppDir, projectInfo, userEnvVars); err != nil {
+		if err := utils.ConfigureNodeJSEnv(opts.AppDir, projectInfo, userEnvVars, envNotes...); err != nil {
 			fmt.Printf("Advertencia: error al configurar archivo .env: %v\n", err)
 			// Continuamos aunque haya error en el .env
 		} else {
@@ -951,266 +1289,242 @@ func deployNodejs(opts *DeployOptions, dbType string) error {
 				fmt.Printf("Advertencia: error al cambiar propietario del archivo .env: %v\n%s\n", err, output)
 			}
 		}
-
-		// Si es un proyecto con Prisma, ejecutar prisma generate y migrate
-		if projectInfo.HasPrisma {
-			fmt.Println("Proyecto con Prisma detectado, ejecutando migraciones...")
-
-			// Verificar si PostgreSQL está disponible antes de ejecutar comandos de Prisma
-			pgCheckCmd := exec.Command("sudo", "-u", "postgres", "pg_isready")
-			if pgOutput, pgErr := pgCheckCmd.CombinedOutput(); pgErr != nil {
-				fmt.Printf("Advertencia: PostgreSQL no está disponible: %v\n%s\n", pgErr, pgOutput)
-				fmt.Println("Se omitirán las operaciones de Prisma. Por favor, configure PostgreSQL manualmente y ejecute las migraciones después.")
-			} else {
-				// Verificar que DATABASE_URL existe en el archivo .env antes de continuar
-				envFilePath := filepath.Join(opts.AppDir, ".env")
-				if envContent, err := os.ReadFile(envFilePath); err == nil {
-					envLines := strings.Split(string(envContent), "\n")
-					hasDbUrl := false
-
-					for _, line := range envLines {
-						if strings.HasPrefix(line, "DATABASE_URL=") {
-							hasDbUrl = true
-							break
-						}
-					}
-
-					if !hasDbUrl {
-						fmt.Println("No se encontró DATABASE_URL en el archivo .env. Se omitirán las operaciones de Prisma.")
-						return nil // Return nil to indicate no error
-					}
-				}
-
-				// Ejecutar comandos de Prisma directamente sin instalar globalmente
-				// Instalar @prisma/client y generar el cliente
-				generateCmd := "npm install @prisma/client && npx prisma generate"
-				cmd := exec.Command("su", "-c", generateCmd, opts.User)
-				cmd.Dir = opts.AppDir
-				fmt.Printf("Ejecutando: %s\n", generateCmd)
-				if output, err := cmd.CombinedOutput(); err != nil {
-					fmt.Printf("Error al ejecutar prisma generate: %v\n%s\n", err, output)
-					// Intentar una alternativa
-					alternativeCmd := "cd " + opts.AppDir + " && npm install @prisma/client && npx prisma generate"
-					altCmd := exec.Command("su", "-c", alternativeCmd, opts.User)
-					fmt.Printf("Intentando comando alternativo: %s\n", alternativeCmd)
-					if altOutput, altErr := altCmd.CombinedOutput(); altErr != nil {
-						fmt.Printf("Error con el comando alternativo: %v\n%s\n", altErr, altOutput)
-					} else {
-						fmt.Printf("Comando alternativo exitoso: %s\n", altOutput)
-					}
-				} else {
-					fmt.Printf("Prisma generate completado: %s\n", output)
-				}
-
-				// Verificar si existen migraciones antes de intentar ejecutarlas
-				migrationsPath := filepath.Join(opts.AppDir, "prisma", "migrations")
-				if _, err := os.Stat(migrationsPath); err == nil {
-					// Ejecutar prisma migrate deploy
-					migrateCmd := "npx prisma migrate deploy"
-					cmd = exec.Command("su", "-c", migrateCmd, opts.User)
-					cmd.Dir = opts.AppDir
-					fmt.Printf("Ejecutando: %s\n", migrateCmd)
-					if output, err := cmd.CombinedOutput(); err != nil {
-						fmt.Printf("Advertencia: error en migraciones de Prisma (no crítico): %v\n%s\n", err, output)
-					} else {
-						fmt.Printf("Migraciones de Prisma completadas: %s\n", output)
-					}
-				} else {
-					fmt.Println("No se encontraron migraciones de Prisma. Omitiendo prisma migrate deploy.")
-				}
-			}
-		}
 	}
 
-	// Ejecutar comandos como el usuario del sitio
-	commands := []string{
-		// Instalar dependencias con fallback options
-		"npm ci || npm install || npm install --legacy-peer-deps || npm install --force",
+	// Escribir los secretos del sitio en el .env y verificarlo contra el manifiesto y .env.example
+	if err := renderSecretsEnv(opts.Domain, opts.AppDir, opts.User); err != nil {
+		return err
 	}
-
-	// Si hay comando de build, agregarlo
-	buildCmd := utils.GetNodeJSBuildCommand(projectInfo)
-	if buildCmd != "" {
-		commands = append(commands, buildCmd)
+	if err := checkRequiredEnv(opts); err != nil {
+		return err
+	}
+	if err := verifyDeployEnv(opts, projectInfo.EnvVars); err != nil {
+		return err
 	}
 
-	for _, cmdStr := range commands {
-		cmd := exec.Command("su", "-c", cmdStr, opts.User)
-		cmd.Dir = opts.AppDir // Establecer el directorio de trabajo
-		fmt.Printf("Ejecutando: %s\n", cmdStr)
-		output, err := cmd.CombinedOutput()
+	// Instalar dependencias y compilar como el usuario del sitio
+	pm := projectInfo.PackageManager
+	fmt.Printf("Gestor de paquetes: %s\n", pm)
+	usePrisma := projectInfo.RequiresEnv && projectInfo.HasPrisma
 
-		if len(output) > 0 {
-			fmt.Printf("Salida: %s\n", output)
+	// Los pasos previos a las migraciones del manifiesto se ejecutan siempre, con o sin ORM o
+	// base de datos, una vez instaladas las dependencias
+	runPreMigrate := func() error {
+		if opts.Manifest == nil {
+			return nil
 		}
+		return runManifestSteps(opts, "pre_migrate", opts.Manifest.Hooks.PreMigrate)
+	}
 
-		if err != nil {
-			// Para npm install, intentar con diferentes opciones si hay errores
-			if strings.Contains(cmdStr, "npm") && strings.Contains(cmdStr, "install") {
-				fmt.Printf("Advertencia: hubo algunos errores en la instalación de dependencias, intentando con opciones alternativas...\n")
-
-				// Intentar con --legacy-peer-deps
-				legacyCmd := exec.Command("su", "-c", "npm install --legacy-peer-deps", opts.User)
-				legacyCmd.Dir = opts.AppDir
-				if legacyOutput, legacyErr := legacyCmd.CombinedOutput(); legacyErr == nil {
-					fmt.Printf("Instalación exitosa con --legacy-peer-deps\n")
-					continue
-				} else {
-					fmt.Printf("Error con --legacy-peer-deps: %v\n%s\n", legacyErr, legacyOutput)
-				}
-
-				// Intentar con --force
-				forceCmd := exec.Command("su", "-c", "npm install --force", opts.User)
-				forceCmd.Dir = opts.AppDir
-				if forceOutput, forceErr := forceCmd.CombinedOutput(); forceErr == nil {
-					fmt.Printf("Instalación exitosa con --force\n")
-					continue
-				} else {
-					fmt.Printf("Error con --force: %v\n%s\n", forceErr, forceOutput)
-				}
-
-				// Si todos los intentos fallan, mostrar advertencia pero continuar
-				fmt.Printf("Advertencia: no se pudo instalar las dependencias correctamente, pero continuaremos: %v\n", err)
-			} else {
-				return fmt.Errorf("error al ejecutar comando '%s': %v\n%s", cmdStr, err, output)
+	// El manifiesto reemplaza la instalación y compilación autodetectadas
+	if opts.Manifest != nil && len(opts.Manifest.Hooks.Build) > 0 {
+		if err := runManifestSteps(opts, "build", opts.Manifest.Hooks.Build); err != nil {
+			return err
+		}
+		if err := runPreMigrate(); err != nil {
+			return err
+		}
+		if usePrisma {
+			if err := setupPrisma(opts, pm); err != nil {
+				return err
 			}
 		}
-	}
-
-	// Determinar comando para iniciar la aplicación
-	startCommand := utils.GetNodeJSStartCommand(projectInfo)
-
-	// Para frameworks específicos, configurar comando de inicio
-	switch projectInfo.Framework {
-	case utils.FrameworkNestJS:
-		if projectInfo.HasTypeScript {
-			// Para NestJS con TypeScript, usar la ruta correcta o npm run start
-			// Verificar si existe el script start en package.json
-			packageJSONPath := filepath.Join(opts.AppDir, "package.json")
-			if _, err := os.Stat(packageJSONPath); err == nil {
-				// Leer package.json para verificar si tiene script start
-				packageJSONContent, err := os.ReadFile(packageJSONPath)
-				if err == nil {
-					packageJSONStr := string(packageJSONContent)
-					if strings.Contains(packageJSONStr, "\"start\":") {
-						// Usar npm run start si está disponible
-						startCommand = "npm run start"
-					} else {
-						// Usar la ruta correcta al archivo main.js
-						startCommand = "node dist/src/main.js"
-					}
-				} else {
-					// Fallback a la ruta correcta
-					startCommand = "node dist/src/main.js"
-				}
-			} else {
-				// Fallback a la ruta correcta
-				startCommand = "node dist/src/main.js"
+	} else {
+		if err := installNodeDependencies(opts, pm); err != nil {
+			return err
+		}
+		if err := runPreMigrate(); err != nil {
+			return err
+		}
+		// Prisma necesita las dependencias instaladas y el cliente generado antes de compilar
+		if usePrisma {
+			if err := setupPrisma(opts, pm); err != nil {
+				return err
+			}
+		}
+		if buildCmd := utils.GetNodeJSBuildCommand(projectInfo); buildCmd != "" {
+			if err := runNodeCommand(opts, buildCmd); err != nil {
+				return fmt.Errorf("error al ejecutar comando '%s': %v", buildCmd, err)
 			}
 		}
-	case utils.FrameworkNextJS:
-		// Para Next.js, necesitamos un puerto específico
-		startCommand = fmt.Sprintf("npm run start -- -p %d", port)
 	}
 
-	// Crear archivo de configuración para PM2
-	pmConfig := fmt.Sprintf(`{
-  "apps": [{
-    "name": "%s",
-    "script": "%s",
-    "cwd": "%s",
-    "env": {
-      "NODE_ENV": "production",
-      "PORT": "%d"
-    },
-    "error_file": "%s/logs/%s_error.log",
-    "out_file": "%s/logs/%s_output.log",
-    "merge_logs": true,
-    "max_memory_restart": "200M",
-    "restart_delay": 3000,
-    "watch": false,
-    "exec_mode": "fork",
-    "instances": 1,
-    "autorestart": true
-  }]
-}`, opts.Domain, startCommand, opts.AppDir, port, opts.HomeDir, opts.Domain, opts.HomeDir, opts.Domain)
+	// Un build estático no ejecuta un proceso: verificar que generó los archivos
+	if projectInfo.Static {
+		if _, err := os.Stat(filepath.Join(opts.AppDir, opts.StaticDir, "index.html")); err != nil {
+			return fmt.Errorf("el build no generó %s/index.html; indique el directorio con 'output' en %s",
+				opts.StaticDir, utils.ManifestFileName)
+		}
+		return nil
+	}
 
-	// Asegurarse de que el directorio de logs existe
-	logsDir := filepath.Join(opts.HomeDir, "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	// Next.js standalone: completar el servidor independiente con los archivos estáticos
+	if projectInfo.NextStandalone {
+		if err := prepareNextStandalone(opts); err != nil {
+			return err
+		}
 	}
 
-	// Cambiar propietario del directorio de logs
-	logChownCmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), logsDir)
-	if output, err := logChownCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario del directorio de logs: %v\n%s", err, output)
+	// Determinar comando para iniciar la aplicación
+	startCommand := nodeStartCommand(projectInfo, port)
+
+	// El comando de inicio del manifiesto tiene prioridad sobre la detección
+	if opts.Manifest != nil && opts.Manifest.Start != "" {
+		startCommand = opts.Manifest.Start
 	}
 
-	// Crear archivos de log con los permisos correctos
-	errorLogPath := filepath.Join(logsDir, fmt.Sprintf("%s_error.log", opts.Domain))
-	outputLogPath := filepath.Join(logsDir, fmt.Sprintf("%s_output.log", opts.Domain))
+	opts.StartCommand = startCommand
+	opts.ProcessEnv = nodeProcessEnv(projectInfo)
+	return nil
+}
+
+// appPort asigna a la aplicación un puerto entre 3001 y 3999 derivado del dominio
+func appPort(opts *DeployOptions) int {
+	h := fnv.New32a()
+	h.Write([]byte(opts.Domain))
+	port := 3001 + int(h.Sum32()%999)
+	if opts.IsSubdomain {
+		fmt.Printf("Generando puerto aleatorio para subdominio: %d\n", port)
+	} else {
+		fmt.Printf("Generando puerto aleatorio para dominio principal: %d\n", port)
+	}
+	return port
+}
 
-	// Crear archivos de log vacíos
-	if err := os.WriteFile(errorLogPath, []byte(""), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de log de error: %v", err)
+// applyManifestOverrides aplica el manifiesto a la detección: 'output' indica el directorio del
+// build estático y 'start' obliga a ejecutar ese comando como proceso
+func applyManifestOverrides(projectInfo *utils.NodeJSProjectInfo, manifest *utils.ProjectManifest) {
+	if manifest == nil {
+		return
 	}
-	if err := os.WriteFile(outputLogPath, []byte(""), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de log de salida: %v", err)
+	if manifest.Output != "" {
+		projectInfo.Static, projectInfo.OutputDir = true, manifest.Output
+	} else if manifest.Start != "" {
+		projectInfo.Static = false
+		projectInfo.NextStandalone = false
 	}
+}
 
-	// Cambiar propietario de los archivos de log
-	logFilesChownCmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), errorLogPath, outputLogPath)
-	if output, err := logFilesChownCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario de los archivos de log: %v\n%s", err, output)
+// nodeStartCommand determina el comando de inicio de la aplicación en el puerto indicado
+func nodeStartCommand(projectInfo *utils.NodeJSProjectInfo, port int) string {
+	// Next.js recibe el puerto como argumento; el servidor standalone lo lee de PORT
+	if projectInfo.Framework == utils.FrameworkNextJS && !projectInfo.NextStandalone && projectInfo.StartCommand != "" {
+		return projectInfo.PackageManager.RunArgs("start", fmt.Sprintf("-p %d", port))
 	}
+	return utils.GetNodeJSStartCommand(projectInfo)
+}
 
-	configPath := filepath.Join(opts.HomeDir, fmt.Sprintf("pm2.%s.config.json", opts.Domain))
-	if err := os.WriteFile(configPath, []byte(pmConfig), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de configuración PM2: %v", err)
+// nodeProcessEnv devuelve las variables adicionales que necesita el proceso de la aplicación
+func nodeProcessEnv(projectInfo *utils.NodeJSProjectInfo) map[string]string {
+	// El servidor standalone escucha en HOSTNAME, que puede contener el nombre del equipo
+	if projectInfo.NextStandalone {
+		return map[string]string{"HOSTNAME": "127.0.0.1"}
 	}
+	return nil
+}
 
-	// Cambiar propietario del archivo de configuración
-	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), configPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario: %v\n%s", err, output)
+// appProcess describe el proceso de la aplicación desplegada (Node.js o Laravel Octane)
+func appProcess(opts *DeployOptions) utils.AppProcess {
+	return utils.AppProcess{
+		Name:    opts.Domain,
+		User:    opts.User,
+		HomeDir: opts.HomeDir,
+		WorkDir: liveAppDir(opts),
+		Command: opts.StartCommand,
+		Port:    opts.Port,
+
+		NodeVersion:   opts.NodeVersion,
+		Env:           opts.ProcessEnv,
+		ProcessTuning: opts.Tuning,
 	}
+}
 
-	// Detener la aplicación si ya está en ejecución (tanto en root como en el usuario)
-	exec.Command("pm2", "delete", opts.Domain).Run()                          // Ignorar errores aquí
-	exec.Command("sudo", "-u", opts.User, "pm2", "delete", opts.Domain).Run() // Ignorar errores aquí
+// startAppProcess configura el gestor de procesos del sitio e inicia la aplicación desde la ruta estable
+func startAppProcess(opts *DeployOptions) error {
+	pm, err := utils.NewProcessManager(opts.ProcessManager)
+	if err != nil {
+		return err
+	}
+	app := appProcess(opts)
 
-	// Asegurarse de que PM2 está configurado para el usuario
-	startupCmd := exec.Command("sudo", "-u", opts.User, "pm2", "startup")
-	if output, err := startupCmd.CombinedOutput(); err != nil {
-		fmt.Printf("Advertencia: error al configurar PM2 startup (no crítico): %v\n", err)
-		fmt.Printf("Salida de PM2 startup: %s\n", output)
+	// Si el sitio cambia de gestor, eliminar el proceso anterior para liberar el puerto
+	if prev := opts.PreviousState; prev != nil && prev.RunsProcess() && prev.ProcessManager != pm.Name() {
+		if oldPM, err := utils.NewProcessManager(prev.ProcessManager); err == nil {
+			fmt.Printf("Cambiando el gestor de procesos de %s a %s...\n", oldPM.Name(), pm.Name())
+			if err := oldPM.Remove(prev.AppProcess()); err != nil {
+				fmt.Printf("Advertencia: no se pudo eliminar el proceso anterior: %v\n", err)
+			}
+		}
 	}
 
-	// Iniciar la aplicación como el usuario
-	startCmd := exec.Command("sudo", "-u", opts.User, "pm2", "start", configPath)
+	if err := pm.Install(app); err != nil {
+		return err
+	}
 
-	output, err := startCmd.CombinedOutput()
-	if len(output) > 0 {
-		fmt.Printf("Salida de PM2: %s\n", output)
+	// Si el proceso ya corre con la misma forma, recargarlo para no cortar las peticiones en curso
+	if prev := opts.PreviousState; prev != nil && prev.RunsProcess() && prev.ProcessManager == pm.Name() &&
+		prev.Port == app.Port && prev.ExecMode == app.ExecMode && prev.EffectiveInstances() == app.EffectiveInstances() {
+		if err := pm.Reload(app); err == nil {
+			fmt.Printf("Aplicación recargada correctamente con %s en el puerto %d\n", pm.Name(), opts.Port)
+			return nil
+		}
+		fmt.Println("No se pudo recargar la aplicación, se iniciará de nuevo...")
 	}
 
-	if err != nil {
-		return fmt.Errorf("error al iniciar la aplicación con PM2: %v\n%s", err, output)
+	if err := pm.Start(app); err != nil {
+		return err
 	}
 
-	fmt.Printf("Aplicación iniciada correctamente en el puerto %d\n", port)
+	fmt.Printf("Aplicación iniciada correctamente con %s en el puerto %d\n", pm.Name(), opts.Port)
 	return nil
 }
 
-// generateRandomPassword genera una contraseña aleatoria
-func generateRandomPassword(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
+// saveSiteState guarda cómo quedó desplegado el sitio para los comandos sm app y futuras reversiones
+func saveSiteState(opts *DeployOptions) error {
+	state := &utils.SiteState{
+		Domain:  opts.Domain,
+		Type:    opts.Type,
+		User:    opts.User,
+		HomeDir: opts.HomeDir,
+		AppDir:  liveAppDir(opts),
+	}
+	// Conservar los datos registrados por sm site: su directorio, la versión de PHP y el pool
+	// dedicado con sus directivas de php.ini
+	if opts.PreviousState != nil {
+		state.SiteDir = opts.PreviousState.SiteDir
+		state.PHPVersion = opts.PreviousState.PHPVersion
+		state.PHPPool = opts.PreviousState.PHPPool
+	}
+	if opts.Type == "laravel" {
+		state.Queue = opts.Queue
+		state.Scheduler = opts.Scheduler
+		state.Octane = opts.Octane
+	}
+	if opts.Type == "laravel" && opts.Octane.Enabled() {
+		// Octane se ejecuta como proceso propio, igual que una aplicación Node.js
+		state.Port = opts.Port
+		state.ProcessManager = opts.ProcessManager
+		if state.ProcessManager == "" {
+			state.ProcessManager = utils.ProcessManagerPM2
+		}
+		state.StartCommand = opts.StartCommand
+		state.ProcessTuning = opts.Tuning
+	} else if opts.Type == "nodejs" && opts.StaticDir != "" {
+		// Nginx sirve el build estático; no hay proceso ni puerto
+		state.Type = "static"
+		state.NodeVersion = opts.NodeVersion
+	} else if opts.Type == "nodejs" {
+		state.Port = opts.Port
+		state.ProcessManager = opts.ProcessManager
+		if state.ProcessManager == "" {
+			state.ProcessManager = utils.ProcessManagerPM2
+		}
+		state.StartCommand = opts.StartCommand
+		state.ProcessTuning = opts.Tuning
+		state.NodeVersion = opts.NodeVersion
+		state.ProcessEnv = opts.ProcessEnv
 	}
-	return string(b)
+	return utils.SaveSiteState(state)
 }
 
 // generateRandomString genera una cadena aleatoria (sin caracteres especiales)
@@ -1225,6 +1539,14 @@ func generateRandomString(length int) string {
 
 // resetPM2 reinicia la configuración de PM2 para una aplicación existente
 func resetPM2(opts *DeployOptions) error {
+	// Solo las aplicaciones Node.js tienen un proceso que reconfigurar; Laravel (también con
+	// Octane) se reinicia con 'sm app restart'
+	state := opts.PreviousState
+	if state != nil && state.Type != "nodejs" {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("%s es un sitio %s; reset-pm2 solo reconfigura aplicaciones Node.js (use 'sm app restart -d %s')", opts.Domain, state.Type, opts.Domain), nil)
+	}
+
 	fmt.Printf("Reconfigurando PM2 para %s...\n", opts.Domain)
 
 	// Detectar framework Node.js y obtener información del proyecto
@@ -1232,296 +1554,75 @@ func resetPM2(opts *DeployOptions) error {
 	if err != nil {
 		return fmt.Errorf("error al detectar framework: %v", err)
 	}
-
-	// Determinar puerto para la aplicación
-	port := projectInfo.DefaultPort
-	if opts.IsSubdomain {
-		// Para subdominios, leer el puerto de la configuración de Nginx
-		nginxConfPath := filepath.Join(opts.HomeDir, "nginx", fmt.Sprintf("%s.conf", opts.Domain))
-		if _, err := os.Stat(nginxConfPath); err == nil {
-			// Leer el archivo
-			confData, err := os.ReadFile(nginxConfPath)
-			if err != nil {
-				return fmt.Errorf("error al leer configuración Nginx: %v", err)
-			}
-
-			// Buscar el puerto en la configuración
-			confStr := string(confData)
-			if strings.Contains(confStr, "proxy_pass http://localhost:") {
-				portStr := strings.Split(strings.Split(confStr, "proxy_pass http://localhost:")[1], ";")[0]
-				if p, err := strconv.Atoi(portStr); err == nil {
-					port = p
-					fmt.Printf("Usando puerto %d de la configuración de Nginx\n", port)
-				}
-			}
-		} else {
-			// Si no se encuentra la configuración, usar un puerto basado en hash
-			h := fnv.New32a()
-			h.Write([]byte(opts.Domain))
-			port = 3001 + int(h.Sum32()%999) // Puertos entre 3001 y 3999
-			fmt.Printf("Generando puerto aleatorio: %d\n", port)
-		}
-	}
-
-	// Determinar comando para iniciar la aplicación
-	startCommand := utils.GetNodeJSStartCommand(projectInfo)
-
-	// Para frameworks específicos, configurar comando de inicio
-	switch projectInfo.Framework {
-	case utils.FrameworkNestJS:
-		if projectInfo.HasTypeScript {
-			// Para NestJS con TypeScript, usar la ruta correcta o npm run start
-			// Verificar si existe el script start en package.json
-			packageJSONPath := filepath.Join(opts.AppDir, "package.json")
-			if _, err := os.Stat(packageJSONPath); err == nil {
-				// Leer package.json para verificar si tiene script start
-				packageJSONContent, err := os.ReadFile(packageJSONPath)
-				if err == nil {
-					packageJSONStr := string(packageJSONContent)
-					if strings.Contains(packageJSONStr, "\"start\":") {
-						// Usar npm run start si está disponible
-						startCommand = "npm run start"
-					} else {
-						// Usar la ruta correcta al archivo main.js
-						startCommand = "node dist/src/main.js"
-					}
-				} else {
-					// Fallback a la ruta correcta
-					startCommand = "node dist/src/main.js"
-				}
-			} else {
-				// Fallback a la ruta correcta
-				startCommand = "node dist/src/main.js"
-			}
-		}
-	case utils.FrameworkNextJS:
-		// Para Next.js, necesitamos un puerto específico
-		startCommand = fmt.Sprintf("next start -p %d", port)
+	applyManifestOverrides(projectInfo, opts.Manifest)
+	if projectInfo.Static {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("%s es un build estático servido por Nginx y no usa un gestor de procesos", opts.Domain), nil)
 	}
 
-	// Crear archivo de configuración para PM2
-	pmConfig := fmt.Sprintf(`{
-  "apps": [{
-    "name": "%s",
-    "script": "%s",
-    "cwd": "%s",
-    "env": {
-      "NODE_ENV": "production",
-      "PORT": "%d"
-    },
-    "error_file": "%s/logs/%s_error.log",
-    "out_file": "%s/logs/%s_output.log",
-    "merge_logs": true,
-    "max_memory_restart": "200M",
-    "restart_delay": 3000,
-    "watch": false,
-    "exec_mode": "fork",
-    "instances": 1,
-    "autorestart": true
-  }]
-}`, opts.Domain, startCommand, opts.AppDir, port, opts.HomeDir, opts.Domain, opts.HomeDir, opts.Domain)
-
-	// Asegurarse de que el directorio de logs existe
-	logsDir := filepath.Join(opts.HomeDir, "logs")
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	// Conservar el puerto registrado; sin estado se usa el mismo que asigna el despliegue
+	port := 0
+	if state != nil {
+		port = state.Port
 	}
-
-	// Cambiar propietario del directorio de logs
-	logChownCmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), logsDir)
-	if output, err := logChownCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario del directorio de logs: %v\n%s", err, output)
+	if port == 0 {
+		port = appPort(opts)
 	}
 
-	// Crear archivos de log con los permisos correctos
-	errorLogPath := filepath.Join(logsDir, fmt.Sprintf("%s_error.log", opts.Domain))
-	outputLogPath := filepath.Join(logsDir, fmt.Sprintf("%s_output.log", opts.Domain))
-
-	// Crear archivos de log vacíos
-	if err := os.WriteFile(errorLogPath, []byte(""), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de log de error: %v", err)
-	}
-	if err := os.WriteFile(outputLogPath, []byte(""), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de log de salida: %v", err)
-	}
-
-	// Cambiar propietario de los archivos de log
-	logFilesChownCmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), errorLogPath, outputLogPath)
-	if output, err := logFilesChownCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario de los archivos de log: %v\n%s", err, output)
-	}
+	// Determinar comando para iniciar la aplicación
+	startCommand := nodeStartCommand(projectInfo, port)
 
-	configPath := filepath.Join(opts.HomeDir, fmt.Sprintf("pm2.%s.config.json", opts.Domain))
-	if err := os.WriteFile(configPath, []byte(pmConfig), 0644); err != nil {
-		return fmt.Errorf("error al crear archivo de configuración PM2: %v", err)
+	// El comando de inicio del manifiesto tiene prioridad sobre la detección
+	if opts.Manifest != nil && opts.Manifest.Start != "" {
+		startCommand = opts.Manifest.Start
 	}
 
-	// Cambiar propietario del archivo de configuración
-	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), configPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al cambiar propietario: %v\n%s", err, output)
+	opts.Type = "nodejs"
+	opts.Port = port
+	opts.StartCommand = startCommand
+	opts.ProcessEnv = nodeProcessEnv(projectInfo)
+	if err := startAppProcess(opts); err != nil {
+		return err
 	}
 
-	// Detener la aplicación si ya está en ejecución (tanto en root como en el usuario)
-	exec.Command("pm2", "delete", opts.Domain).Run()                          // Ignorar errores aquí
-	exec.Command("sudo", "-u", opts.User, "pm2", "delete", opts.Domain).Run() // Ignorar errores aquí
-
-	// Asegurarse de que PM2 está configurado para el usuario
-	startupCmd := exec.Command("sudo", "-u", opts.User, "pm2", "startup")
-	if output, err := startupCmd.CombinedOutput(); err != nil {
-		fmt.Printf("Advertencia: error al configurar PM2 startup (no crítico): %v\n", err)
-		fmt.Printf("Salida de PM2 startup: %s\n", output)
-	}
-
-	// Iniciar la aplicación como el usuario
-	startCmd := exec.Command("sudo", "-u", opts.User, "pm2", "start", configPath)
-
-	output, err := startCmd.CombinedOutput()
-	if len(output) > 0 {
-		fmt.Printf("Salida de PM2: %s\n", output)
+	// Actualizar solo los datos del proceso y conservar el resto del estado
+	if state == nil {
+		err = saveSiteState(opts)
+	} else {
+		state.Port = port
+		state.StartCommand = startCommand
+		state.ProcessEnv = opts.ProcessEnv
+		state.ProcessTuning = opts.Tuning
+		if opts.ProcessManager != "" {
+			state.ProcessManager = opts.ProcessManager
+		}
+		err = utils.SaveSiteState(state)
 	}
-
 	if err != nil {
-		return fmt.Errorf("error al iniciar la aplicación con PM2: %v\n%s", err, output)
+		fmt.Printf("Advertencia: no se pudo guardar el estado del sitio: %v\n", err)
 	}
 
 	fmt.Printf("PM2 reconfigurado correctamente para %s\n", opts.Domain)
 	return nil
 }
 
-// Función corregida para manejar la autenticación PostgreSQL correctamente
-
-func setupPostgreSQLDatabase(opts *DeployOptions, projectInfo *utils.NodeJSProjectInfo) (map[string]string, error) {
-	// Variables de entorno que se devolverán
-	envVars := make(map[string]string)
-
-	// Verificar si PostgreSQL está disponible
-	pgCheckCmd := exec.Command("sudo", "-u", "postgres", "pg_isready")
-	pgOutput, pgErr := pgCheckCmd.CombinedOutput()
-
-	if pgErr != nil {
-		fmt.Printf("PostgreSQL no está disponible: %v\n%s\n", pgErr, pgOutput)
-		fmt.Println("¿Desea configurar PostgreSQL manualmente? (s/n)")
-
-		var response string
-		fmt.Scanln(&response)
-
-		if strings.ToLower(response) == "s" {
-			// Solicitar datos de configuración manual
-			// [Código de configuración manual existente...]
-			// ...
-			return envVars, nil
-		}
-
-		// Si el usuario no desea configurar manualmente, devolver error
-		return nil, fmt.Errorf("PostgreSQL no está disponible y se omitió la configuración manual")
-	}
-
-	// PostgreSQL está disponible, configurar automáticamente
-
-	// Sanitizar nombre de dominio para usarlo como nombre de base de datos
-	dbName := strings.ReplaceAll(opts.Domain, ".", "_")
-	// Usar el usuario de sistema como usuario de base de datos
-	dbUser := opts.User
-	// Generar contraseña aleatoria
-	dbPassword := generateRandomPassword(16)
-
-	// Verificar si el usuario ya existe en PostgreSQL
-	checkUserCmd := fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname='%s'", dbUser)
-	cmd := exec.Command("sudo", "-u", "postgres", "psql", "-tAc", checkUserCmd)
-	userOutput, userErr := cmd.CombinedOutput()
-
-	userExists := false
-	if userErr == nil && strings.TrimSpace(string(userOutput)) == "1" {
-		userExists = true
-		fmt.Printf("El usuario PostgreSQL '%s' ya existe\n", dbUser)
-	}
-
-	if !userExists {
-		// Crear usuario de PostgreSQL
-		createUserCmd := fmt.Sprintf("CREATE USER %s WITH ENCRYPTED PASSWORD '%s';", dbUser, dbPassword)
-		cmd = exec.Command("sudo", "-u", "postgres", "psql", "-c", createUserCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			fmt.Printf("Error al crear usuario PostgreSQL: %v\n%s\n", err, output)
-			return nil, fmt.Errorf("error al crear usuario PostgreSQL: %v", err)
-		}
-
-		fmt.Printf("Usuario PostgreSQL '%s' creado exitosamente\n", dbUser)
-	} else {
-		// Si el usuario ya existe, cambiar su contraseña
-		alterUserCmd := fmt.Sprintf("ALTER USER %s WITH ENCRYPTED PASSWORD '%s';", dbUser, dbPassword)
-		cmd = exec.Command("sudo", "-u", "postgres", "psql", "-c", alterUserCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			fmt.Printf("Error al cambiar contraseña del usuario PostgreSQL: %v\n%s\n", err, output)
-			return nil, fmt.Errorf("error al cambiar contraseña del usuario PostgreSQL: %v", err)
-		}
-
-		fmt.Printf("Contraseña actualizada para el usuario PostgreSQL '%s'\n", dbUser)
-	}
-
-	// Verificar si la base de datos ya existe
-	checkDbCmd := fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname='%s'", dbName)
-	cmd = exec.Command("sudo", "-u", "postgres", "psql", "-tAc", checkDbCmd)
-	dbOutput, dbErr := cmd.CombinedOutput()
-
-	dbExists := false
-	if dbErr == nil && strings.TrimSpace(string(dbOutput)) == "1" {
-		dbExists = true
-		fmt.Printf("La base de datos PostgreSQL '%s' ya existe\n", dbName)
+// setupNodeDatabase crea o reutiliza la base de datos principal de una aplicación Node.js y
+// devuelve las variables del .env con sus credenciales, que quedan en los secretos del sitio
+func setupNodeDatabase(opts *DeployOptions, engine utils.DatabaseType, projectInfo *utils.NodeJSProjectInfo) (map[string]string, error) {
+	envVars, err := ensureDeployDatabase(opts.Domain, engine)
+	if err != nil {
+		return nil, err
 	}
 
-	if !dbExists {
-		// Crear base de datos
-		createDbCmd := fmt.Sprintf("CREATE DATABASE %s OWNER %s;", dbName, dbUser)
-		cmd = exec.Command("sudo", "-u", "postgres", "psql", "-c", createDbCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			fmt.Printf("Error al crear base de datos PostgreSQL: %v\n%s\n", err, output)
-			return nil, fmt.Errorf("error al crear base de datos PostgreSQL: %v", err)
+	// Prisma usa DATABASE_URL con el esquema explícito
+	if engine == utils.DBTypePostgreSQL && projectInfo.HasPrisma && !strings.Contains(envVars["DATABASE_URL"], "?") {
+		envVars["DATABASE_URL"] += "?schema=public"
+		if err := saveSiteSecrets(opts.Domain, map[string]string{"DATABASE_URL": envVars["DATABASE_URL"]}); err != nil {
+			return nil, err
 		}
-
-		fmt.Printf("Base de datos PostgreSQL '%s' creada exitosamente\n", dbName)
-	} else {
-		// Si la base de datos ya existe, asignar permisos al usuario
-		grantCmd := fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s;", dbName, dbUser)
-		cmd = exec.Command("sudo", "-u", "postgres", "psql", "-c", grantCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			fmt.Printf("Error al asignar permisos sobre la base de datos: %v\n%s\n", err, output)
-			// No retornamos error aquí, continuamos con la configuración
-		}
-	}
-
-	// Construir URL de conexión para diferentes formatos según el framework
-	databaseURL := fmt.Sprintf("postgresql://%s:%s@localhost:5432/%s", dbUser, dbPassword, dbName)
-
-	// Configurar variables de entorno según el framework detectado
-	envVars["DATABASE_URL"] = databaseURL
-
-	// Variables para Laravel
-	envVars["DB_CONNECTION"] = "pgsql"
-	envVars["DB_HOST"] = "localhost"
-	envVars["DB_PORT"] = "5432"
-	envVars["DB_DATABASE"] = dbName
-	envVars["DB_USERNAME"] = dbUser
-	envVars["DB_PASSWORD"] = dbPassword
-
-	// Variables específicas para Prisma
-	if projectInfo.HasPrisma {
-		// Prisma usa DATABASE_URL en este formato
-		envVars["DATABASE_URL"] = databaseURL + "?schema=public"
 	}
 
-	// Mostrar información de conexión
-	fmt.Println("\n=== Configuración de PostgreSQL ===")
-	fmt.Printf("Base de datos: %s\n", dbName)
-	fmt.Printf("Usuario: %s\n", dbUser)
-	fmt.Printf("Contraseña: %s\n", dbPassword)
-	fmt.Printf("URL de conexión: %s\n", databaseURL)
-	fmt.Println("===================================")
-
+	fmt.Printf("Contraseña: guardada en los secretos del sitio ('sm secret get -d %s DB_PASSWORD')\n", opts.Domain)
 	return envVars, nil
 }
 
@@ -1529,27 +1630,39 @@ func setupPostgreSQLDatabase(opts *DeployOptions, projectInfo *utils.NodeJSProje
 func removeDeployedProject(opts *DeployOptions) error {
 	fmt.Printf("Eliminando proyecto desplegado en %s...\n", opts.Domain)
 
-	// Detener la aplicación en PM2
-	fmt.Println("Deteniendo aplicación en PM2...")
-	stopCmd := exec.Command("sudo", "-u", opts.User, "pm2", "stop", opts.Domain)
-	if output, err := stopCmd.CombinedOutput(); err != nil {
-		fmt.Printf("Advertencia: error al detener aplicación en PM2: %v\n%s\n", err, output)
-		// Continuamos aunque haya error al detener
-	}
-
-	// Eliminar la aplicación de PM2
-	fmt.Println("Eliminando aplicación de PM2...")
-	deleteCmd := exec.Command("sudo", "-u", opts.User, "pm2", "delete", opts.Domain)
-	if output, err := deleteCmd.CombinedOutput(); err != nil {
-		fmt.Printf("Advertencia: error al eliminar aplicación de PM2: %v\n%s\n", err, output)
-		// Continuamos aunque haya error al eliminar
+	// Detener y eliminar el proceso de la aplicación con el gestor con el que se desplegó
+	state, err := utils.LoadSiteState(opts.Domain)
+	if err != nil {
+		fmt.Printf("Advertencia: %v\n", err)
+	}
+	manager := utils.ProcessManagerPM2
+	app := utils.AppProcess{Name: opts.Domain, User: opts.User, HomeDir: opts.HomeDir}
+	if state != nil && state.ProcessManager != "" {
+		manager = state.ProcessManager
+		app = state.AppProcess()
+	}
+	if pm, err := utils.NewProcessManager(manager); err == nil {
+		fmt.Printf("Deteniendo aplicación en %s...\n", pm.Name())
+		if err := pm.Remove(app); err != nil {
+			fmt.Printf("Advertencia: error al eliminar el proceso de la aplicación: %v\n", err)
+			// Continuamos aunque haya error al eliminar
+		}
 	}
 
-	// Guardar la configuración de PM2 para que persista después de reiniciar
-	saveCmd := exec.Command("sudo", "-u", opts.User, "pm2", "save")
-	if output, err := saveCmd.CombinedOutput(); err != nil {
-		fmt.Printf("Advertencia: error al guardar configuración PM2: %v\n%s\n", err, output)
-		// Continuamos aunque haya error al guardar
+	// Eliminar los workers de colas y el cron del programador de Laravel
+	if state != nil && state.Type == "laravel" {
+		if len(state.Queue.Workers) > 0 {
+			if qm, err := utils.NewQueueManager(state.Queue.EffectiveManager()); err == nil {
+				fmt.Printf("Eliminando workers de colas en %s...\n", qm.Name())
+				site := utils.QueueSite{Domain: opts.Domain, User: opts.User, HomeDir: opts.HomeDir}
+				if err := qm.Apply(site, nil); err != nil {
+					fmt.Printf("Advertencia: error al eliminar los workers de colas: %v\n", err)
+				}
+			}
+		}
+		if err := utils.SetUserCron(opts.User, opts.Domain, "scheduler", ""); err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+		}
 	}
 
 	// Detener cualquier proceso de Node.js que esté ejecutándose en el directorio de la aplicación
@@ -1612,6 +1725,17 @@ func removeDeployedProject(opts *DeployOptions) error {
 		return fmt.Errorf("error al eliminar carpeta del proyecto: %v", err)
 	}
 
+	// El sitio sigue existiendo, pero ya no tiene una aplicación desplegada
+	if state != nil {
+		state.AppDir = ""
+		state.Port = 0
+		state.ProcessManager = ""
+		state.StartCommand = ""
+		if err := utils.SaveSiteState(state); err != nil {
+			fmt.Printf("Advertencia: no se pudo actualizar el estado del sitio: %v\n", err)
+		}
+	}
+
 	fmt.Printf("Proyecto eliminado correctamente: %s\n", opts.Domain)
 	return nil
 }
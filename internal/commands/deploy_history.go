@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// addDeployHistoryCommands agrega los subcomandos history y log al comando deploy
+func addDeployHistoryCommands(deployCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var asJSON bool
+	var limit int
+
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Mostrar el historial de despliegues de un sitio",
+		Long:  `Muestra los despliegues registrados de un sitio: fecha, usuario, rama, commit, duración y resultado.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+
+			records, err := utils.LoadDeployHistory(domain)
+			if err != nil {
+				return err
+			}
+			if limit > 0 && len(records) > limit {
+				records = records[:limit]
+			}
+
+			if asJSON {
+				return printJSON(records)
+			}
+
+			if len(records) == 0 {
+				fmt.Printf("No hay despliegues registrados para %s\n", domain)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tFECHA\tUSUARIO\tRAMA\tCOMMIT\tENV\tDURACIÓN\tESTADO")
+			for _, r := range records {
+				env := "-"
+				if r.EnvVersion > 0 {
+					env = fmt.Sprintf("v%d", r.EnvVersion)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					r.ID, r.StartedAt.Format("2006-01-02 15:04:05"), r.User, r.Branch,
+					shortCommit(r.Commit), env, r.Duration.Round(time.Second), r.Status)
+			}
+			return w.Flush()
+		},
+	}
+	historyCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	historyCmd.Flags().BoolVar(&asJSON, "json", false, "Mostrar el resultado en formato JSON")
+	historyCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Cantidad máxima de despliegues a mostrar (0 para todos)")
+	historyCmd.MarkFlagRequired("domain")
+
+	logCmd := &cobra.Command{
+		Use:   "log <id>",
+		Short: "Mostrar el detalle y la salida completa de un despliegue",
+		Long:  `Muestra las etapas de un despliegue registrado y la salida completa de los comandos ejecutados.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+
+			record, err := utils.LoadDeployRecord(domain, args[0])
+			if err != nil {
+				return err
+			}
+
+			logData, err := os.ReadFile(record.LogFile)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error al leer el log del despliegue: %v", err)
+			}
+
+			if asJSON {
+				return printJSON(struct {
+					*utils.DeployRecord
+					Log string `json:"log"`
+				}{record, string(logData)})
+			}
+
+			fmt.Printf("Despliegue:  %s\n", record.ID)
+			fmt.Printf("Sitio:       %s\n", record.Domain)
+			fmt.Printf("Usuario:     %s\n", record.User)
+			fmt.Printf("Repositorio: %s (rama %s)\n", record.Repository, record.Branch)
+			if record.Commit != "" {
+				fmt.Printf("Commit:      %s\n", record.Commit)
+			}
+			if record.Release != "" {
+				fmt.Printf("Release:     %s\n", record.Release)
+			}
+			if record.EnvVersion > 0 {
+				fmt.Printf("Env:         versión %d ('sm env rollback -d %s --deploy %s' la restaura)\n", record.EnvVersion, domain, record.ID)
+			}
+			fmt.Printf("Inicio:      %s\n", record.StartedAt.Format("2006-01-02 15:04:05"))
+			fmt.Printf("Duración:    %s\n", record.Duration)
+			fmt.Printf("Estado:      %s\n", record.Status)
+			if record.Error != "" {
+				fmt.Printf("Error:       %s\n", record.Error)
+			}
+
+			fmt.Println("\nEtapas:")
+			for _, step := range record.Steps {
+				fmt.Printf("  %-10s %-10s %s\n", step.Name, step.Status, step.Duration)
+				if step.Error != "" {
+					fmt.Printf("             %s\n", step.Error)
+				}
+			}
+
+			fmt.Printf("\nSalida completa (%s):\n", record.LogFile)
+			fmt.Print(string(logData))
+			return nil
+		},
+	}
+	logCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	logCmd.Flags().BoolVar(&asJSON, "json", false, "Mostrar el resultado en formato JSON")
+	logCmd.MarkFlagRequired("domain")
+
+	deployCmd.AddCommand(historyCmd)
+	deployCmd.AddCommand(logCmd)
+}
+
+// printJSON imprime un valor como JSON indentado
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// shortCommit abrevia un hash de commit
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
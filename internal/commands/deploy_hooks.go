@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// loadDeployManifest carga el archivo .sitemanager.yml del repositorio clonado y aplica
+// sus valores a las opciones del despliegue. Si el archivo no existe se mantiene la
+// detección automática.
+func loadDeployManifest(opts *DeployOptions, typeFromFlag bool) error {
+	manifest, err := utils.LoadProjectManifest(opts.AppDir)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return nil
+	}
+
+	fmt.Printf("Usando %s del repositorio\n", utils.ManifestFileName)
+	opts.Manifest = manifest
+
+	// El tipo indicado por flag tiene prioridad sobre el del manifiesto
+	if manifest.Type != "" && !typeFromFlag {
+		opts.Type = manifest.Type
+	}
+
+	// En monorepos la aplicación vive en un subdirectorio del repositorio
+	if manifest.Subdirectory != "" {
+		appDir := filepath.Join(opts.AppDir, manifest.Subdirectory)
+		if info, err := os.Stat(appDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("el subdirectorio %s declarado en %s no existe", manifest.Subdirectory, utils.ManifestFileName)
+		}
+		opts.AppDir = appDir
+		opts.AppSubdir = manifest.Subdirectory
+		fmt.Printf("Usando el subdirectorio %s\n", appDir)
+	}
+
+	return nil
+}
+
+// runManifestSteps ejecuta los pasos de una fase del manifiesto como el usuario del sitio
+func runManifestSteps(opts *DeployOptions, phase string, steps []utils.DeployStep) error {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Ejecutando hooks de %s (%d pasos)...\n", phase, len(steps))
+	env := []string{
+		"SM_DOMAIN=" + opts.Domain,
+		"SM_APP_DIR=" + opts.AppDir,
+		"SM_ENVIRONMENT=" + opts.Environment,
+		"SM_PHASE=" + phase,
+		"COREPACK_ENABLE_DOWNLOAD_PROMPT=0",
+	}
+	if opts.Port > 0 {
+		env = append(env, fmt.Sprintf("PORT=%d", opts.Port))
+	}
+
+	for i, step := range steps {
+		fmt.Printf("[%s %d/%d] %s\n", phase, i+1, len(steps), step.Label())
+		uc := utils.UserCommand{
+			User:    opts.User,
+			Dir:     opts.AppDir,
+			Command: nodeShell(opts, step.Run),
+			Env:     env,
+			Timeout: step.EffectiveTimeout(),
+		}
+		// Guardar la salida completa en el log del despliegue
+		if opts.Recorder != nil {
+			fmt.Fprintf(opts.Recorder, "$ %s\n", step.Run)
+			uc.Output = opts.Recorder
+		}
+		err := utils.RunUserCommand(uc)
+		if err != nil {
+			return fmt.Errorf("error en el hook %s (%s): %v", phase, step.Label(), err)
+		}
+	}
+
+	return nil
+}
+
+// checkRequiredEnv verifica que el archivo .env defina las variables que exige el manifiesto
+func checkRequiredEnv(opts *DeployOptions) error {
+	if opts.Manifest == nil || len(opts.Manifest.Env.Required) == 0 {
+		return nil
+	}
+
+	missing, err := utils.MissingEnvKeys(filepath.Join(opts.AppDir, ".env"), opts.Manifest.Env.Required)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("faltan variables de entorno requeridas por %s: %s\nConfigúralas con 'sm env -d %s' y vuelve a desplegar",
+			utils.ManifestFileName, strings.Join(missing, ", "), opts.Domain)
+	}
+
+	return nil
+}
+
+// runLaravelCommands ejecuta comandos de Laravel como el usuario del sitio. Los comandos
+// con un mensaje de respaldo ('|| echo ...') pueden fallar sin detener el despliegue.
+func runLaravelCommands(opts *DeployOptions, commands []string) error {
+	for _, cmdStr := range commands {
+		cmd := exec.Command("su", "-c", cmdStr, opts.User)
+		cmd.Dir = opts.AppDir // Establecer el directorio de trabajo
+		output, err := cmd.CombinedOutput()
+		opts.Recorder.LogCommand(cmdStr, output)
+		fmt.Printf("Ejecutando: %s\n", cmdStr)
+		fmt.Printf("Salida: %s\n", output)
+
+		// Para algunos comandos, queremos continuar incluso si fallan
+		if err != nil && !strings.Contains(cmdStr, "echo 'Error") && !strings.Contains(cmdStr, "echo 'No se") {
+			return fmt.Errorf("error al ejecutar comando '%s': %v\n%s", cmdStr, err, output)
+		}
+	}
+	return nil
+}
+
+// linkPublicDir enlaza el directorio público del sitio con un directorio de la aplicación
+func linkPublicDir(opts *DeployOptions, appPublicPath string) error {
+	if _, err := os.Stat(appPublicPath); err != nil {
+		return fmt.Errorf("el directorio público %s no existe", appPublicPath)
+	}
+
+	var publicHtmlPath string
+	if opts.IsSubdomain {
+		// Para subdominios, usar una carpeta específica dentro de public_html
+		publicHtmlPath = filepath.Join(opts.HomeDir, "public_html", opts.Domain)
+		// Asegurarse de que el directorio existe
+		if err := os.MkdirAll(filepath.Dir(publicHtmlPath), 0755); err != nil {
+			return fmt.Errorf("error al crear directorio para subdominio: %v", err)
+		}
+	} else {
+		// Para dominio principal, usar public_html directamente
+		publicHtmlPath = filepath.Join(opts.HomeDir, "public_html")
+	}
+
+	// Eliminar carpeta existente
+	if err := os.RemoveAll(publicHtmlPath); err != nil {
+		return fmt.Errorf("error al eliminar directorio público existente: %v", err)
+	}
+
+	// Crear enlace simbólico
+	if err := os.Symlink(appPublicPath, publicHtmlPath); err != nil {
+		return fmt.Errorf("error al crear enlace simbólico: %v", err)
+	}
+
+	// Cambiar propietario del enlace
+	cmd := exec.Command("chown", "-h", fmt.Sprintf("%s:%s", opts.User, opts.User), publicHtmlPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario del enlace: %v\n%s", err, output)
+	}
+
+	return nil
+}
+
+// applyManifestHealth completa la verificación de salud con el bloque health del manifiesto.
+// Los valores indicados por flag no se reemplazan.
+func applyManifestHealth(health *utils.HealthCheckOptions, manifest utils.HealthCheckOptions, changed func(name string) bool) {
+	if manifest.Disabled && !changed("no-health-check") {
+		health.Disabled = true
+	}
+	if manifest.Path != "" && !changed("health-path") {
+		health.Path = manifest.Path
+	}
+	if manifest.ExpectedStatus != 0 && !changed("health-status") {
+		health.ExpectedStatus = manifest.ExpectedStatus
+	}
+	if manifest.BodyContains != "" && !changed("health-body") {
+		health.BodyContains = manifest.BodyContains
+	}
+	if manifest.Timeout > 0 && !changed("health-timeout") {
+		health.Timeout = manifest.Timeout
+	}
+	if manifest.Interval > 0 {
+		health.Interval = manifest.Interval
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"syscall"
 
 	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/dotenv"
 	"github.com/elmersh/sitemanager/internal/utils"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -22,6 +23,7 @@ type EnvOptions struct {
 	EnvVars     []string
 	Interactive bool
 	File        string
+	WaitLock    bool
 }
 
 // AddEnvCommand agrega el comando env al comando raíz
@@ -33,8 +35,10 @@ func AddEnvCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	envCmd := &cobra.Command{
 		Use:   "env",
 		Short: "Configurar variables de entorno para un sitio",
-		Long:  `Configura variables de entorno para un sitio, creando o modificando el archivo .env.`,
-		RunE: func(cmd *cobra.Command, args []string) error {
+		Long: `Configura variables de entorno para un sitio, creando o modificando el archivo .env
+de la aplicación desplegada. Use los subcomandos get, set, unset, list, import,
+export y edit para gestionar variables concretas, y check para verificarlas.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			// Cargar configuración si no se ha pasado
 			if cfg == nil {
 				var err error
@@ -43,42 +47,34 @@ func AddEnvCommand(rootCmd *cobra.Command, cfg *config.Config) {
 					return fmt.Errorf("error al cargar la configuración: %v", err)
 				}
 			}
-
-			// Configurar opciones
-			if opts.Domain == "" {
-				return fmt.Errorf("el dominio es obligatorio")
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Sin opciones de modificación se muestran los subcomandos disponibles
+			if len(opts.EnvVars) == 0 && !opts.Interactive && opts.File == "" {
+				return cmd.Help()
 			}
 
-			// Determinar si es un subdominio
-			domainParts := strings.Split(opts.Domain, ".")
-			var homeDir, user, appDir string
-			if len(domainParts) > 2 && domainParts[0] != "www" {
-				// Es un subdominio
-				parentDomain := strings.Join(domainParts[1:], ".")
-				user = strings.Split(parentDomain, ".")[0]
-				homeDir = filepath.Join("/home", parentDomain)
-				appDir = filepath.Join(homeDir, "apps", domainParts[0])
-			} else {
-				// No es subdominio
-				user = domainParts[0]
-				homeDir = filepath.Join("/home", opts.Domain)
-				appDir = filepath.Join(homeDir, "app")
+			if err := utils.ValidateDomain(opts.Domain); err != nil {
+				return err
 			}
-
-			// Verificar si el sitio existe
-			if !utils.PathExists(homeDir) {
-				return fmt.Errorf("el sitio %s no existe, primero crea el sitio con 'sm site'", opts.Domain)
+			// Evitar modificar el .env mientras otra operación modifica el sitio
+			lock, err := utils.AcquireSiteLock(opts.Domain, "env", opts.WaitLock)
+			if err != nil {
+				return err
 			}
-
-			// Verificar si la aplicación existe
-			if !utils.PathExists(appDir) {
-				return fmt.Errorf("la aplicación no existe en %s, primero despliega la aplicación con 'sm deploy'", appDir)
+			defer lock.Release()
+			app, err := resolveEnvApp(opts.Domain)
+			if err != nil {
+				return err
 			}
 
-			// Crear o actualizar archivo .env
-			if err := configureEnvFile(opts, appDir, user); err != nil {
+			// Crear o actualizar archivo .env, guardando sus versiones
+			recordEnvBefore(app.domain, app.envPath())
+			if err := configureEnvFile(opts, app.dir, app.user); err != nil {
 				return err
 			}
+			recordEnvSnapshot(app.domain, app.envPath(), utils.EnvSnapshot{Source: "env"})
 
 			fmt.Printf("Variables de entorno configuradas correctamente para %s\n", opts.Domain)
 			return nil
@@ -90,9 +86,10 @@ func AddEnvCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	envCmd.Flags().StringArrayVarP(&opts.EnvVars, "env", "e", []string{}, "Variables de entorno en formato KEY=VALUE")
 	envCmd.Flags().BoolVarP(&opts.Interactive, "interactive", "i", false, "Modo interactivo para configurar variables de entorno")
 	envCmd.Flags().StringVarP(&opts.File, "file", "f", "", "Archivo .env a importar")
+	envCmd.Flags().BoolVar(&opts.WaitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
 
-	// Marcar flags obligatorios
-	envCmd.MarkFlagRequired("domain")
+	// Agregar subcomandos
+	addEnvVarCommands(envCmd, cfg)
 
 	// Agregar comando al comando raíz
 	rootCmd.AddCommand(envCmd)
@@ -103,86 +100,38 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 	envFilePath := filepath.Join(appDir, ".env")
 	exampleEnvPath := filepath.Join(appDir, ".env.example")
 
-	// Variables de entorno actuales
-	envVars := make(map[string]string)
-
-	// Intentar leer archivo .env existente
-	if utils.PathExists(envFilePath) {
-		data, err := os.ReadFile(envFilePath)
-		if err == nil {
-			lines := strings.Split(string(data), "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					value := strings.TrimSpace(parts[1])
-					// Quitar comillas si existen
-					value = strings.Trim(value, "\"'")
-					envVars[key] = value
-				}
-			}
+	// Partir del .env actual o, si no existe, de .env.example
+	env := dotenv.New()
+	mode := utils.EnvFileMode
+	if info, err := os.Stat(envFilePath); err == nil {
+		mode = info.Mode().Perm()
+		if env, err = dotenv.Load(envFilePath); err != nil {
+			return fmt.Errorf("error al leer archivo .env: %v", err)
 		}
 	} else if utils.PathExists(exampleEnvPath) {
-		// Si no existe .env pero existe .env.example, leer de ahí
-		data, err := os.ReadFile(exampleEnvPath)
-		if err == nil {
-			lines := strings.Split(string(data), "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					value := strings.TrimSpace(parts[1])
-					// Quitar comillas si existen
-					value = strings.Trim(value, "\"'")
-					envVars[key] = value
-				}
-			}
+		if env, err = dotenv.Load(exampleEnvPath); err != nil {
+			return fmt.Errorf("error al leer archivo .env.example: %v", err)
 		}
 	}
 
 	// Si se especifica archivo a importar
 	if opts.File != "" {
-		data, err := os.ReadFile(opts.File)
+		source, err := dotenv.Load(opts.File)
 		if err != nil {
 			return fmt.Errorf("error al leer archivo %s: %v", opts.File, err)
 		}
-
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				// Quitar comillas si existen
-				value = strings.Trim(value, "\"'")
-				envVars[key] = value
-			}
+		for _, v := range source.Vars() {
+			env.SetVar(v)
 		}
 	}
 
 	// Agregar variables de entorno especificadas en la línea de comandos
-	for _, env := range opts.EnvVars {
-		parts := strings.SplitN(env, "=", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			envVars[key] = value
+	for _, assignment := range opts.EnvVars {
+		key, value, err := utils.ParseEnvAssignment(assignment)
+		if err != nil {
+			return err
 		}
+		env.Set(key, value)
 	}
 
 	// Modo interactivo
@@ -191,23 +140,8 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 
 		// Detectar si hay archivo .env.example para usar como base
 		var exampleVars []string
-		if utils.PathExists(exampleEnvPath) {
-			data, err := os.ReadFile(exampleEnvPath)
-			if err == nil {
-				lines := strings.Split(string(data), "\n")
-				for _, line := range lines {
-					line = strings.TrimSpace(line)
-					if line == "" || strings.HasPrefix(line, "#") {
-						continue
-					}
-
-					parts := strings.SplitN(line, "=", 2)
-					if len(parts) == 2 {
-						key := strings.TrimSpace(parts[0])
-						exampleVars = append(exampleVars, key)
-					}
-				}
-			}
+		if example, err := dotenv.Load(exampleEnvPath); err == nil {
+			exampleVars = example.Keys()
 		}
 
 		// Si no hay variables en .env.example, usar algunas variables comunes
@@ -226,10 +160,10 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 
 		// Preguntar por cada variable
 		for _, key := range exampleVars {
-			currentValue, exists := envVars[key]
+			currentValue, exists := env.Get(key)
 			var prompt string
 			if exists {
-				prompt = fmt.Sprintf("%s [%s]: ", key, currentValue)
+				prompt = fmt.Sprintf("%s [%s]: ", key, utils.MaskEnvValue(key, currentValue))
 			} else {
 				prompt = fmt.Sprintf("%s: ", key)
 			}
@@ -254,12 +188,12 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 					}
 					input = strings.TrimSpace(input)
 					if input != "" {
-						envVars[key] = input
+						env.Set(key, input)
 					}
 				} else {
 					input := string(bytePassword)
 					if input != "" {
-						envVars[key] = input
+						env.Set(key, input)
 					}
 				}
 			} else {
@@ -269,7 +203,7 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 				}
 				input = strings.TrimSpace(input)
 				if input != "" {
-					envVars[key] = input
+					env.Set(key, input)
 				}
 			}
 		}
@@ -293,31 +227,24 @@ func configureEnvFile(opts EnvOptions, appDir, user string) error {
 				if key == "" {
 					break
 				}
+				if err := utils.ValidateEnvKey(key); err != nil {
+					fmt.Println(utils.HandleError(err))
+					continue
+				}
 
 				fmt.Printf("%s: ", key)
 				value, err := reader.ReadString('\n')
 				if err != nil {
 					return fmt.Errorf("error al leer entrada: %v", err)
 				}
-				value = strings.TrimSpace(value)
-				envVars[key] = value
+				env.Set(key, strings.TrimSpace(value))
 			}
 		}
 	}
 
-	// Construir contenido del archivo .env
-	var envContent strings.Builder
-	for k, v := range envVars {
-		// Añadir comillas si el valor contiene espacios o caracteres especiales
-		if strings.ContainsAny(v, " #'\"\n\t") {
-			v = fmt.Sprintf("\"%s\"", v)
-		}
-		envContent.WriteString(fmt.Sprintf("%s=%s\n", k, v))
-	}
-
-	// Escribir archivo .env
-	if err := os.WriteFile(envFilePath, []byte(envContent.String()), 0644); err != nil {
-		return fmt.Errorf("error al escribir archivo .env: %v", err)
+	// Escribir archivo .env conservando el formato del original
+	if err := env.Write(envFilePath, mode); err != nil {
+		return err
 	}
 
 	// Cambiar propietario del archivo
@@ -0,0 +1,100 @@
+// internal/commands/env_check.go
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elmersh/sitemanager/internal/dotenv"
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// checkEnvFile compara el .env de una aplicación con su .env.example y con el esquema y las
+// variables requeridas del manifiesto. Si example es nil se lee .env.example. Devuelve nil si
+// la aplicación no declara con qué comparar.
+func checkEnvFile(appDir string, manifest *utils.ProjectManifest, example map[string]string, generated ...string) (*utils.EnvReport, error) {
+	if example == nil {
+		examplePath := filepath.Join(appDir, ".env.example")
+		file, err := dotenv.Load(examplePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error al leer %s: %v", examplePath, err)
+		}
+		if file != nil {
+			example = file.Map()
+		}
+	}
+
+	in := utils.EnvCheckInput{Example: example, Generated: generated, Values: map[string]string{}}
+	if manifest != nil {
+		in.Schema = manifest.Env.Schema
+		in.Required = manifest.Env.Required
+	}
+	if len(in.Example) == 0 && len(in.Schema) == 0 && len(in.Required) == 0 {
+		return nil, nil
+	}
+
+	envPath := filepath.Join(appDir, ".env")
+	env, err := dotenv.Load(envPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error al leer %s: %v", envPath, err)
+	}
+	if env != nil {
+		in.Values = env.Resolve()
+	}
+	return utils.CheckEnv(in), nil
+}
+
+// printEnvReport muestra los problemas del .env sin revelar sus valores
+func printEnvReport(report *utils.EnvReport) {
+	if len(report.Issues) == 0 {
+		fmt.Println("El archivo .env está completo")
+		return
+	}
+	for _, issue := range report.Issues {
+		level := "advertencia"
+		if issue.Blocking {
+			level = "error"
+		}
+		fmt.Printf("  [%s] %s\n", level, issue)
+	}
+}
+
+// verifyDeployEnv verifica el .env de la nueva release antes de construirla. Los problemas
+// solo detienen el despliegue en modo estricto (--strict o env.strict en el manifiesto).
+func verifyDeployEnv(opts *DeployOptions, example map[string]string, generated ...string) error {
+	report, err := checkEnvFile(opts.AppDir, opts.Manifest, example, generated...)
+	if err != nil || report == nil {
+		return err
+	}
+
+	fmt.Println("Verificando el archivo .env...")
+	printEnvReport(report)
+	blocking := len(report.Blocking())
+	if blocking == 0 {
+		return nil
+	}
+	if opts.StrictEnv || (opts.Manifest != nil && opts.Manifest.Env.Strict) {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("el archivo .env tiene %d error(es); corríjalos con 'sm env -d %s' y vuelva a desplegar", blocking, opts.Domain), nil)
+	}
+	fmt.Printf("Advertencia: el archivo .env tiene %d error(es); use --strict para detener el despliegue en estos casos\n", blocking)
+	return nil
+}
+
+// appManifest busca el manifiesto de una aplicación desplegada. En monorepos la aplicación
+// vive en un subdirectorio y el manifiesto está en la raíz de la release.
+func appManifest(appDir string) (*utils.ProjectManifest, error) {
+	dir := appDir
+	for {
+		manifest, err := utils.LoadProjectManifest(dir)
+		if err != nil || manifest != nil {
+			return manifest, err
+		}
+		parent := filepath.Dir(dir)
+		if filepath.Base(dir) == "current" || filepath.Base(parent) == "releases" || parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
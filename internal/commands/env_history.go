@@ -0,0 +1,239 @@
+// internal/commands/env_history.go
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/elmersh/sitemanager/internal/dotenv"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// envCommandFactory crea un subcomando de env con el flag de dominio y, si modifica el .env,
+// los de bloqueo y reinicio
+type envCommandFactory func(cmd *cobra.Command, modifies bool, run func(app *envApp, args []string) error) *cobra.Command
+
+// recordEnvSnapshot guarda una versión del .env indicado en el historial del sitio. Un error
+// al guardarla no detiene la operación que escribió el .env.
+func recordEnvSnapshot(domain, envPath string, snapshot utils.EnvSnapshot) *utils.EnvSnapshot {
+	data, err := os.ReadFile(envPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		var saved *utils.EnvSnapshot
+		if saved, err = utils.SaveEnvSnapshot(domain, data, snapshot); err == nil {
+			return saved
+		}
+	}
+	fmt.Printf("Advertencia: no se pudo guardar la versión del .env: %v\n", err)
+	return nil
+}
+
+// recordEnvBefore guarda el .env antes de que sm lo modifique, para conservar el estado
+// inicial y los cambios hechos a mano desde la última versión
+func recordEnvBefore(domain, envPath string) {
+	source := "cambios fuera de sm"
+	if history, err := utils.LoadEnvHistory(domain); err == nil && len(history) == 0 {
+		source = "estado inicial"
+	}
+	recordEnvSnapshot(domain, envPath, utils.EnvSnapshot{Source: source})
+}
+
+// addEnvHistoryCommands agrega los subcomandos history, diff y rollback al comando env
+func addEnvHistoryCommands(newEnvCommand envCommandFactory) {
+	var limit int
+	historyCmd := newEnvCommand(&cobra.Command{
+		Use:   "history",
+		Short: "Mostrar las versiones guardadas del .env",
+		Args:  cobra.NoArgs,
+	}, false, func(app *envApp, args []string) error {
+		history, err := utils.LoadEnvHistory(app.domain)
+		if err != nil {
+			return err
+		}
+		if len(history) == 0 {
+			fmt.Printf("No hay versiones guardadas del .env de %s\n", app.domain)
+			return nil
+		}
+		if limit > 0 && len(history) > limit {
+			history = history[:limit]
+		}
+
+		current, _ := os.ReadFile(app.envPath())
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSIÓN\tFECHA\tUSUARIO\tORIGEN\tDESPLIEGUE")
+		for _, s := range history {
+			version := strconv.Itoa(s.Version)
+			if current != nil && s.Matches(current) {
+				version += " *"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				version, s.CreatedAt.Format("2006-01-02 15:04:05"), s.User, s.Source, s.DeployID)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Println("* versión activa")
+		return nil
+	})
+	historyCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Cantidad máxima de versiones a mostrar (0 para todas)")
+
+	var showSecrets bool
+	diffCmd := newEnvCommand(&cobra.Command{
+		Use:   "diff <versión> [versión]",
+		Short: "Comparar dos versiones del .env (por defecto con el .env actual)",
+		Args:  cobra.RangeArgs(1, 2),
+	}, false, func(app *envApp, args []string) error {
+		from, fromLabel, err := loadEnvVersion(app, args[0])
+		if err != nil {
+			return err
+		}
+		target := "actual"
+		if len(args) == 2 {
+			target = args[1]
+		}
+		to, toLabel, err := loadEnvVersion(app, target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--- %s\n+++ %s\n", fromLabel, toLabel)
+		if !printEnvDiff(from, to, showSecrets) {
+			fmt.Println("Sin diferencias")
+		}
+		return nil
+	})
+	diffCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Mostrar también los valores secretos")
+
+	var deployID string
+	rollbackCmd := newEnvCommand(&cobra.Command{
+		Use:   "rollback [versión]",
+		Short: "Restaurar una versión anterior del .env",
+		Long: `Restaura una versión guardada del .env. Con --deploy se restaura la versión con la que
+se desplegó una release (vea 'sm deploy history').`,
+		Args: cobra.MaximumNArgs(1),
+	}, true, func(app *envApp, args []string) error {
+		version, err := rollbackVersion(app.domain, args, deployID)
+		if err != nil {
+			return err
+		}
+		_, data, err := utils.LoadEnvSnapshot(app.domain, version)
+		if err != nil {
+			return err
+		}
+		if _, err := dotenv.Parse(data); err != nil {
+			return fmt.Errorf("la versión %d del .env no es válida: %v", version, err)
+		}
+
+		mode := utils.EnvFileMode
+		if info, err := os.Stat(app.envPath()); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(app.envPath(), data, mode); err != nil {
+			return fmt.Errorf("error al escribir archivo .env: %v", err)
+		}
+		if err := chownEnvFile(app); err != nil {
+			return err
+		}
+		recordEnvSnapshot(app.domain, app.envPath(), utils.EnvSnapshot{Source: fmt.Sprintf("env rollback a la versión %d", version)})
+		fmt.Printf("Archivo .env de %s restaurado a la versión %d\n", app.domain, version)
+		return nil
+	})
+	rollbackCmd.Flags().StringVar(&deployID, "deploy", "", "Restaurar la versión del .env de un despliegue")
+}
+
+// rollbackVersion obtiene la versión a restaurar del argumento o del despliegue indicado
+func rollbackVersion(domain string, args []string, deployID string) (int, error) {
+	switch {
+	case deployID != "" && len(args) > 0:
+		return 0, utils.NewError(utils.ErrorValidacion, "indique una versión o --deploy, no ambos", nil)
+	case deployID != "":
+		record, err := utils.LoadDeployRecord(domain, deployID)
+		if err != nil {
+			return 0, err
+		}
+		if record.EnvVersion == 0 {
+			return 0, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("el despliegue %s no registró una versión del .env", deployID), nil)
+		}
+		return record.EnvVersion, nil
+	case len(args) == 0:
+		return 0, utils.NewError(utils.ErrorValidacion, "indique la versión a restaurar o --deploy", nil)
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil || version <= 0 {
+		return 0, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("versión inválida: %s", args[0]), nil)
+	}
+	return version, nil
+}
+
+// loadEnvVersion carga una versión guardada del .env o, con "actual", el archivo en uso
+func loadEnvVersion(app *envApp, arg string) (*dotenv.File, string, error) {
+	if arg == "actual" {
+		env, err := readAppEnv(app, false)
+		return env, "actual", err
+	}
+	version, err := strconv.Atoi(arg)
+	if err != nil || version <= 0 {
+		return nil, "", utils.NewError(utils.ErrorValidacion, fmt.Sprintf("versión inválida: %s (use un número o 'actual')", arg), nil)
+	}
+	snapshot, data, err := utils.LoadEnvSnapshot(app.domain, version)
+	if err != nil {
+		return nil, "", err
+	}
+	env, err := dotenv.Parse(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("la versión %d del .env no es válida: %v", version, err)
+	}
+	label := fmt.Sprintf("versión %d (%s, %s)", version, snapshot.CreatedAt.Format("2006-01-02 15:04:05"), snapshot.Source)
+	return env, label, nil
+}
+
+// printEnvDiff muestra las variables agregadas, eliminadas y modificadas entre dos versiones.
+// Devuelve false si no hay diferencias.
+func printEnvDiff(from, to *dotenv.File, showSecrets bool) bool {
+	mask := func(key, value string) string {
+		if showSecrets {
+			return value
+		}
+		return utils.MaskEnvValue(key, value)
+	}
+
+	changed := false
+	old := from.Map()
+	for _, v := range to.Vars() {
+		previous, ok := old[v.Key]
+		switch {
+		case !ok:
+			fmt.Printf("+ %s=%s\n", v.Key, mask(v.Key, v.Value))
+		case previous != v.Value:
+			fmt.Printf("~ %s: %s -> %s\n", v.Key, mask(v.Key, previous), mask(v.Key, v.Value))
+		default:
+			continue
+		}
+		changed = true
+	}
+	for _, v := range from.Vars() {
+		if !to.Has(v.Key) {
+			fmt.Printf("- %s=%s\n", v.Key, mask(v.Key, v.Value))
+			changed = true
+		}
+	}
+	return changed
+}
+
+// recordDeployEnv guarda la versión del .env con la que se construyó la release y la asocia
+// al registro del despliegue
+func recordDeployEnv(opts *DeployOptions) {
+	snapshot := utils.EnvSnapshot{Source: "deploy", Release: filepath.Base(opts.ReleaseDir)}
+	if opts.Recorder != nil {
+		snapshot.DeployID = opts.Recorder.Record.ID
+	}
+	saved := recordEnvSnapshot(opts.Domain, filepath.Join(opts.AppDir, ".env"), snapshot)
+	if saved != nil && opts.Recorder != nil {
+		opts.Recorder.Record.EnvVersion = saved.Version
+	}
+}
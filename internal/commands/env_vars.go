@@ -0,0 +1,425 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/dotenv"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// envApp es la aplicación desplegada de un sitio cuyo .env se gestiona
+type envApp struct {
+	domain string
+	user   string
+	// dir es la ruta estable de la aplicación activa
+	dir   string
+	state *utils.SiteState
+}
+
+// envPath devuelve el archivo .env de la aplicación
+func (a *envApp) envPath() string {
+	return filepath.Join(a.dir, ".env")
+}
+
+// resolveEnvApp ubica la aplicación desplegada de un sitio a partir de su estado o, en sitios
+// desplegados antes de registrarlo, dentro de apps/<dominio>
+func resolveEnvApp(domain string) (*envApp, error) {
+	state, err := utils.LoadSiteState(domain)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.AppDir != "" {
+		return &envApp{domain: domain, user: state.User, dir: state.AppDir, state: state}, nil
+	}
+
+	user, homeDir := siteOwner(domain)
+	dir, err := findCurrentAppDir(filepath.Join(homeDir, "apps", domain))
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("no hay una aplicación desplegada para %s; despliégala con 'sm deploy'", domain), err)
+	}
+	return &envApp{domain: domain, user: user, dir: dir, state: state}, nil
+}
+
+// siteOwner deriva el usuario y el directorio home de un sitio a partir de su dominio; los
+// subdominios pertenecen al sitio de su dominio padre
+func siteOwner(domain string) (string, string) {
+	domainParts := strings.Split(domain, ".")
+	if len(domainParts) > 2 && domainParts[0] != "www" {
+		parentDomain := strings.Join(domainParts[1:], ".")
+		return domainParts[1], filepath.Join("/home", parentDomain)
+	}
+	return domainParts[0], filepath.Join("/home", domain)
+}
+
+// addEnvVarCommands agrega los subcomandos get, set, unset, list, import, export, edit y check al
+// comando env, además de los del historial de versiones
+func addEnvVarCommands(envCmd *cobra.Command, cfg *config.Config) {
+	// newEnvCommand crea un subcomando con el flag de dominio y, si modifica el .env, los de bloqueo y reinicio
+	var newEnvCommand envCommandFactory = func(cmd *cobra.Command, modifies bool, run func(app *envApp, args []string) error) *cobra.Command {
+		var domain string
+		var restart, waitLock bool
+		cmd.RunE = func(c *cobra.Command, args []string) error {
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+			if modifies {
+				// Evitar modificar el .env mientras otra operación modifica el sitio
+				lock, err := utils.AcquireSiteLock(domain, "env "+c.Name(), waitLock)
+				if err != nil {
+					return err
+				}
+				defer lock.Release()
+			}
+			app, err := resolveEnvApp(domain)
+			if err != nil {
+				return err
+			}
+			if modifies {
+				recordEnvBefore(app.domain, app.envPath())
+			}
+			if err := run(app, args); err != nil {
+				return err
+			}
+			if modifies {
+				recordEnvSnapshot(app.domain, app.envPath(), utils.EnvSnapshot{Source: "env " + c.Name()})
+			}
+			if modifies && restart {
+				return applyEnvChanges(app, cfg)
+			}
+			if modifies {
+				fmt.Println("Los cambios se aplicarán al reiniciar la aplicación (use --restart para hacerlo ahora)")
+			}
+			return nil
+		}
+		cmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+		cmd.MarkFlagRequired("domain")
+		if modifies {
+			cmd.Flags().BoolVar(&restart, "restart", false, "Reiniciar la aplicación y regenerar la caché de configuración de Laravel")
+			cmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+		}
+		envCmd.AddCommand(cmd)
+		return cmd
+	}
+
+	newEnvCommand(&cobra.Command{
+		Use:   "get <CLAVE>",
+		Short: "Mostrar el valor de una variable",
+		Args:  cobra.ExactArgs(1),
+	}, false, func(app *envApp, args []string) error {
+		env, err := readAppEnv(app, false)
+		if err != nil {
+			return err
+		}
+		if value, ok := env.Get(args[0]); ok {
+			fmt.Println(value)
+			return nil
+		}
+		return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("%s no está definida en %s", args[0], app.envPath()), nil)
+	})
+
+	newEnvCommand(&cobra.Command{
+		Use:   "set <CLAVE=valor>...",
+		Short: "Definir variables",
+		Args:  cobra.MinimumNArgs(1),
+	}, true, func(app *envApp, args []string) error {
+		env, err := readAppEnv(app, true)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(args))
+		for _, arg := range args {
+			key, value, err := utils.ParseEnvAssignment(arg)
+			if err != nil {
+				return err
+			}
+			env.Set(key, value)
+			keys = append(keys, key)
+		}
+		if err := writeAppEnv(app, env); err != nil {
+			return err
+		}
+		fmt.Printf("%d variable(s) definida(s) en %s\n", len(args), app.envPath())
+		warnSecretOverride(app.domain, keys)
+		return nil
+	})
+
+	newEnvCommand(&cobra.Command{
+		Use:   "unset <CLAVE>...",
+		Short: "Eliminar variables",
+		Args:  cobra.MinimumNArgs(1),
+	}, true, func(app *envApp, args []string) error {
+		env, err := readAppEnv(app, false)
+		if err != nil {
+			return err
+		}
+		for _, key := range args {
+			if !env.Unset(key) {
+				return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("%s no está definida en %s", key, app.envPath()), nil)
+			}
+		}
+		if err := writeAppEnv(app, env); err != nil {
+			return err
+		}
+		fmt.Printf("%d variable(s) eliminada(s) de %s\n", len(args), app.envPath())
+		return nil
+	})
+
+	var showSecrets bool
+	listCmd := newEnvCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Listar las variables (los valores secretos se ocultan)",
+		Args:  cobra.NoArgs,
+	}, false, func(app *envApp, args []string) error {
+		env, err := readAppEnv(app, false)
+		if err != nil {
+			return err
+		}
+		for _, v := range env.Vars() {
+			value := v.Value
+			if !showSecrets {
+				value = utils.MaskEnvValue(v.Key, value)
+			}
+			fmt.Printf("%s=%s\n", v.Key, value)
+		}
+		return nil
+	})
+	listCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Mostrar también los valores secretos")
+
+	newEnvCommand(&cobra.Command{
+		Use:   "import <archivo>",
+		Short: "Definir las variables de un archivo .env",
+		Long:  `Define en el .env de la aplicación las variables de otro archivo. Las variables que no aparecen en él se conservan.`,
+		Args:  cobra.ExactArgs(1),
+	}, true, func(app *envApp, args []string) error {
+		source, err := dotenv.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("error al leer archivo %s: %v", args[0], err)
+		}
+		env, err := readAppEnv(app, true)
+		if err != nil {
+			return err
+		}
+		vars := source.Vars()
+		for _, v := range vars {
+			env.SetVar(v)
+		}
+		if err := writeAppEnv(app, env); err != nil {
+			return err
+		}
+		fmt.Printf("%d variable(s) importada(s) en %s\n", len(vars), app.envPath())
+		return nil
+	})
+
+	var output string
+	exportCmd := newEnvCommand(&cobra.Command{
+		Use:   "export",
+		Short: "Exportar el archivo .env",
+		Args:  cobra.NoArgs,
+	}, false, func(app *envApp, args []string) error {
+		data, err := os.ReadFile(app.envPath())
+		if err != nil {
+			return fmt.Errorf("error al leer %s: %v", app.envPath(), err)
+		}
+		if output == "" {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		// El archivo exportado contiene secretos: solo lo lee su propietario
+		if err := os.WriteFile(output, data, 0600); err != nil {
+			return fmt.Errorf("error al escribir %s: %v", output, err)
+		}
+		fmt.Printf("Variables de %s exportadas a %s\n", app.domain, output)
+		return nil
+	})
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "Archivo de destino (por defecto, la salida estándar)")
+
+	newEnvCommand(&cobra.Command{
+		Use:   "edit",
+		Short: "Editar el archivo .env con $EDITOR",
+		Args:  cobra.NoArgs,
+	}, true, editAppEnv)
+
+	var strict bool
+	checkCmd := newEnvCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Comparar el .env con .env.example y el esquema del manifiesto",
+		Long: `Compara el .env de la aplicación con su .env.example y con env.schema y env.required de
+` + utils.ManifestFileName + `. Informa las variables que faltan, están vacías, conservan un valor
+de ejemplo o no cumplen su tipo, y las que no declara ninguna de esas fuentes.`,
+		Args: cobra.NoArgs,
+	}, false, func(app *envApp, args []string) error {
+		manifest, err := appManifest(app.dir)
+		if err != nil {
+			return err
+		}
+		report, err := checkEnvFile(app.dir, manifest, nil)
+		if err != nil {
+			return err
+		}
+		if report == nil {
+			fmt.Printf("La aplicación de %s no tiene .env.example ni un esquema en %s con el cual comparar\n", app.domain, utils.ManifestFileName)
+			return nil
+		}
+		printEnvReport(report)
+		if blocking := len(report.Blocking()); blocking > 0 && strict {
+			return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("el archivo .env tiene %d error(es)", blocking), nil)
+		}
+		return nil
+	})
+	checkCmd.Flags().BoolVar(&strict, "strict", false, "Terminar con error si hay variables faltantes, vacías requeridas o con valores de ejemplo")
+
+	addEnvHistoryCommands(newEnvCommand)
+}
+
+// readAppEnv lee el .env de la aplicación. Si no existe y create es true se parte de un archivo vacío.
+func readAppEnv(app *envApp, create bool) (*dotenv.File, error) {
+	env, err := dotenv.Load(app.envPath())
+	if os.IsNotExist(err) {
+		if create {
+			return dotenv.New(), nil
+		}
+		return nil, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("la aplicación de %s no tiene archivo .env", app.domain), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", app.envPath(), err)
+	}
+	return env, nil
+}
+
+// writeAppEnv guarda el .env de la aplicación conservando sus permisos y su propietario
+func writeAppEnv(app *envApp, env *dotenv.File) error {
+	mode := utils.EnvFileMode
+	if info, err := os.Stat(app.envPath()); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := env.Write(app.envPath(), mode); err != nil {
+		return err
+	}
+	return chownEnvFile(app)
+}
+
+// chownEnvFile devuelve el .env al usuario del sitio
+func chownEnvFile(app *envApp) error {
+	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", app.user, app.user), app.envPath())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario del archivo .env: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// editAppEnv abre una copia del .env en el editor y la guarda si cambió. Si la aplicación aún no
+// tiene .env se parte de .env.example.
+func editAppEnv(app *envApp, args []string) error {
+	current, err := os.ReadFile(app.envPath())
+	if os.IsNotExist(err) {
+		current, _ = os.ReadFile(filepath.Join(app.dir, ".env.example"))
+	} else if err != nil {
+		return fmt.Errorf("error al leer %s: %v", app.envPath(), err)
+	}
+
+	tmp, err := os.CreateTemp("", "sm-env-*.env")
+	if err != nil {
+		return fmt.Errorf("error al crear archivo temporal: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(current); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error al escribir archivo temporal: %v", err)
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "nano"
+		if _, err := exec.LookPath(editor); err != nil {
+			editor = "vi"
+		}
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "editor", tmp.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al ejecutar el editor %s: %v", editor, err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("error al leer archivo temporal: %v", err)
+	}
+	if bytes.Equal(edited, current) && utils.PathExists(app.envPath()) {
+		fmt.Println("El archivo .env no cambió")
+		return nil
+	}
+	if _, err := dotenv.Parse(edited); err != nil {
+		return utils.NewError(utils.ErrorValidacion, "el archivo editado no es un .env válido; no se guardaron los cambios", err)
+	}
+
+	mode := utils.EnvFileMode
+	if info, err := os.Stat(app.envPath()); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(app.envPath(), edited, mode); err != nil {
+		return fmt.Errorf("error al escribir archivo .env: %v", err)
+	}
+	if err := chownEnvFile(app); err != nil {
+		return err
+	}
+	fmt.Printf("Archivo %s guardado\n", app.envPath())
+	return nil
+}
+
+// applyEnvChanges aplica el .env modificado: Laravel regenera su caché de configuración y
+// recarga PHP-FPM u Octane; las aplicaciones Node.js se reinician
+func applyEnvChanges(app *envApp, cfg *config.Config) error {
+	state := app.state
+	if state == nil {
+		fmt.Println("No hay estado registrado del sitio; reinicie la aplicación manualmente")
+		return nil
+	}
+	if state.Type == "static" {
+		fmt.Println("El sitio sirve un build estático: vuelva a desplegarlo para aplicar las variables")
+		return nil
+	}
+
+	if state.Type == "laravel" {
+		php := utils.PHPBinary(state.PHPVersion)
+		cache := exec.Command("su", "-c", php+" artisan config:cache", app.user)
+		cache.Dir = app.dir
+		if output, err := cache.CombinedOutput(); err != nil {
+			return fmt.Errorf("error al regenerar la caché de configuración: %v\n%s", err, output)
+		}
+		fmt.Println("Caché de configuración de Laravel regenerada")
+		if len(state.Queue.Workers) > 0 {
+			restart := exec.Command("su", "-c", php+" artisan queue:restart", app.user)
+			restart.Dir = app.dir
+			if output, err := restart.CombinedOutput(); err != nil {
+				fmt.Printf("Advertencia: no se pudo ejecutar queue:restart: %v\n%s\n", err, output)
+			}
+		}
+	}
+
+	site, err := loadSiteApp(app.domain, cfg)
+	if err != nil {
+		return err
+	}
+	// Node.js lee el .env al iniciar; PHP-FPM y Octane cargan la nueva caché al recargarse
+	action, done := site.manager.Reload, "recargada"
+	if state.Type == "nodejs" {
+		action, done = site.manager.Restart, "reiniciada"
+	}
+	if err := action(site.process); err != nil {
+		return err
+	}
+	fmt.Printf("Aplicación %s %s (%s)\n", app.domain, done, site.manager.Name())
+	return nil
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// laravelPHP devuelve el binario de PHP de la versión registrada para el sitio
+func laravelPHP(opts *DeployOptions) string {
+	version := ""
+	if opts.PreviousState != nil {
+		version = opts.PreviousState.PHPVersion
+	}
+	return utils.PHPBinary(version)
+}
+
+// buildLaravelAssets instala las dependencias de Node.js y compila los assets del frontend como
+// el usuario del sitio, con la versión de Node.js que pide el proyecto
+func buildLaravelAssets(opts *DeployOptions) error {
+	assets, err := utils.DetectLaravelAssets(opts.AppDir)
+	if err != nil {
+		return err
+	}
+	if assets == nil {
+		return nil
+	}
+	fmt.Printf("Compilando assets del frontend con %s (%s)...\n", assets.Bundler, assets.PackageManager)
+
+	if err := resolveNodeVersion(opts); err != nil {
+		return err
+	}
+	if err := installNodeDependencies(opts, assets.PackageManager); err != nil {
+		return err
+	}
+	if err := runNodeCommand(opts, assets.PackageManager.Run(assets.Script)); err != nil {
+		return fmt.Errorf("error al compilar los assets: %v", err)
+	}
+
+	// La directiva @vite necesita el manifiesto que genera el build
+	if assets.Bundler == utils.AssetBundlerVite && !utils.PathExists(filepath.Join(opts.AppDir, "public", "build", "manifest.json")) {
+		fmt.Println("Advertencia: el build no generó public/build/manifest.json; @vite no encontrará los assets")
+	}
+	return nil
+}
+
+// prepareOctane verifica que la release pueda ejecutarse con Octane y define el comando del
+// proceso. Los binarios de RoadRunner y FrankenPHP se reutilizan de la release anterior para
+// no descargarlos en cada despliegue.
+func prepareOctane(opts *DeployOptions) error {
+	octane := opts.Octane
+	php := laravelPHP(opts)
+	fmt.Printf("Laravel Octane con %s\n", octane.Server)
+
+	if !utils.PathExists(filepath.Join(opts.AppDir, "vendor", "laravel", "octane")) {
+		return utils.NewError(utils.ErrorValidacion,
+			"el proyecto no incluye laravel/octane; agréguelo con 'composer require laravel/octane'", nil)
+	}
+	if octane.Server == utils.OctaneServerSwoole {
+		if err := utils.CheckSwooleExtension(php); err != nil {
+			return err
+		}
+	}
+
+	if binary := octane.Binary(); binary != "" {
+		dst := filepath.Join(opts.AppDir, binary)
+		src := filepath.Join(liveAppDir(opts), binary)
+		if !utils.PathExists(dst) && utils.PathExists(src) {
+			if output, err := exec.Command("cp", "-a", src, dst).CombinedOutput(); err != nil {
+				fmt.Printf("Advertencia: no se pudo copiar %s de la release anterior: %v\n%s\n", binary, err, output)
+			}
+		}
+		if !utils.PathExists(dst) {
+			fmt.Printf("Octane descargará el binario %s al iniciar por primera vez\n", binary)
+		}
+	}
+
+	// Octane administra sus propios workers
+	if opts.Tuning.Cluster() {
+		return utils.NewError(utils.ErrorValidacion,
+			"el modo cluster no está disponible con Octane; use 'octane.workers' en "+utils.ManifestFileName, nil)
+	}
+	if opts.Tuning.MaxMemory == "" {
+		opts.Tuning.MaxMemory = utils.DefaultOctaneMaxMemory
+	}
+
+	opts.Port = appPort(opts)
+	opts.StartCommand = octane.Command(php, opts.Port)
+	return nil
+}
+
+// startOctane inicia (o recarga) el servidor de Octane y apunta Nginx a su puerto
+func startOctane(opts *DeployOptions) error {
+	if err := startAppProcess(opts); err != nil {
+		return err
+	}
+	return ensureOctaneProxy(opts)
+}
+
+// stopOctane vuelve a PHP-FPM cuando el despliegue anterior se ejecutaba con Octane: regenera
+// la configuración de Nginx con la plantilla de Laravel y elimina el proceso anterior
+func stopOctane(opts *DeployOptions) error {
+	prev := opts.PreviousState
+	if prev == nil || prev.Type != "laravel" || !prev.RunsProcess() {
+		return nil
+	}
+
+	if conf, err := os.ReadFile(siteNginxConfPath(opts)); err == nil && !strings.Contains(string(conf), "fastcgi_pass") {
+		if err := renderSiteNginx(opts, "laravel", false); err != nil {
+			return err
+		}
+	}
+
+	pm, err := utils.NewProcessManager(prev.ProcessManager)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deteniendo Octane en %s: la aplicación vuelve a PHP-FPM\n", pm.Name())
+	if err := pm.Remove(prev.AppProcess()); err != nil {
+		fmt.Printf("Advertencia: no se pudo eliminar el proceso anterior: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// internal/commands/nginx.go
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// Rutas del certificado y proxy de la aplicación en una configuración de Nginx existente
+var (
+	sslCertificatePattern    = regexp.MustCompile(`(?m)^\s*ssl_certificate\s+([^;\s]+);`)
+	sslCertificateKeyPattern = regexp.MustCompile(`(?m)^\s*ssl_certificate_key\s+([^;\s]+);`)
+	proxyPassPattern         = regexp.MustCompile(`proxy_pass http://localhost:[0-9]*`)
+	proxyPortPattern         = regexp.MustCompile(`proxy_pass http://localhost:([0-9]+)`)
+	fastcgiSocketPattern     = regexp.MustCompile(`fastcgi_pass unix:([^;\s]+);`)
+	maxBodySizePattern       = regexp.MustCompile(`client_max_body_size\s+([^;\s]+);`)
+	nextStaticPattern        = regexp.MustCompile(`location /_next/static/ \{\s*alias ([^;\s]+)/;`)
+)
+
+// nginxTemplate devuelve el contenido de la plantilla de Nginx para un tipo de sitio. Las
+// plantillas de /etc/nginx/templates tienen prioridad sobre las internas.
+func nginxTemplate(cfg *config.Config, siteType string, isSubdomain bool) (string, error) {
+	tmplPath := cfg.Templates[siteType]
+	if isSubdomain {
+		if path, ok := cfg.SubdomainTemplates[siteType]; ok {
+			tmplPath = path
+		}
+	}
+	if tmplPath == "" {
+		return "", fmt.Errorf("no se encontró una plantilla para el tipo de sitio: %s", siteType)
+	}
+
+	systemTmplPath := filepath.Join("/etc/nginx/templates", tmplPath)
+	if data, err := os.ReadFile(systemTmplPath); err == nil {
+		fmt.Printf("Usando plantilla del sistema: %s\n", systemTmplPath)
+		return string(data), nil
+	}
+	return utils.ReadTemplateFile(tmplPath)
+}
+
+// siteNginxConfPath devuelve el archivo de configuración de Nginx del sitio desplegado
+func siteNginxConfPath(opts *DeployOptions) string {
+	if opts.Config != nil {
+		link := filepath.Join(opts.Config.SitesAvailable, fmt.Sprintf("%s.conf", opts.Domain))
+		if target, err := filepath.EvalSymlinks(link); err == nil {
+			return target
+		}
+	}
+	return filepath.Join(opts.HomeDir, "nginx", fmt.Sprintf("%s.conf", opts.Domain))
+}
+
+// sitePublicDir devuelve la ruta pública que enlaza linkPublicDir
+func sitePublicDir(opts *DeployOptions) string {
+	if opts.IsSubdomain {
+		return filepath.Join(opts.HomeDir, "public_html", opts.Domain)
+	}
+	return filepath.Join(opts.HomeDir, "public_html")
+}
+
+// updateNginxProxyPort apunta el proxy de la configuración de Nginx al puerto de la aplicación.
+// Si la configuración no tiene proxy (sitio estático o Laravel), se genera al iniciar la aplicación.
+func updateNginxProxyPort(opts *DeployOptions) error {
+	confPath := siteNginxConfPath(opts)
+	confData, err := os.ReadFile(confPath)
+	if os.IsNotExist(err) {
+		fmt.Printf("No se encontró archivo de configuración Nginx en %s\n", confPath)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error al leer configuración Nginx: %v", err)
+	}
+
+	if !proxyPassPattern.Match(confData) {
+		fmt.Println("La configuración de Nginx no tiene proxy; se generará al iniciar la aplicación")
+		return nil
+	}
+
+	newConf := proxyPassPattern.ReplaceAll(confData, []byte(fmt.Sprintf("proxy_pass http://localhost:%d", opts.Port)))
+	if bytes.Equal(newConf, confData) {
+		return nil
+	}
+	if opts.NginxBackup == nil {
+		opts.NginxBackup = confData
+	}
+	if err := writeNginxConf(confPath, newConf, confData); err != nil {
+		return err
+	}
+	exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), confPath).Run()
+
+	fmt.Printf("Configuración de Nginx actualizada para usar el puerto %d\n", opts.Port)
+	return nil
+}
+
+// ensureNodeProxy genera la configuración de proxy de Nginx si el sitio aún no la tiene o si
+// falta servir desde el disco los archivos estáticos de Next.js standalone
+func ensureNodeProxy(opts *DeployOptions) error {
+	confData, err := os.ReadFile(siteNginxConfPath(opts))
+	if err != nil {
+		return nil
+	}
+	if proxyPassPattern.Match(confData) && (!opts.NextStandalone || nextStaticPattern.Match(confData)) {
+		return nil
+	}
+	return renderSiteNginx(opts, "nodejs", false)
+}
+
+// ensureOctaneProxy genera la configuración de proxy hacia Octane si el sitio aún usa PHP-FPM
+// o, si ya la tiene, la apunta al puerto del proceso
+func ensureOctaneProxy(opts *DeployOptions) error {
+	confData, err := os.ReadFile(siteNginxConfPath(opts))
+	if err != nil {
+		return nil
+	}
+	if strings.Contains(string(confData), "location @octane") {
+		return updateNginxProxyPort(opts)
+	}
+	return renderSiteNginx(opts, "octane", false)
+}
+
+// nextStaticDir devuelve el directorio de archivos estáticos de Next.js de la ruta estable
+func nextStaticDir(opts *DeployOptions) string {
+	return filepath.Join(liveAppDir(opts), ".next", "static")
+}
+
+// renderSiteNginx regenera la configuración de Nginx del sitio con la plantilla de siteType
+// (static, nodejs, laravel u octane), conservando HTTPS si el sitio ya tiene certificado. La configuración
+// anterior se guarda para restaurarla si el despliegue se revierte.
+func renderSiteNginx(opts *DeployOptions, siteType string, spa bool) error {
+	if opts.Config == nil {
+		return fmt.Errorf("no se cargó la configuración de sitemanager")
+	}
+
+	confPath := siteNginxConfPath(opts)
+	current, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("error al leer configuración Nginx: %v", err)
+	}
+
+	// Las plantillas de subdominio ya agregan el dominio a la raíz de Node.js
+	rootDir := filepath.Join(opts.HomeDir, "public_html")
+	if siteType == "static" {
+		rootDir = sitePublicDir(opts)
+	}
+	data := map[string]interface{}{
+		"Domain":   opts.Domain,
+		"RootDir":  rootDir,
+		"PHP":      sitePHPVersion(opts),
+		"Port":     opts.Port,
+		"User":     opts.User,
+		"HomeDir":  opts.HomeDir,
+		"NginxDir": filepath.Dir(confPath),
+		"SPA":      spa,
+	}
+	if prev := opts.PreviousState; prev != nil {
+		if pool, ok := prev.PHPFPMPool(); ok {
+			data["PHPSocket"] = pool.Socket()
+		}
+	}
+	// Conservar el límite de subida sincronizado con el php.ini del sitio
+	if match := maxBodySizePattern.FindSubmatch(current); match != nil {
+		data["MaxBodySize"] = string(match[1])
+	}
+	if siteType == "nodejs" && opts.NextStandalone {
+		data["NextStatic"] = nextStaticDir(opts)
+	}
+
+	var tmplContent string
+	cert := sslCertificatePattern.FindSubmatch(current)
+	key := sslCertificateKeyPattern.FindSubmatch(current)
+	if cert != nil && key != nil {
+		tmplContent, err = utils.ReadTemplateFile("ssl/ssl.conf.tmpl")
+		data["CertPath"] = string(cert[1])
+		data["KeyPath"] = string(key[1])
+		data["SiteType"] = siteType
+		data["RedirectHTTP"] = true
+	} else {
+		tmplContent, err = nginxTemplate(opts.Config, siteType, opts.IsSubdomain)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("nginx").Parse(tmplContent)
+	if err != nil {
+		return fmt.Errorf("error al parsear plantilla: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error al ejecutar plantilla: %v", err)
+	}
+
+	// Las plantillas escriben los logs en HomeDir/logs
+	if err := os.MkdirAll(filepath.Join(opts.HomeDir, "logs"), 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	}
+
+	if opts.NginxBackup == nil {
+		opts.NginxBackup = current
+	}
+	if err := writeNginxConf(confPath, buf.Bytes(), current); err != nil {
+		return err
+	}
+	exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), confPath).Run()
+
+	fmt.Printf("Configuración de Nginx de %s regenerada con la plantilla %s\n", opts.Domain, siteType)
+	return nil
+}
+
+// sitePHPVersion devuelve la versión de PHP-FPM registrada para el sitio o la predeterminada
+func sitePHPVersion(opts *DeployOptions) string {
+	if opts.PreviousState != nil && opts.PreviousState.PHPVersion != "" {
+		return opts.PreviousState.PHPVersion
+	}
+	return opts.Config.DefaultPHP
+}
+
+// writeNginxConf escribe una configuración de Nginx, la valida y recarga Nginx. Si la
+// validación falla se restaura el contenido anterior.
+func writeNginxConf(confPath string, content, previous []byte) error {
+	if err := os.WriteFile(confPath, content, 0644); err != nil {
+		return fmt.Errorf("error al escribir configuración Nginx: %v", err)
+	}
+
+	if output, err := exec.Command("nginx", "-t").CombinedOutput(); err != nil {
+		os.WriteFile(confPath, previous, 0644)
+		return fmt.Errorf("la nueva configuración de Nginx no es válida: %v\n%s", err, strings.TrimSpace(string(output)))
+	}
+	return reloadNginx()
+}
+
+// restoreSiteNginx vuelve a la configuración de Nginx anterior al despliegue
+func restoreSiteNginx(opts *DeployOptions) error {
+	if opts.NginxBackup == nil {
+		return nil
+	}
+	fmt.Println("Restaurando la configuración de Nginx anterior...")
+	confPath := siteNginxConfPath(opts)
+	current, _ := os.ReadFile(confPath)
+	return writeNginxConf(confPath, opts.NginxBackup, current)
+}
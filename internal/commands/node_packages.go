@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// runNodeCommand ejecuta un comando como el usuario del sitio en el directorio de la aplicación
+// con la versión de Node.js del sitio, registrando la salida en el historial del despliegue
+func runNodeCommand(opts *DeployOptions, command string) error {
+	cmd := exec.Command("su", "-c", nodeShell(opts, command), opts.User)
+	cmd.Dir = opts.AppDir
+	// Evitar que corepack pida confirmación para descargar pnpm o yarn
+	cmd.Env = append(os.Environ(), "COREPACK_ENABLE_DOWNLOAD_PROMPT=0")
+	fmt.Printf("Ejecutando: %s\n", command)
+	output, err := cmd.CombinedOutput()
+	opts.Recorder.LogCommand(command, output)
+	if len(output) > 0 {
+		fmt.Printf("Salida: %s\n", output)
+	}
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, output)
+	}
+	return nil
+}
+
+// ensurePackageManager verifica que el gestor de paquetes del proyecto esté disponible,
+// habilitándolo con corepack cuando es pnpm o yarn
+func ensurePackageManager(opts *DeployOptions, pm utils.PackageManager) error {
+	if pm.Name == utils.PackageManagerNPM {
+		return nil
+	}
+
+	if pm.UsesCorepack() {
+		// corepack crea el acceso junto al node en uso, por lo que se ejecuta como root
+		cmd := exec.Command("sh", "-c", nodeShell(opts, "corepack enable "+pm.Name))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			fmt.Printf("Advertencia: no se pudo habilitar %s con corepack: %v\n%s\n", pm.Name, err, output)
+		}
+	}
+
+	check := exec.Command("su", "-c", nodeShell(opts, "command -v "+pm.Name), opts.User)
+	if err := check.Run(); err != nil {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("%s no está disponible para el usuario %s; instálelo o use una versión de Node.js que incluya corepack", pm.Name, opts.User), err)
+	}
+	return nil
+}
+
+// installNodeDependencies instala las dependencias respetando el archivo de bloqueo.
+// Si la instalación falla solo se reintenta sin respetarlo con --allow-lockfile-drift.
+func installNodeDependencies(opts *DeployOptions, pm utils.PackageManager) error {
+	if err := ensurePackageManager(opts, pm); err != nil {
+		return err
+	}
+
+	if pm.Lockfile == "" {
+		fmt.Println("Advertencia: el proyecto no tiene archivo de bloqueo; las versiones de las dependencias pueden variar entre despliegues")
+		if err := runNodeCommand(opts, pm.InstallCommand(false)); err != nil {
+			return fmt.Errorf("error al instalar dependencias: %v", err)
+		}
+		return nil
+	}
+
+	frozen := pm.InstallCommand(true)
+	err := runNodeCommand(opts, frozen)
+	if err == nil {
+		return nil
+	}
+	if !opts.AllowLockfileDrift {
+		return utils.NewError(utils.ErrorComando,
+			fmt.Sprintf("'%s' falló; si %s no coincide con package.json, actualícelo en el repositorio o despliegue con --allow-lockfile-drift", frozen, pm.Lockfile), err)
+	}
+
+	fmt.Printf("Advertencia: instalando dependencias sin respetar %s (--allow-lockfile-drift)\n", pm.Lockfile)
+	attempts := []string{pm.InstallCommand(false)}
+	if pm.Name == utils.PackageManagerNPM {
+		attempts = append(attempts, "npm install --legacy-peer-deps", "npm install --force")
+	}
+	for _, attempt := range attempts {
+		if err = runNodeCommand(opts, attempt); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("error al instalar dependencias: %v", err)
+}
+
+// setupPrisma genera el cliente de Prisma y aplica las migraciones pendientes
+func setupPrisma(opts *DeployOptions, pm utils.PackageManager) error {
+	fmt.Println("Proyecto con Prisma detectado, ejecutando migraciones...")
+
+	// Verificar si PostgreSQL está disponible antes de ejecutar comandos de Prisma
+	pgCheckCmd := exec.Command("sudo", "-u", "postgres", "pg_isready")
+	if pgOutput, pgErr := pgCheckCmd.CombinedOutput(); pgErr != nil {
+		fmt.Printf("Advertencia: PostgreSQL no está disponible: %v\n%s\n", pgErr, pgOutput)
+		fmt.Println("Se omitirán las operaciones de Prisma. Por favor, configure PostgreSQL manualmente y ejecute las migraciones después.")
+		return nil
+	}
+	if missing, err := utils.MissingEnvKeys(filepath.Join(opts.AppDir, ".env"), []string{"DATABASE_URL"}); err == nil && len(missing) > 0 {
+		// Sin DATABASE_URL no se pueden ejecutar las operaciones de Prisma, pero el despliegue continúa
+		fmt.Println("No se encontró DATABASE_URL en el archivo .env. Se omitirán las operaciones de Prisma.")
+		return nil
+	}
+
+	if err := runNodeCommand(opts, pm.Exec("prisma generate")); err != nil {
+		fmt.Printf("Advertencia: error al ejecutar prisma generate: %v\n", err)
+	}
+
+	// Verificar si existen migraciones antes de intentar ejecutarlas
+	if _, err := os.Stat(filepath.Join(opts.AppDir, "prisma", "migrations")); err != nil {
+		fmt.Println("No se encontraron migraciones de Prisma. Omitiendo prisma migrate deploy.")
+		return nil
+	}
+
+	if err := runNodeCommand(opts, pm.Exec("prisma migrate deploy")); err != nil {
+		fmt.Printf("Advertencia: error en migraciones de Prisma (no crítico): %v\n", err)
+	} else {
+		fmt.Println("Migraciones de Prisma completadas")
+	}
+	return nil
+}
+
+// prepareNextStandalone completa la salida standalone de Next.js con los archivos que el build
+// no copia (.next/static y public) y con el .env de la release. El servidor standalone incluye
+// las dependencias que usa, por lo que se elimina el node_modules completo de la release.
+func prepareNextStandalone(opts *DeployOptions) error {
+	standalone := filepath.Join(opts.AppDir, ".next", "standalone")
+	if _, err := os.Stat(filepath.Join(opts.AppDir, utils.NextStandaloneServer)); err != nil {
+		return fmt.Errorf("el build no generó %s; verifique output: 'standalone' en next.config", utils.NextStandaloneServer)
+	}
+	fmt.Println("Preparando el servidor standalone de Next.js...")
+
+	for _, dir := range []string{filepath.Join(".next", "static"), "public"} {
+		src := filepath.Join(opts.AppDir, dir)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := filepath.Join(standalone, dir)
+		if err := os.RemoveAll(dst); err != nil {
+			return fmt.Errorf("error al limpiar %s: %v", dst, err)
+		}
+		// cp -a conserva el propietario y los permisos de los archivos del sitio
+		if output, err := exec.Command("cp", "-a", src, dst).CombinedOutput(); err != nil {
+			return fmt.Errorf("error al copiar %s al servidor standalone: %v\n%s", dir, err, output)
+		}
+	}
+
+	// El servidor carga el .env de su propio directorio
+	envLink := filepath.Join(standalone, ".env")
+	if _, err := os.Lstat(envLink); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join("..", "..", ".env"), envLink); err != nil {
+			return fmt.Errorf("error al enlazar .env en el servidor standalone: %v", err)
+		}
+		exec.Command("chown", "-h", fmt.Sprintf("%s:%s", opts.User, opts.User), envLink).Run()
+	}
+
+	if err := os.RemoveAll(filepath.Join(opts.AppDir, "node_modules")); err != nil {
+		fmt.Printf("Advertencia: no se pudo eliminar node_modules de la release: %v\n", err)
+	}
+	return nil
+}
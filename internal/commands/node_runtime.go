@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// resolveNodeVersion determina e instala la versión de Node.js de la aplicación.
+// El flag --node tiene prioridad sobre el manifiesto y este sobre .nvmrc, .node-version
+// y engines.node. Sin ninguna indicación se usa el node del sistema.
+func resolveNodeVersion(opts *DeployOptions) error {
+	spec, source := opts.NodeSpec, "--node"
+	if spec == "" && opts.Manifest != nil && opts.Manifest.Node != "" {
+		spec, source = opts.Manifest.Node, utils.ManifestFileName
+	}
+	if spec == "" {
+		spec, source = utils.DetectNodeVersionSpec(opts.AppDir)
+	}
+	if spec == "" {
+		fmt.Println("El proyecto no indica una versión de Node.js; se usará la del sistema")
+		opts.NodeVersion = ""
+		return nil
+	}
+
+	version, err := utils.EnsureNodeVersion(spec)
+	if err != nil {
+		return fmt.Errorf("error al preparar Node.js '%s' (%s): %v", spec, source, err)
+	}
+	opts.NodeVersion = version
+	fmt.Printf("Usando Node.js v%s (%s: %s)\n", version, source, spec)
+	return nil
+}
+
+// nodeShell antepone al comando el directorio de la versión de Node.js del sitio en el PATH
+func nodeShell(opts *DeployOptions, command string) string {
+	if opts.NodeVersion == "" {
+		return command
+	}
+	return fmt.Sprintf("export PATH=%s:$PATH; %s", utils.NodeBinDir(opts.NodeVersion), command)
+}
@@ -0,0 +1,515 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/utils"
+)
+
+// releasesToKeep es la cantidad de releases anteriores que se conservan en disco
+const releasesToKeep = 5
+
+// releasesDir devuelve el directorio que contiene las releases de un sitio
+func releasesDir(opts *DeployOptions) string {
+	return filepath.Join(opts.HomeDir, "apps", opts.Domain, "releases")
+}
+
+// liveAppDir devuelve la ruta estable de la aplicación activa (a través del enlace simbólico)
+func liveAppDir(opts *DeployOptions) string {
+	return filepath.Join(opts.CurrentDir, opts.AppSubdir)
+}
+
+// migrateLegacyLayout convierte un despliegue anterior (clonado directamente en la ruta
+// estable) en una release, para que pueda usarse como punto de reversión.
+func migrateLegacyLayout(opts *DeployOptions) error {
+	info, err := os.Lstat(opts.CurrentDir)
+	if os.IsNotExist(err) || (err == nil && info.Mode()&os.ModeSymlink != 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error al verificar %s: %v", opts.CurrentDir, err)
+	}
+
+	legacyRelease := filepath.Join(releasesDir(opts), info.ModTime().Format("20060102150405"))
+	fmt.Printf("Convirtiendo el despliegue existente en la release %s...\n", filepath.Base(legacyRelease))
+	if err := os.MkdirAll(releasesDir(opts), 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de releases: %v", err)
+	}
+	if err := os.Rename(opts.CurrentDir, legacyRelease); err != nil {
+		return fmt.Errorf("error al mover el despliegue existente: %v", err)
+	}
+	return switchCurrentRelease(opts, legacyRelease)
+}
+
+// carryOverEnv copia el archivo .env de la release activa a la nueva release
+func carryOverEnv(opts *DeployOptions) error {
+	newEnv := filepath.Join(opts.AppDir, ".env")
+	if _, err := os.Stat(newEnv); err == nil {
+		return nil
+	}
+
+	currentEnv := filepath.Join(liveAppDir(opts), ".env")
+	info, err := os.Stat(currentEnv)
+	if err != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(currentEnv)
+	if err != nil {
+		return fmt.Errorf("error al leer el .env de la release activa: %v", err)
+	}
+	if err := os.WriteFile(newEnv, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error al copiar .env a la nueva release: %v", err)
+	}
+
+	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), newEnv)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario de .env: %v\n%s", err, output)
+	}
+
+	fmt.Println("Archivo .env copiado desde la release activa")
+	return nil
+}
+
+// linkSharedStorage reemplaza el directorio storage de la release por un enlace al
+// directorio compartido, para que sesiones, logs y archivos subidos sobrevivan a cada release.
+func linkSharedStorage(opts *DeployOptions) error {
+	sharedStorage := filepath.Join(opts.HomeDir, "apps", opts.Domain, "shared", "storage")
+	releaseStorage := filepath.Join(opts.AppDir, "storage")
+
+	if _, err := os.Stat(sharedStorage); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(sharedStorage), 0755); err != nil {
+			return fmt.Errorf("error al crear directorio compartido: %v", err)
+		}
+		liveStorage := filepath.Join(liveAppDir(opts), "storage")
+		if info, err := os.Lstat(liveStorage); err == nil && info.IsDir() {
+			// El storage de la aplicación activa (por ejemplo, un despliegue anterior convertido en
+			// release) guarda los archivos subidos, las sesiones y los logs: se mueve al directorio
+			// compartido y se enlaza en su lugar para que la aplicación activa y una reversión lo
+			// sigan usando
+			if err := os.Rename(liveStorage, sharedStorage); err != nil {
+				return fmt.Errorf("error al mover storage al directorio compartido: %v", err)
+			}
+			if err := os.Symlink(sharedStorage, liveStorage); err != nil {
+				return fmt.Errorf("error al enlazar storage compartido en la release activa: %v", err)
+			}
+			fmt.Println("Storage de la release activa movido al directorio compartido")
+		} else if _, err := os.Stat(releaseStorage); err == nil {
+			// En un sitio nuevo se usa el storage del repositorio como base
+			if err := os.Rename(releaseStorage, sharedStorage); err != nil {
+				return fmt.Errorf("error al mover storage al directorio compartido: %v", err)
+			}
+		} else if err := os.MkdirAll(sharedStorage, 0775); err != nil {
+			return fmt.Errorf("error al crear storage compartido: %v", err)
+		}
+	}
+
+	if err := os.RemoveAll(releaseStorage); err != nil {
+		return fmt.Errorf("error al eliminar storage de la release: %v", err)
+	}
+	if err := os.Symlink(sharedStorage, releaseStorage); err != nil {
+		return fmt.Errorf("error al enlazar storage compartido: %v", err)
+	}
+
+	cmd := exec.Command("chown", "-R", fmt.Sprintf("%s:%s", opts.User, opts.User), filepath.Dir(sharedStorage))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario del storage compartido: %v\n%s", err, output)
+	}
+	exec.Command("chown", "-h", fmt.Sprintf("%s:%s", opts.User, opts.User), releaseStorage).Run()
+
+	return nil
+}
+
+// switchCurrentRelease apunta la ruta estable a una release de forma atómica
+func switchCurrentRelease(opts *DeployOptions, release string) error {
+	tmpLink := filepath.Join(filepath.Dir(opts.CurrentDir), "."+filepath.Base(opts.CurrentDir)+".tmp")
+	os.Remove(tmpLink)
+
+	if err := os.Symlink(release, tmpLink); err != nil {
+		return fmt.Errorf("error al crear enlace de la release: %v", err)
+	}
+	// rename reemplaza el enlace anterior sin dejar un instante sin aplicación
+	if err := os.Rename(tmpLink, opts.CurrentDir); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("error al activar la release: %v", err)
+	}
+
+	exec.Command("chown", "-h", fmt.Sprintf("%s:%s", opts.User, opts.User), opts.CurrentDir).Run()
+	return nil
+}
+
+// activateRelease activa la release recién construida y recuerda la anterior
+func activateRelease(opts *DeployOptions) error {
+	if target, err := os.Readlink(opts.CurrentDir); err == nil && target != opts.ReleaseDir {
+		opts.PreviousRelease = target
+	}
+
+	fmt.Printf("Activando release %s...\n", filepath.Base(opts.ReleaseDir))
+	return switchCurrentRelease(opts, opts.ReleaseDir)
+}
+
+// startApplication pone en marcha la release activa según el tipo de aplicación
+func startApplication(opts *DeployOptions) error {
+	publicDir := ""
+	if opts.Manifest != nil {
+		publicDir = opts.Manifest.PublicDir
+	}
+
+	switch opts.Type {
+	case "laravel":
+		if publicDir == "" {
+			publicDir = "public"
+		}
+		if err := linkPublicDir(opts, filepath.Join(liveAppDir(opts), publicDir)); err != nil {
+			return err
+		}
+		if opts.Octane.Enabled() {
+			if err := startOctane(opts); err != nil {
+				return err
+			}
+		} else {
+			if err := stopOctane(opts); err != nil {
+				return err
+			}
+			reloadPHPFPM(opts)
+		}
+		if err := startLaravelWorkers(opts, opts.Queue, opts.Scheduler); err != nil {
+			return err
+		}
+	case "nodejs":
+		if opts.StaticDir != "" {
+			return startStaticBuild(opts)
+		}
+		if publicDir != "" {
+			if err := linkPublicDir(opts, filepath.Join(liveAppDir(opts), publicDir)); err != nil {
+				return err
+			}
+		}
+		if err := startAppProcess(opts); err != nil {
+			return err
+		}
+		// Un sitio que antes era estático necesita el proxy hacia la aplicación
+		if err := ensureNodeProxy(opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startStaticBuild publica el build estático en el directorio público y configura Nginx para
+// servirlo. Si el despliegue anterior ejecutaba un proceso, se elimina porque ya no recibe tráfico.
+func startStaticBuild(opts *DeployOptions) error {
+	if err := linkPublicDir(opts, filepath.Join(liveAppDir(opts), opts.StaticDir)); err != nil {
+		return err
+	}
+
+	// Regenerar la configuración solo si no sirve ya el build (proxy o sin respaldo de la SPA)
+	conf, err := os.ReadFile(siteNginxConfPath(opts))
+	if err != nil {
+		return fmt.Errorf("error al leer configuración Nginx: %v", err)
+	}
+	content := string(conf)
+	if strings.Contains(content, "proxy_pass") || strings.Contains(content, "fastcgi_pass") ||
+		opts.SPA != strings.Contains(content, "try_files $uri $uri/ /index.html;") {
+		if err := renderSiteNginx(opts, "static", opts.SPA); err != nil {
+			return err
+		}
+	}
+
+	if prev := opts.PreviousState; prev != nil && prev.Type == "nodejs" && prev.ProcessManager != "" {
+		pm, err := utils.NewProcessManager(prev.ProcessManager)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Deteniendo el proceso anterior en %s: Nginx sirve ahora el build estático\n", pm.Name())
+		if err := pm.Remove(prev.AppProcess()); err != nil {
+			fmt.Printf("Advertencia: no se pudo eliminar el proceso anterior: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Build estático publicado desde %s\n", filepath.Join(liveAppDir(opts), opts.StaticDir))
+	return nil
+}
+
+// laravelQueueSite devuelve los datos del sitio para sus workers de colas
+func laravelQueueSite(opts *DeployOptions) utils.QueueSite {
+	return utils.QueueSite{
+		Domain:  opts.Domain,
+		User:    opts.User,
+		HomeDir: opts.HomeDir,
+		AppDir:  liveAppDir(opts),
+		PHP:     laravelPHP(opts),
+	}
+}
+
+// startLaravelWorkers aplica la configuración de los workers de colas y del cron del programador.
+// Los workers en ejecución terminan su trabajo actual con 'queue:restart' y vuelven a
+// iniciarse con el código de la release activa.
+func startLaravelWorkers(opts *DeployOptions, queue utils.QueueConfig, scheduler bool) error {
+	site := laravelQueueSite(opts)
+
+	// Si cambió el gestor, eliminar los workers del anterior
+	if prev := opts.PreviousState; prev != nil && prev.Type == "laravel" && len(prev.Queue.Workers) > 0 &&
+		prev.Queue.EffectiveManager() != queue.EffectiveManager() {
+		if old, err := utils.NewQueueManager(prev.Queue.EffectiveManager()); err == nil {
+			if err := old.Apply(site, nil); err != nil {
+				fmt.Printf("Advertencia: no se pudieron eliminar los workers de %s: %v\n", old.Name(), err)
+			}
+		}
+	}
+
+	manager, err := utils.NewQueueManager(queue.EffectiveManager())
+	if err != nil {
+		return err
+	}
+	if err := manager.Apply(site, queue.Workers); err != nil {
+		return err
+	}
+	for _, worker := range queue.Workers {
+		fmt.Printf("Worker de colas en %s: %s\n", manager.Name(), worker)
+	}
+
+	entry := ""
+	if scheduler {
+		entry = utils.LaravelSchedulerEntry(site.AppDir, site.PHP)
+	}
+	if err := utils.SetUserCron(opts.User, opts.Domain, "scheduler", entry); err != nil {
+		return err
+	}
+	if scheduler {
+		fmt.Println("Programador de tareas de Laravel instalado en el cron del usuario")
+	}
+
+	if len(queue.Workers) > 0 {
+		restart := exec.Command("su", "-c", site.PHP+" artisan queue:restart", opts.User)
+		restart.Dir = site.AppDir
+		if output, err := restart.CombinedOutput(); err != nil {
+			fmt.Printf("Advertencia: no se pudo ejecutar queue:restart: %v\n%s\n", err, output)
+		}
+	}
+	return nil
+}
+
+// reloadPHPFPM recarga el PHP-FPM de la versión del sitio para descartar el código cacheado por
+// OPcache. Los sitios sin pool propio no se recargan: afectaría a los demás sitios.
+func reloadPHPFPM(opts *DeployOptions) {
+	if opts.PreviousState == nil {
+		return
+	}
+	pool, ok := opts.PreviousState.PHPFPMPool()
+	if !ok {
+		fmt.Println("El sitio no tiene un pool propio de PHP-FPM; recargue PHP-FPM para descartar la caché de OPcache")
+		return
+	}
+	if err := (&utils.PHPFPMManager{Version: pool.Version}).Reload(appProcess(opts)); err != nil {
+		fmt.Printf("Advertencia: no se pudo recargar PHP-FPM: %v\n", err)
+	}
+}
+
+// verifyDeployment ejecuta los pasos posteriores al despliegue y las verificaciones de salud
+func verifyDeployment(opts *DeployOptions) error {
+	if opts.Manifest != nil {
+		if err := runManifestSteps(opts, "post_deploy", opts.Manifest.Hooks.PostDeploy); err != nil {
+			return err
+		}
+		if err := runManifestSteps(opts, "health_check", opts.Manifest.Hooks.HealthCheck); err != nil {
+			return err
+		}
+	}
+
+	if opts.HealthCheck.Disabled {
+		fmt.Println("Verificación de salud HTTP desactivada")
+		return nil
+	}
+
+	fmt.Println("Verificando que la aplicación responde...")
+	return utils.WaitForHealthy(healthTarget(opts), opts.HealthCheck)
+}
+
+// healthTarget determina a dónde se envía la verificación: al puerto local en Node.js y
+// Octane o a través de Nginx con la cabecera Host en el resto de los casos.
+func healthTarget(opts *DeployOptions) utils.HealthTarget {
+	runsProcess := (opts.Type == "nodejs" && opts.StaticDir == "") || (opts.Type == "laravel" && opts.Octane.Enabled())
+	if runsProcess && opts.Port > 0 {
+		return utils.HealthTarget{
+			BaseURL: fmt.Sprintf("http://127.0.0.1:%d", opts.Port),
+			Host:    opts.Domain,
+		}
+	}
+
+	// Si el sitio tiene certificado, Nginx redirige HTTP a HTTPS
+	certPath := fmt.Sprintf("/etc/letsencrypt/live/%s/fullchain.pem", opts.Domain)
+	if _, err := os.Stat(certPath); err == nil {
+		return utils.HealthTarget{BaseURL: "https://127.0.0.1", Host: opts.Domain}
+	}
+	return utils.HealthTarget{BaseURL: "http://127.0.0.1", Host: opts.Domain}
+}
+
+// rollbackRelease vuelve a la release anterior y reinicia la aplicación
+func rollbackRelease(opts *DeployOptions) error {
+	if opts.PreviousRelease == "" {
+		return fmt.Errorf("no hay una release anterior a la cual volver")
+	}
+
+	fmt.Printf("Revirtiendo a la release anterior %s...\n", filepath.Base(opts.PreviousRelease))
+	if err := switchCurrentRelease(opts, opts.PreviousRelease); err != nil {
+		return err
+	}
+	// La release anterior conserva su propio .env: registrarlo como la versión activa
+	recordEnvSnapshot(opts.Domain, filepath.Join(liveAppDir(opts), ".env"),
+		utils.EnvSnapshot{Source: "reversión del despliegue", Release: filepath.Base(opts.PreviousRelease)})
+
+	if err := restoreSiteNginx(opts); err != nil {
+		fmt.Printf("Advertencia: %v\n", err)
+	}
+
+	prev := opts.PreviousState
+	switch {
+	case opts.Type == "laravel":
+		switch {
+		case prev != nil && prev.RunsProcess():
+			// Volver a iniciar Octane con la configuración anterior
+			if err := restoreAppProcess(opts); err != nil {
+				return err
+			}
+		case opts.Octane.Enabled():
+			// Octane reemplazó a PHP-FPM: el proceso nuevo ya no recibe tráfico
+			if pm, err := utils.NewProcessManager(opts.ProcessManager); err == nil {
+				if err := pm.Remove(appProcess(opts)); err != nil {
+					fmt.Printf("Advertencia: %v\n", err)
+				}
+			}
+			reloadPHPFPM(opts)
+		default:
+			reloadPHPFPM(opts)
+		}
+		// Volver a la configuración de colas y programador del despliegue anterior
+		var queue utils.QueueConfig
+		scheduler := false
+		if prev != nil && prev.Type == "laravel" {
+			queue, scheduler = prev.Queue, prev.Scheduler
+		}
+		if err := startLaravelWorkers(opts, queue, scheduler); err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+		}
+	case opts.Type == "nodejs" && opts.StaticDir != "":
+		// El build estático reemplazó a una aplicación con proceso: volver a iniciarla
+		if prev != nil && prev.Type == "nodejs" {
+			if err := restoreAppProcess(opts); err != nil {
+				return err
+			}
+		}
+	case opts.Type == "nodejs" && prev != nil && prev.Type == "static":
+		// Antes se servía un build estático: el proceso nuevo ya no es necesario
+		if pm, err := utils.NewProcessManager(opts.ProcessManager); err == nil {
+			if err := pm.Remove(appProcess(opts)); err != nil {
+				fmt.Printf("Advertencia: %v\n", err)
+			}
+		}
+	case opts.Type == "nodejs":
+		if err := restoreAppProcess(opts); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Nota: las migraciones de base de datos ejecutadas no se revierten automáticamente")
+	return nil
+}
+
+// restoreAppProcess vuelve a iniciar la aplicación con la configuración del despliegue anterior
+func restoreAppProcess(opts *DeployOptions) error {
+	pm, err := utils.NewProcessManager(opts.ProcessManager)
+	if err != nil {
+		return err
+	}
+
+	prev := opts.PreviousState
+	if prev == nil || !prev.RunsProcess() {
+		// Sin estado anterior se reinicia con la configuración actual sobre la release restaurada
+		return pm.Start(appProcess(opts))
+	}
+
+	// Si el despliegue cambió de gestor de procesos, volver al anterior
+	if prev.ProcessManager != pm.Name() {
+		if err := pm.Remove(appProcess(opts)); err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+		}
+		if pm, err = utils.NewProcessManager(prev.ProcessManager); err != nil {
+			return err
+		}
+	}
+
+	app := prev.AppProcess()
+	if err := pm.Install(app); err != nil {
+		return err
+	}
+	return pm.Start(app)
+}
+
+// pruneReleases elimina las releases más antiguas conservando la activa y la anterior
+func pruneReleases(opts *DeployOptions) {
+	entries, err := os.ReadDir(releasesDir(opts))
+	if err != nil {
+		return
+	}
+
+	var releases []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			releases = append(releases, entry.Name())
+		}
+	}
+	// Los nombres son marcas de tiempo, el orden alfabético es cronológico
+	sort.Sort(sort.Reverse(sort.StringSlice(releases)))
+
+	for i, name := range releases {
+		path := filepath.Join(releasesDir(opts), name)
+		if i < releasesToKeep || path == opts.ReleaseDir || path == opts.PreviousRelease {
+			continue
+		}
+		fmt.Printf("Eliminando release antigua %s...\n", name)
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Printf("Advertencia: no se pudo eliminar %s: %v\n", path, err)
+		}
+	}
+}
+
+// findCurrentAppDir busca la ruta estable de la aplicación desplegada dentro de
+// apps/<dominio>, tanto con releases (enlace simbólico) como en despliegues antiguos.
+func findCurrentAppDir(baseDir string) (string, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("error al leer %s: %v", baseDir, err)
+	}
+
+	var legacy string
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "releases" || name == "shared" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			return filepath.Join(baseDir, name), nil
+		}
+		if entry.IsDir() && legacy == "" {
+			legacy = filepath.Join(baseDir, name)
+		}
+	}
+
+	if legacy == "" {
+		return "", fmt.Errorf("no se encontró una aplicación desplegada en %s", baseDir)
+	}
+	return legacy, nil
+}
+
+// newReleaseName genera el nombre de una release a partir de la hora actual
+func newReleaseName() string {
+	return time.Now().Format("20060102150405")
+}
@@ -0,0 +1,315 @@
+// internal/commands/secret.go
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/dotenv"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// generatedSecretLength es la longitud de los secretos generados con --generate
+const generatedSecretLength = 32
+
+// dbPasswordLength es la longitud de las contraseñas de base de datos generadas al desplegar
+const dbPasswordLength = 24
+
+// AddSecretCommand agrega el comando secret al comando raíz
+func AddSecretCommand(rootCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var waitLock bool
+
+	secretCmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Gestionar los secretos cifrados de un sitio",
+		Long: `Guarda cifradas las contraseñas y claves de un sitio. La clave maestra está en
+` + utils.SecretsKeyDir + ` y solo root puede leerla. En cada despliegue los secretos se
+escriben en el archivo .env de la aplicación, con permisos 0640 y el usuario del sitio
+como propietario; sus valores nunca se muestran durante el despliegue.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+			return nil
+		},
+	}
+	secretCmd.PersistentFlags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	secretCmd.PersistentFlags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+
+	// withStore valida el dominio, bloquea el sitio si se modifican sus secretos y carga el almacén
+	withStore := func(name string, modifies bool, run func(store *utils.SecretStore) error) error {
+		if err := utils.ValidateDomain(domain); err != nil {
+			return err
+		}
+		if modifies {
+			lock, err := utils.AcquireSiteLock(domain, "secret "+name, waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+		}
+		store, err := utils.LoadSecretStore(domain)
+		if err != nil {
+			return err
+		}
+		return run(store)
+	}
+
+	var generate, apply bool
+	setCmd := &cobra.Command{
+		Use:   "set <CLAVE[=valor]>...",
+		Short: "Guardar secretos",
+		Long: `Guarda uno o más secretos. Si solo se indica la CLAVE, el valor se lee sin mostrarlo
+desde la terminal (o desde la entrada estándar) o se genera con --generate.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore("set", true, func(store *utils.SecretStore) error {
+				for _, arg := range args {
+					key, value, err := secretAssignment(arg, generate)
+					if err != nil {
+						return err
+					}
+					store.Set(key, value)
+				}
+				if err := store.Save(); err != nil {
+					return err
+				}
+				fmt.Printf("%d secreto(s) guardado(s) para %s\n", len(args), domain)
+
+				if !apply {
+					fmt.Println("Los secretos se escribirán en el .env en el próximo despliegue (use --apply para hacerlo ahora)")
+					return nil
+				}
+				app, err := resolveEnvApp(domain)
+				if err != nil {
+					return err
+				}
+				recordEnvBefore(domain, app.envPath())
+				if err := renderSecretsEnv(domain, app.dir, app.user); err != nil {
+					return err
+				}
+				recordEnvSnapshot(domain, app.envPath(), utils.EnvSnapshot{Source: "secret set"})
+				return applyEnvChanges(app, cfg)
+			})
+		},
+	}
+	setCmd.Flags().BoolVar(&generate, "generate", false, "Generar un valor aleatorio para las claves sin valor")
+	setCmd.Flags().BoolVar(&apply, "apply", false, "Escribir los secretos en el .env actual y recargar la aplicación")
+
+	getCmd := &cobra.Command{
+		Use:   "get <CLAVE>",
+		Short: "Mostrar el valor de un secreto",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore("get", false, func(store *utils.SecretStore) error {
+				value, ok := store.Get(args[0])
+				if !ok {
+					return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("%s no tiene el secreto %s", domain, args[0]), nil)
+				}
+				fmt.Println(value)
+				return nil
+			})
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Listar los secretos (sin sus valores)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore("list", false, func(store *utils.SecretStore) error {
+				if store.Len() == 0 {
+					fmt.Printf("%s no tiene secretos guardados\n", domain)
+					return nil
+				}
+				// Comparar con el .env de la aplicación activa, si está desplegada
+				var env *dotenv.File
+				if app, err := resolveEnvApp(domain); err == nil {
+					env, _ = dotenv.Load(app.envPath())
+				}
+				for _, key := range store.Keys() {
+					status := ""
+					if env != nil {
+						value, _ := store.Get(key)
+						if current, ok := env.Get(key); !ok || current != value {
+							status = "  (pendiente de aplicar)"
+						}
+					}
+					fmt.Printf("%s%s\n", key, status)
+				}
+				fmt.Printf("Actualizado: %s\n", store.UpdatedAt.Format("2006-01-02 15:04:05"))
+				return nil
+			})
+		},
+	}
+
+	unsetCmd := &cobra.Command{
+		Use:   "unset <CLAVE>...",
+		Short: "Eliminar secretos",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore("unset", true, func(store *utils.SecretStore) error {
+				for _, key := range args {
+					if !store.Unset(key) {
+						return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("%s no tiene el secreto %s", domain, key), nil)
+					}
+				}
+				if err := store.Save(); err != nil {
+					return err
+				}
+				fmt.Printf("%d secreto(s) eliminado(s) de %s\n", len(args), domain)
+				fmt.Printf("El .env actual los conserva; elimínelos con 'sm env unset -d %s'\n", domain)
+				return nil
+			})
+		},
+	}
+
+	var master bool
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Volver a cifrar los secretos con una clave nueva",
+		Long: `Vuelve a cifrar los secretos del sitio con una clave de datos nueva. Con --master se
+genera una clave maestra nueva y se vuelven a cifrar las claves de todos los sitios.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if master {
+				if domain != "" {
+					return utils.NewError(utils.ErrorValidacion, "--master rota la clave de todos los sitios; no use -d", nil)
+				}
+				count, err := utils.RotateSecretsMasterKey(waitLock)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Clave maestra rotada; %d sitio(s) cifrado(s) de nuevo\n", count)
+				return nil
+			}
+			return withStore("rotate", true, func(store *utils.SecretStore) error {
+				if err := store.RotateKey(); err != nil {
+					return err
+				}
+				fmt.Printf("Secretos de %s cifrados con una clave nueva\n", domain)
+				return nil
+			})
+		},
+	}
+	rotateCmd.Flags().BoolVar(&master, "master", false, "Rotar la clave maestra de todos los sitios")
+
+	secretCmd.AddCommand(setCmd, getCmd, listCmd, unsetCmd, rotateCmd)
+	rootCmd.AddCommand(secretCmd)
+}
+
+// secretAssignment obtiene la clave y el valor de un argumento de 'sm secret set'. Los valores
+// que no se pasan como argumento se generan o se leen sin mostrarlos.
+func secretAssignment(arg string, generate bool) (string, string, error) {
+	if strings.Contains(arg, "=") {
+		return utils.ParseEnvAssignment(arg)
+	}
+	if err := utils.ValidateEnvKey(arg); err != nil {
+		return "", "", err
+	}
+	if generate {
+		value, err := utils.GenerateSecret(generatedSecretLength)
+		return arg, value, err
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("%s (entrada oculta): ", arg)
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", "", fmt.Errorf("error al leer entrada: %v", err)
+		}
+		if len(value) == 0 {
+			return "", "", utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no se indicó un valor para %s", arg), nil)
+		}
+		return arg, string(value), nil
+	}
+
+	// Sin terminal el valor llega por la entrada estándar, una línea por clave
+	value, err := stdinReader.ReadString('\n')
+	if err != nil && value == "" {
+		return "", "", fmt.Errorf("error al leer el valor de %s: %v", arg, err)
+	}
+	return arg, strings.TrimRight(value, "\r\n"), nil
+}
+
+// stdinReader lee los valores de los secretos desde la entrada estándar
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// renderSecretsEnv escribe los secretos del sitio en el .env de la aplicación, con permisos
+// 0640 y el usuario del sitio como propietario. Los valores nunca se muestran.
+func renderSecretsEnv(domain, appDir, user string) error {
+	store, err := utils.LoadSecretStore(domain)
+	if err != nil {
+		return err
+	}
+
+	envPath := filepath.Join(appDir, ".env")
+	env, err := dotenv.Load(envPath)
+	if os.IsNotExist(err) {
+		if store.Len() == 0 {
+			return nil
+		}
+		env = dotenv.New()
+	} else if err != nil {
+		return fmt.Errorf("error al leer %s: %v", envPath, err)
+	}
+
+	for _, key := range store.Keys() {
+		value, _ := store.Get(key)
+		env.Set(key, value)
+	}
+	if err := env.Write(envPath, utils.EnvFileMode); err != nil {
+		return err
+	}
+	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", user, user), envPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario del archivo .env: %v\n%s", err, output)
+	}
+
+	if store.Len() > 0 {
+		fmt.Printf("%d secreto(s) escrito(s) en el archivo .env\n", store.Len())
+	}
+	return nil
+}
+
+// saveSiteSecrets guarda en el almacén cifrado del sitio las variables con valores secretos
+func saveSiteSecrets(domain string, values map[string]string) error {
+	store, err := utils.LoadSecretStore(domain)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if utils.IsSecretEnvKey(key) {
+			store.Set(key, value)
+		}
+	}
+	return store.Save()
+}
+
+// warnSecretOverride advierte de las variables que también están en los secretos del sitio,
+// ya que el próximo despliegue las reemplazará por el valor guardado
+func warnSecretOverride(domain string, keys []string) {
+	store, err := utils.LoadSecretStore(domain)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := store.Get(key); ok {
+			fmt.Printf("Advertencia: %s está en los secretos del sitio y el próximo despliegue usará el valor guardado; cámbielo con 'sm secret set -d %s %s'\n", key, domain, key)
+		}
+	}
+}
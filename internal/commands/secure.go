@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -26,6 +27,7 @@ type SecureOptions struct {
 func AddSecureCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	// Opciones del comando
 	var opts SecureOptions
+	var waitLock bool
 
 	// Crear comando secure
 	secureCmd := &cobra.Command{
@@ -92,6 +94,13 @@ func AddSecureCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return fmt.Errorf("el sitio %s no existe, primero crea el sitio con 'sm site'", opts.Domain)
 			}
 
+			// Evitar modificar el sitio mientras otra operación está en curso
+			lock, err := utils.AcquireSiteLock(opts.Domain, "secure", waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+
 			// Verificar si los certificados ya existen
 			certPath := fmt.Sprintf("/etc/letsencrypt/live/%s/fullchain.pem", opts.Domain)
 			if _, err := os.Stat(certPath); err == nil && !opts.Force {
@@ -132,6 +141,7 @@ func AddSecureCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	secureCmd.Flags().StringVarP(&opts.Domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
 	secureCmd.Flags().StringVarP(&opts.Email, "email", "e", "", "Email para Let's Encrypt (opcional si está configurado)")
 	secureCmd.Flags().BoolVar(&opts.Force, "force", false, "Forzar la regeneración de certificados SSL y actualización de configuración")
+	secureCmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
 
 	// Marcar flags obligatorios
 	secureCmd.MarkFlagRequired("domain")
@@ -265,13 +275,41 @@ func updateNginxConfigWithSSL(opts *SecureOptions, cfg *config.Config) error {
 	confFile := filepath.Join(nginxDir, fmt.Sprintf("%s.conf", opts.Domain))
 	
 	siteType := "static" // Por defecto
+	spa := false
+	nextStatic := ""
+	port := cfg.DefaultPort
+	phpVersion, phpSocket := cfg.DefaultPHP, ""
+	maxBodySize := ""
 	if currentConfig, err := os.ReadFile(confFile); err == nil {
 		configContent := string(currentConfig)
-		if strings.Contains(configContent, "fastcgi_pass") {
+		if strings.Contains(configContent, "location @octane") {
+			siteType = "octane"
+		} else if strings.Contains(configContent, "fastcgi_pass") {
 			siteType = "laravel"
 		} else if strings.Contains(configContent, "proxy_pass") {
 			siteType = "nodejs"
 		}
+		// Conservar el puerto de la aplicación
+		if match := proxyPortPattern.FindStringSubmatch(configContent); match != nil {
+			port, _ = strconv.Atoi(match[1])
+		}
+		// Conservar la versión de PHP y el socket del pool del sitio
+		if match := fastcgiSocketPattern.FindStringSubmatch(configContent); match != nil {
+			phpSocket = match[1]
+		}
+		if version := utils.DetectPHPVersion(confFile); version != "" {
+			phpVersion = version
+		}
+		// Conservar el límite de subida sincronizado con el php.ini del sitio
+		if match := maxBodySizePattern.FindStringSubmatch(configContent); match != nil {
+			maxBodySize = match[1]
+		}
+		// Conservar el respaldo a index.html de las aplicaciones de una sola página
+		spa = strings.Contains(configContent, "try_files $uri $uri/ /index.html;")
+		// Conservar los archivos estáticos de Next.js servidos desde el disco
+		if match := nextStaticPattern.FindStringSubmatch(configContent); match != nil {
+			nextStatic = match[1]
+		}
 	}
 
 	// Leer la plantilla SSL
@@ -296,8 +334,12 @@ func updateNginxConfigWithSSL(opts *SecureOptions, cfg *config.Config) error {
 		"RootDir":      filepath.Join(opts.HomeDir, "public_html"),
 		"SiteType":     siteType,
 		"RedirectHTTP": true,
-		"PHP":          cfg.DefaultPHP,
-		"Port":         cfg.DefaultPort,
+		"PHP":          phpVersion,
+		"PHPSocket":    phpSocket,
+		"MaxBodySize":  maxBodySize,
+		"Port":         port,
+		"SPA":          spa,
+		"NextStatic":   nextStatic,
 	}
 
 	// Archivo de configuración actual (ya definido arriba)
@@ -25,6 +25,9 @@ type SiteOptions struct {
 	IsSubdomain  bool
 	ParentDomain string
 	SkelDir      string
+	// Pool dedicado de PHP-FPM de los sitios Laravel
+	PHPPool   utils.PHPPoolSettings
+	PHPSocket string
 }
 
 // AddSiteCommand agrega el comando site al comando raíz
@@ -121,6 +124,13 @@ func AddSiteCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return err
 			}
 
+			// Los sitios Laravel ejecutan PHP en su propio pool, como el usuario del sitio
+			if opts.Type == "laravel" {
+				if err := setupPHPPool(&opts); err != nil {
+					return err
+				}
+			}
+
 			// Generar configuración de Nginx
 			if err := generateNginxConfig(&opts, cfg); err != nil {
 				return err
@@ -136,6 +146,11 @@ func AddSiteCommand(rootCmd *cobra.Command, cfg *config.Config) {
 				return err
 			}
 
+			// Registrar el sitio para los comandos que lo administran después
+			if err := saveSiteRecord(&opts); err != nil {
+				fmt.Printf("Advertencia: no se pudo guardar el estado del sitio: %v\n", err)
+			}
+
 			fmt.Printf("Sitio %s configurado correctamente\n", opts.Domain)
 			return nil
 		},
@@ -146,6 +161,10 @@ func AddSiteCommand(rootCmd *cobra.Command, cfg *config.Config) {
 	siteCmd.Flags().StringVarP(&opts.Type, "type", "t", "", "Tipo de sitio (laravel, nodejs, static)")
 	siteCmd.Flags().StringVarP(&opts.PHP, "php", "p", "8.1", "Versión de PHP (para sitios Laravel)")
 	siteCmd.Flags().IntVarP(&port, "port", "P", 3000, "Puerto (para sitios Node.js)")
+	siteCmd.Flags().StringVar(&opts.PHPPool.PM, "fpm-pm", "", "Modo del pool de PHP-FPM: ondemand (por defecto), dynamic o static")
+	siteCmd.Flags().IntVar(&opts.PHPPool.MaxChildren, "fpm-max-children", 0, "Procesos máximos del pool de PHP-FPM (por defecto 5)")
+	siteCmd.Flags().IntVar(&opts.PHPPool.MaxRequests, "fpm-max-requests", 0, "Peticiones por proceso antes de reciclarlo (por defecto 500)")
+	siteCmd.Flags().StringVar(&opts.PHPPool.DisableFunctions, "disable-functions", "", "Funciones de PHP deshabilitadas, separadas por comas")
 
 	// Marcar flags obligatorios
 	siteCmd.MarkFlagRequired("domain")
@@ -166,6 +185,11 @@ func AddSiteCommand(rootCmd *cobra.Command, cfg *config.Config) {
 		return utils.CheckRequirements("site", requirements)
 	}
 
+	// Agregar subcomandos
+	addSiteRemoveCommand(siteCmd, cfg)
+	addSitePHPCommand(siteCmd, cfg)
+	addSitePHPIniCommand(siteCmd, cfg)
+
 	// Agregar comando al comando raíz
 	rootCmd.AddCommand(siteCmd)
 }
@@ -371,13 +395,14 @@ func generateNginxConfig(opts *SiteOptions, cfg *config.Config) error {
 
 	// Datos para la plantilla
 	data := map[string]interface{}{
-		"Domain":   opts.Domain,
-		"RootDir":  filepath.Join(opts.HomeDir, "public_html"),
-		"PHP":      strings.TrimPrefix(opts.PHP, "php"), // Asegurar que no tenga el prefijo "php"
-		"Port":     opts.Port,
-		"User":     opts.User,
-		"HomeDir":  opts.HomeDir,
-		"NginxDir": opts.NginxDir,
+		"Domain":    opts.Domain,
+		"RootDir":   filepath.Join(opts.HomeDir, "public_html"),
+		"PHP":       strings.TrimPrefix(opts.PHP, "php"), // Asegurar que no tenga el prefijo "php"
+		"PHPSocket": opts.PHPSocket,
+		"Port":      opts.Port,
+		"User":      opts.User,
+		"HomeDir":   opts.HomeDir,
+		"NginxDir":  opts.NginxDir,
 	}
 
 	// Archivo de configuración
@@ -844,3 +869,42 @@ updateDateTime(); // Ejecutar inmediatamente
 	fmt.Printf("✅ Sitio estático creado con estructura completa en %s\n", filepath.Join(opts.HomeDir, "public_html"))
 	return nil
 }
+
+// saveSiteRecord registra el tipo, el usuario y la versión de PHP del sitio en su estado
+func saveSiteRecord(opts *SiteOptions) error {
+	state, err := utils.LoadSiteState(opts.Domain)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &utils.SiteState{Domain: opts.Domain, HomeDir: opts.HomeDir}
+	}
+
+	state.Type = opts.Type
+	state.User = opts.User
+	state.SiteDir = opts.HomeDir
+	if opts.Type == "laravel" {
+		state.PHPVersion = opts.PHP
+		pool := opts.PHPPool
+		state.PHPPool = &pool
+	}
+	return utils.SaveSiteState(state)
+}
+
+// setupPHPPool crea el pool de PHP-FPM del sitio: se ejecuta como el usuario del sitio, con su
+// propio socket, limitado a su directorio home y con las funciones peligrosas deshabilitadas
+func setupPHPPool(opts *SiteOptions) error {
+	if err := opts.PHPPool.Validate(); err != nil {
+		return err
+	}
+	opts.PHP = strings.TrimPrefix(opts.PHP, "php")
+	pool, err := utils.NewPHPFPMPool(opts.Domain, opts.User, opts.HomeDir, opts.PHP, opts.PHPPool)
+	if err != nil {
+		return err
+	}
+	if err := pool.Install(); err != nil {
+		return err
+	}
+	opts.PHPSocket = pool.Socket()
+	return nil
+}
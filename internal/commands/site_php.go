@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// phpSocketTimeout es el tiempo máximo de espera para que PHP-FPM cree el socket del pool
+const phpSocketTimeout = 10 * time.Second
+
+// addSitePHPCommand agrega el subcomando php al comando site
+func addSitePHPCommand(siteCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var version string
+	var waitLock bool
+
+	phpCmd := &cobra.Command{
+		Use:   "php",
+		Short: "Cambiar la versión de PHP de un sitio",
+		Long: `Cambia la versión de PHP de un sitio Laravel: mueve su pool de PHP-FPM a la nueva versión,
+regenera la configuración de Nginx, limpia las cachés de Laravel y reinicia los workers.
+Si el nuevo pool no arranca, el sitio sigue usando la versión anterior.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+			version = strings.TrimPrefix(version, "php")
+			if !cfg.IsValidPHPVersion(version) {
+				return utils.NewError(utils.ErrorValidacion,
+					fmt.Sprintf("versión de PHP no soportada: %s (disponibles: %s)", version, strings.Join(cfg.PHPVersions, ", ")), nil)
+			}
+			if err := utils.CheckPHPDependency(version); err != nil {
+				return err
+			}
+
+			// Evitar cambiar la versión mientras otra operación modifica el sitio
+			lock, err := utils.AcquireSiteLock(domain, "site php", waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+
+			return switchSitePHP(domain, version, cfg)
+		},
+	}
+
+	phpCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	phpCmd.Flags().StringVarP(&version, "version", "v", "", "Nueva versión de PHP (por ejemplo 8.4)")
+	phpCmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+	phpCmd.MarkFlagRequired("domain")
+	phpCmd.MarkFlagRequired("version")
+
+	siteCmd.AddCommand(phpCmd)
+}
+
+// sitePHPOptions describe un sitio Laravel registrado para regenerar su configuración y sus procesos
+func sitePHPOptions(state *utils.SiteState, cfg *config.Config) *DeployOptions {
+	domainParts := strings.Split(state.Domain, ".")
+	return &DeployOptions{
+		Domain:         state.Domain,
+		Type:           state.Type,
+		User:           state.User,
+		HomeDir:        state.HomeDir,
+		AppDir:         state.AppDir,
+		CurrentDir:     state.AppDir,
+		IsSubdomain:    len(domainParts) > 2 && domainParts[0] != "www",
+		Port:           state.Port,
+		StartCommand:   state.StartCommand,
+		ProcessManager: state.ProcessManager,
+		Tuning:         state.ProcessTuning,
+		Octane:         state.Octane,
+		PreviousState:  state,
+		Config:         cfg,
+	}
+}
+
+// switchSitePHP mueve un sitio Laravel a otra versión de PHP. El pool nuevo se instala y se
+// verifica antes de tocar Nginx; el pool anterior solo se elimina cuando Nginx ya usa el nuevo.
+func switchSitePHP(domain, version string, cfg *config.Config) error {
+	state, err := utils.LoadSiteState(domain)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no hay información registrada para %s", domain), nil)
+	}
+	if state.Type != "laravel" {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("el sitio %s (%s) no usa PHP", domain, state.Type), nil)
+	}
+
+	// Los sitios creados antes de registrar la versión de PHP se detectan por su configuración de Nginx
+	current := state.PHPVersion
+	if current == "" {
+		current = utils.DetectPHPVersion(filepath.Join(cfg.SitesAvailable, domain+".conf"))
+	}
+	if current == version {
+		fmt.Printf("%s ya usa PHP %s\n", domain, version)
+		return nil
+	}
+	fmt.Printf("Cambiando %s de PHP %s a PHP %s...\n", domain, current, version)
+
+	oldState := *state
+	oldState.PHPVersion = current
+	state.PHPVersion = version
+	opts := sitePHPOptions(state, cfg)
+
+	// Instalar el pool en la nueva versión y esperar a que PHP-FPM cree su socket
+	newPool, hasPool := state.PHPFPMPool()
+	if hasPool {
+		if err := newPool.Install(); err != nil {
+			newPool.Remove()
+			return err
+		}
+		if err := waitForSocket(newPool.Socket(), phpSocketTimeout); err != nil {
+			newPool.Remove()
+			return err
+		}
+	}
+
+	if state.RunsProcess() {
+		// Octane: el proceso se reinicia con el binario de PHP de la nueva versión
+		opts.StartCommand = state.Octane.Command(utils.PHPBinary(version), state.Port)
+		state.StartCommand = opts.StartCommand
+		if err := restartOctane(opts); err != nil {
+			if hasPool {
+				newPool.Remove()
+			}
+			return err
+		}
+	} else if err := renderSiteNginx(opts, "laravel", false); err != nil {
+		if hasPool {
+			newPool.Remove()
+		}
+		return err
+	}
+
+	if oldPool, ok := oldState.PHPFPMPool(); ok {
+		if err := oldPool.Remove(); err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+		}
+	}
+
+	if state.AppDir != "" {
+		clearLaravelCaches(opts)
+		if len(state.Queue.Workers) > 0 || state.Scheduler {
+			if err := startLaravelWorkers(opts, state.Queue, state.Scheduler); err != nil {
+				fmt.Printf("Advertencia: no se pudieron reiniciar los workers: %v\n", err)
+			}
+		}
+	}
+
+	if err := utils.SaveSiteState(state); err != nil {
+		return err
+	}
+	fmt.Printf("%s usa ahora PHP %s\n", domain, version)
+	return nil
+}
+
+// restartOctane vuelve a registrar el proceso de Octane con su nuevo comando y lo reinicia
+func restartOctane(opts *DeployOptions) error {
+	pm, err := utils.NewProcessManager(opts.ProcessManager)
+	if err != nil {
+		return err
+	}
+	app := appProcess(opts)
+	if err := pm.Install(app); err != nil {
+		return err
+	}
+	if err := pm.Restart(app); err != nil {
+		return err
+	}
+	fmt.Printf("Octane reiniciado con %s en el puerto %d\n", pm.Name(), opts.Port)
+	return nil
+}
+
+// clearLaravelCaches descarta las cachés compiladas de la aplicación y las vuelve a generar con
+// la versión de PHP del sitio
+func clearLaravelCaches(opts *DeployOptions) {
+	php := laravelPHP(opts)
+	err := runLaravelCommands(opts, []string{
+		php + " artisan optimize:clear",
+		php + " artisan config:cache",
+		php + " artisan route:cache || echo 'No se pudieron cachear las rutas'",
+		php + " artisan view:cache",
+	})
+	if err != nil {
+		fmt.Printf("Advertencia: no se pudieron regenerar las cachés de Laravel: %v\n", err)
+	}
+}
+
+// waitForSocket espera a que exista el socket de un pool de PHP-FPM
+func waitForSocket(socket string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return utils.NewError(utils.ErrorComando,
+				fmt.Sprintf("PHP-FPM no creó el socket %s; el sitio sigue usando la versión anterior", socket), nil)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
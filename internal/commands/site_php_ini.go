@@ -0,0 +1,222 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// defaultMaxBodySize es el client_max_body_size de las plantillas cuando el sitio no define límites de subida
+const defaultMaxBodySize = "100M"
+
+// addSitePHPIniCommand agrega el subcomando php-ini al comando site
+func addSitePHPIniCommand(siteCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var waitLock bool
+
+	phpIniCmd := &cobra.Command{
+		Use:   "php-ini",
+		Short: "Gestionar las directivas de php.ini de un sitio",
+		Long: `Gestiona las directivas de php.ini propias de un sitio Laravel. Se escriben como
+php_admin_value en su pool de PHP-FPM, por lo que no afectan a otros sitios. El
+client_max_body_size de Nginx se ajusta a upload_max_filesize y post_max_size.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+			return utils.ValidateDomain(domain)
+		},
+	}
+	phpIniCmd.PersistentFlags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	phpIniCmd.PersistentFlags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+	phpIniCmd.MarkPersistentFlagRequired("domain")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Mostrar las directivas de php.ini del sitio",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			state, pool, err := loadSitePHPPool(domain)
+			if err != nil {
+				return err
+			}
+			if len(pool.INI) == 0 {
+				fmt.Printf("%s usa los valores de php.ini de PHP %s\n", domain, state.PHPVersion)
+			}
+			keys := make([]string, 0, len(pool.INI))
+			for key := range pool.INI {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("%s = %s\n", key, pool.INI[key])
+			}
+			if conf, err := os.ReadFile(siteNginxConfPath(sitePHPOptions(state, cfg))); err == nil {
+				if match := maxBodySizePattern.FindSubmatch(conf); match != nil {
+					fmt.Printf("\nNginx client_max_body_size = %s\n", match[1])
+				}
+			}
+			return nil
+		},
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <clave=valor>...",
+		Short: "Definir directivas de php.ini del sitio",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values := make(map[string]string, len(args))
+			for _, arg := range args {
+				key, value, err := utils.ParsePHPIniDirective(arg)
+				if err != nil {
+					return err
+				}
+				values[key] = value
+			}
+			return updateSitePHPIni(domain, cfg, waitLock, func(ini map[string]string) error {
+				for key, value := range values {
+					ini[key] = value
+				}
+				if _, ok := values["upload_max_filesize"]; ok && ini["post_max_size"] == "" {
+					fmt.Println("Nota: post_max_size debe ser mayor o igual que upload_max_filesize; defínalo también si el valor del servidor es menor")
+				}
+				return nil
+			})
+		},
+	}
+
+	unsetCmd := &cobra.Command{
+		Use:   "unset <clave>...",
+		Short: "Eliminar directivas de php.ini del sitio",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateSitePHPIni(domain, cfg, waitLock, func(ini map[string]string) error {
+				for _, key := range args {
+					if _, ok := ini[key]; !ok {
+						return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("%s no está definida para %s", key, domain), nil)
+					}
+					delete(ini, key)
+				}
+				return nil
+			})
+		},
+	}
+
+	opcacheCmd := &cobra.Command{
+		Use:       "opcache <preset>",
+		Short:     "Aplicar un preset de OPcache y JIT al sitio",
+		Long:      `Reemplaza los ajustes opcache.* del sitio por un preset: ` + strings.Join(utils.OPcachePresetNames(), ", ") + `.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: utils.OPcachePresetNames(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateSitePHPIni(domain, cfg, waitLock, func(ini map[string]string) error {
+				if err := utils.ApplyOPcachePreset(ini, args[0]); err != nil {
+					return err
+				}
+				if args[0] == "jit" {
+					fmt.Println("Nota: JIT necesita opcache.jit_buffer_size en el php.ini de PHP-FPM, que es común a todos los sitios")
+				}
+				return nil
+			})
+		},
+	}
+
+	phpIniCmd.AddCommand(listCmd, setCmd, unsetCmd, opcacheCmd)
+	siteCmd.AddCommand(phpIniCmd)
+}
+
+// loadSitePHPPool carga el estado de un sitio Laravel y su pool dedicado de PHP-FPM
+func loadSitePHPPool(domain string) (*utils.SiteState, utils.PHPFPMPool, error) {
+	state, err := utils.LoadSiteState(domain)
+	if err != nil {
+		return nil, utils.PHPFPMPool{}, err
+	}
+	if state == nil {
+		return nil, utils.PHPFPMPool{}, utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no hay información registrada para %s", domain), nil)
+	}
+	pool, ok := state.PHPFPMPool()
+	if !ok {
+		return nil, utils.PHPFPMPool{}, utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("%s no tiene un pool de PHP-FPM propio; vuelva a configurarlo con 'sm site -d %s -t laravel'", domain, domain), nil)
+	}
+	return state, pool, nil
+}
+
+// updateSitePHPIni modifica las directivas de php.ini del pool del sitio, valida y recarga PHP-FPM
+// y ajusta el límite de subida de Nginx
+func updateSitePHPIni(domain string, cfg *config.Config, waitLock bool, change func(ini map[string]string) error) error {
+	// Evitar modificar el pool mientras otra operación modifica el sitio
+	lock, err := utils.AcquireSiteLock(domain, "site php-ini", waitLock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	state, pool, err := loadSitePHPPool(domain)
+	if err != nil {
+		return err
+	}
+
+	ini := make(map[string]string, len(pool.INI))
+	for key, value := range pool.INI {
+		ini[key] = value
+	}
+	if err := change(ini); err != nil {
+		return err
+	}
+	pool.INI = ini
+	if err := pool.Validate(); err != nil {
+		return err
+	}
+	if err := pool.Install(); err != nil {
+		return err
+	}
+
+	settings := pool.PHPPoolSettings
+	state.PHPPool = &settings
+	if err := syncNginxBodySize(sitePHPOptions(state, cfg), ini); err != nil {
+		fmt.Printf("Advertencia: %v\n", err)
+	}
+	if err := utils.SaveSiteState(state); err != nil {
+		return err
+	}
+	fmt.Printf("Directivas de php.ini de %s actualizadas\n", domain)
+	return nil
+}
+
+// syncNginxBodySize ajusta client_max_body_size en la configuración de Nginx del sitio a sus
+// límites de subida de PHP
+func syncNginxBodySize(opts *DeployOptions, ini map[string]string) error {
+	size := utils.PHPIniBodySize(ini)
+	if size == "" {
+		size = defaultMaxBodySize
+	}
+
+	confPath := siteNginxConfPath(opts)
+	current, err := os.ReadFile(confPath)
+	if err != nil {
+		return fmt.Errorf("error al leer configuración Nginx: %v", err)
+	}
+	updated := maxBodySizePattern.ReplaceAll(current, []byte(fmt.Sprintf("client_max_body_size %s;", size)))
+	if bytes.Equal(updated, current) {
+		return nil
+	}
+	if err := writeNginxConf(confPath, updated, current); err != nil {
+		return err
+	}
+	exec.Command("chown", fmt.Sprintf("%s:%s", opts.User, opts.User), confPath).Run()
+	fmt.Printf("client_max_body_size de Nginx ajustado a %s\n", size)
+	return nil
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elmersh/sitemanager/internal/config"
+	"github.com/elmersh/sitemanager/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// addSiteRemoveCommand agrega el subcomando remove al comando site
+func addSiteRemoveCommand(siteCmd *cobra.Command, cfg *config.Config) {
+	var domain string
+	var waitLock bool
+
+	removeCmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Eliminar la configuración de un sitio",
+		Long: `Elimina la configuración de Nginx, el pool de PHP-FPM y el estado registrado de un sitio.
+El usuario y los archivos de su directorio home se conservan. Si el sitio tiene una
+aplicación desplegada, primero debe eliminarse con 'sm deploy remove'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Cargar configuración si no se ha pasado
+			if cfg == nil {
+				var err error
+				cfg, err = config.LoadConfig()
+				if err != nil {
+					return fmt.Errorf("error al cargar la configuración: %v", err)
+				}
+			}
+
+			if err := utils.ValidateDomain(domain); err != nil {
+				return err
+			}
+
+			// Evitar eliminar el sitio mientras otra operación lo modifica
+			lock, err := utils.AcquireSiteLock(domain, "site remove", waitLock)
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+
+			return removeSite(domain, cfg)
+		},
+	}
+
+	removeCmd.Flags().StringVarP(&domain, "domain", "d", "", "Dominio del sitio (obligatorio)")
+	removeCmd.Flags().BoolVar(&waitLock, "wait", false, "Esperar si otra operación está en curso sobre el sitio")
+	removeCmd.MarkFlagRequired("domain")
+
+	siteCmd.AddCommand(removeCmd)
+}
+
+// removeSite elimina la configuración de Nginx, el pool de PHP-FPM y el estado de un sitio
+func removeSite(domain string, cfg *config.Config) error {
+	state, err := utils.LoadSiteState(domain)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return utils.NewError(utils.ErrorValidacion, fmt.Sprintf("no hay información registrada para %s", domain), nil)
+	}
+	if state.AppDir != "" {
+		return utils.NewError(utils.ErrorValidacion,
+			fmt.Sprintf("%s tiene una aplicación desplegada; elimínela primero con 'sm deploy remove -d %s'", domain, domain), nil)
+	}
+
+	fmt.Printf("Eliminando el sitio %s...\n", domain)
+
+	// La configuración real está en el directorio nginx del usuario, enlazada desde sites-*
+	available := filepath.Join(cfg.SitesAvailable, fmt.Sprintf("%s.conf", domain))
+	confFile := filepath.Join(state.HomeDir, "nginx", fmt.Sprintf("%s.conf", domain))
+	if target, err := filepath.EvalSymlinks(available); err == nil {
+		confFile = target
+	}
+	for _, path := range []string{filepath.Join(cfg.SitesEnabled, fmt.Sprintf("%s.conf", domain)), available, confFile} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error al eliminar %s: %v", path, err)
+		}
+	}
+	if err := reloadNginx(); err != nil {
+		return err
+	}
+
+	if pool, ok := state.PHPFPMPool(); ok {
+		if err := pool.Remove(); err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+		}
+	}
+
+	if err := os.RemoveAll(utils.SiteStateDir(domain)); err != nil {
+		fmt.Printf("Advertencia: no se pudo eliminar el estado del sitio: %v\n", err)
+	}
+
+	fmt.Printf("Sitio %s eliminado. El usuario %s y los archivos de %s se conservan\n", domain, state.User, state.HomeDir)
+	return nil
+}
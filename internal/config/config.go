@@ -19,6 +19,7 @@ type Config struct {
 	DefaultUser        string            `yaml:"default_user"`
 	DefaultGroup       string            `yaml:"default_group"`
 	SkelDir            string            `yaml:"skel_dir"`
+	StateDir           string            `yaml:"state_dir"`
 	
 	// Configuración de usuario
 	Email              string            `yaml:"email"`
@@ -33,12 +34,17 @@ type Config struct {
 	
 	// Backup y mantenimiento
 	BackupConfigs      bool              `yaml:"backup_configs"`
+	// Directorio global de copias de bases de datos; vacío para usar <home del sitio>/backups/db
+	BackupDir          string            `yaml:"backup_dir"`
 	AutoUpdate         bool              `yaml:"auto_update"`
 	CheckUpdates       bool              `yaml:"check_updates"`
 	
 	// Versiones y templates
 	PHPVersions        []string          `yaml:"php_versions"`
 	NodeVersions       []string          `yaml:"node_versions"`
+	NodeDir            string            `yaml:"node_dir"`
+	NodeCacheDir       string            `yaml:"node_cache_dir"`
+	NodeMirror         string            `yaml:"node_mirror"`
 	DefaultTemplate    string            `yaml:"default_template"`
 	Templates          map[string]string `yaml:"templates"`
 	SubdomainTemplates map[string]string `yaml:"subdomain_templates"`
@@ -92,6 +98,17 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("error al inicializar el directorio skel: %v", err)
 	}
 
+	// Directorio donde se guarda el estado de cada sitio (historial, bloqueos, etc.)
+	utils.SetStateDir(cfg.StateDir)
+
+	// Versiones de Node.js administradas por SiteManager
+	utils.SetNodeRuntime(utils.NodeRuntime{
+		Dir:      cfg.NodeDir,
+		CacheDir: cfg.NodeCacheDir,
+		Mirror:   cfg.NodeMirror,
+		Allowed:  cfg.NodeVersions,
+	})
+
 	return &cfg, nil
 }
 
@@ -105,6 +122,7 @@ func createDefaultConfig(path string) (*Config, error) {
 		DefaultUser:     "www-data",
 		DefaultGroup:    "www-data",
 		SkelDir:         "/etc/sitemanager/skel",
+		StateDir:        utils.DefaultStateDir,
 		
 		// Configuración de usuario (valores vacíos para que el usuario los configure)
 		Email:           "", // Se debe configurar antes de usar SSL
@@ -125,6 +143,9 @@ func createDefaultConfig(path string) (*Config, error) {
 		// Versiones soportadas
 		PHPVersions:     []string{"8.0", "8.1", "8.2", "8.3", "8.4"},
 		NodeVersions:    []string{"16", "18", "20", "22"},
+		NodeDir:         utils.DefaultNodeDir,
+		NodeCacheDir:    utils.DefaultNodeCacheDir,
+		NodeMirror:      utils.DefaultNodeMirror,
 		DefaultTemplate: "laravel",
 		
 		// Templates
@@ -132,11 +153,13 @@ func createDefaultConfig(path string) (*Config, error) {
 			"laravel": "nginx/laravel.conf.tmpl",
 			"nodejs":  "nginx/nodejs.conf.tmpl",
 			"static":  "nginx/static.conf.tmpl",
+			"octane":  "nginx/octane.conf.tmpl",
 		},
 		SubdomainTemplates: map[string]string{
 			"laravel": "nginx/subdomain_laravel.conf.tmpl",
 			"nodejs":  "nginx/subdomain_nodejs.conf.tmpl",
 			"static":  "nginx/subdomain_static.conf.tmpl",
+			"octane":  "nginx/subdomain_octane.conf.tmpl",
 		},
 		
 		// Configuraciones avanzadas
@@ -256,6 +279,9 @@ func applyDefaults(cfg *Config) {
 	if cfg.SkelDir == "" {
 		cfg.SkelDir = "/etc/sitemanager/skel"
 	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = utils.DefaultStateDir
+	}
 	
 	// Configuración de usuario
 	if cfg.DefaultPHP == "" {
@@ -276,6 +302,7 @@ func applyDefaults(cfg *Config) {
 			"laravel": "nginx/laravel.conf.tmpl",
 			"nodejs":  "nginx/nodejs.conf.tmpl",
 			"static":  "nginx/static.conf.tmpl",
+			"octane":  "nginx/octane.conf.tmpl",
 		}
 	}
 	
@@ -284,8 +311,16 @@ func applyDefaults(cfg *Config) {
 			"laravel": "nginx/subdomain_laravel.conf.tmpl",
 			"nodejs":  "nginx/subdomain_nodejs.conf.tmpl",
 			"static":  "nginx/subdomain_static.conf.tmpl",
+			"octane":  "nginx/subdomain_octane.conf.tmpl",
 		}
 	}
+	// Las configuraciones anteriores a Octane no incluyen sus plantillas
+	if _, ok := cfg.Templates["octane"]; !ok {
+		cfg.Templates["octane"] = "nginx/octane.conf.tmpl"
+	}
+	if _, ok := cfg.SubdomainTemplates["octane"]; !ok {
+		cfg.SubdomainTemplates["octane"] = "nginx/subdomain_octane.conf.tmpl"
+	}
 	
 	// Versiones soportadas
 	if cfg.PHPVersions == nil || len(cfg.PHPVersions) == 0 {
@@ -294,6 +329,15 @@ func applyDefaults(cfg *Config) {
 	if cfg.NodeVersions == nil || len(cfg.NodeVersions) == 0 {
 		cfg.NodeVersions = []string{"16", "18", "20", "22"}
 	}
+	if cfg.NodeDir == "" {
+		cfg.NodeDir = utils.DefaultNodeDir
+	}
+	if cfg.NodeCacheDir == "" {
+		cfg.NodeCacheDir = utils.DefaultNodeCacheDir
+	}
+	if cfg.NodeMirror == "" {
+		cfg.NodeMirror = utils.DefaultNodeMirror
+	}
 	
 	// Configuraciones avanzadas
 	if cfg.MaxSites == 0 {
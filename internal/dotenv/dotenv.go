@@ -0,0 +1,445 @@
+// internal/dotenv/dotenv.go
+
+// Package dotenv lee y escribe archivos .env sin perder su formato: conserva el orden, los
+// comentarios, las líneas en blanco y las comillas de las variables que no se modifican.
+package dotenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// keyPattern valida el nombre de una variable
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// interpolationPattern reconoce las referencias ${VAR} dentro de un valor
+var interpolationPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+// literalDollar reemplaza en el valor a interpolar los $ que no inician una referencia: los
+// escapados con \$, los de los valores entre comillas simples y los definidos con Set
+const literalDollar = "\x00"
+
+// Var es una variable de un archivo .env
+type Var struct {
+	Key   string
+	Value string
+	// expand es el valor a interpolar; vacío si el valor es literal
+	expand string
+}
+
+// line es una línea lógica del archivo. Las variables entre comillas pueden ocupar varias
+// líneas físicas; raw conserva el texto original para reescribirlo sin cambios.
+type line struct {
+	raw     string
+	key     string
+	value   string
+	expand  string
+	export  bool
+	quote   byte
+	comment string
+	dirty   bool
+}
+
+// isVar indica si la línea define una variable
+func (l *line) isVar() bool {
+	return l.key != ""
+}
+
+// File es el contenido de un archivo .env
+type File struct {
+	lines []*line
+	// finalNewline indica si el archivo termina con un salto de línea
+	finalNewline bool
+}
+
+// New crea un archivo .env vacío
+func New() *File {
+	return &File{finalNewline: true}
+}
+
+// Load lee un archivo .env. Devuelve el error de os.ReadFile si el archivo no existe.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Parse interpreta el contenido de un archivo .env
+func Parse(data []byte) (*File, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	f := &File{finalNewline: text == "" || strings.HasSuffix(text, "\n")}
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return f, nil
+	}
+
+	physical := strings.Split(text, "\n")
+	for i := 0; i < len(physical); i++ {
+		start := i
+		raw := physical[i]
+		l, complete := parseLine(raw)
+		// Un valor entre comillas sin cerrar continúa en las líneas siguientes
+		for !complete && i+1 < len(physical) {
+			i++
+			raw += "\n" + physical[i]
+			l, complete = parseLine(raw)
+		}
+		if !complete {
+			return nil, fmt.Errorf("línea %d: comillas sin cerrar", start+1)
+		}
+		l.raw = raw
+		f.lines = append(f.lines, l)
+	}
+	return f, nil
+}
+
+// parseLine interpreta una línea lógica. complete es false si un valor entre comillas no se cerró.
+func parseLine(raw string) (*line, bool) {
+	l := &line{}
+	text := strings.TrimLeft(raw, " \t")
+	if text == "" || strings.HasPrefix(text, "#") {
+		return l, true
+	}
+	if strings.HasPrefix(text, "export ") {
+		l.export = true
+		text = strings.TrimLeft(strings.TrimPrefix(text, "export "), " \t")
+	}
+	key, rest, ok := strings.Cut(text, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !keyPattern.MatchString(key) {
+		// Las líneas que no son asignaciones se conservan tal cual
+		return &line{}, true
+	}
+	l.key = key
+	rest = strings.TrimLeft(rest, " \t")
+
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		l.quote = rest[0]
+		value, expand, after, closed := readQuoted(rest[1:], l.quote)
+		if !closed {
+			return l, false
+		}
+		l.value, l.expand = value, expand
+		if comment := strings.TrimSpace(after); strings.HasPrefix(comment, "#") {
+			l.comment = comment
+		}
+		return l, true
+	}
+
+	// Sin comillas: un # precedido de espacio inicia un comentario
+	value := rest
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		l.comment = strings.TrimSpace(value[idx:])
+		value = value[:idx]
+	} else if idx := strings.Index(value, "\t#"); idx >= 0 {
+		l.comment = strings.TrimSpace(value[idx:])
+		value = value[:idx]
+	}
+	l.value = strings.TrimSpace(value)
+	l.expand = l.value
+	return l, true
+}
+
+// readQuoted lee un valor hasta la comilla de cierre. Entre comillas dobles se interpretan
+// las secuencias de escape; entre comillas simples el valor es literal. expand es el valor a
+// interpolar, con los $ literales reemplazados por literalDollar.
+func readQuoted(s string, quote byte) (value, expand, after string, closed bool) {
+	var b, e strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == quote {
+			return b.String(), e.String(), s[i+1:], true
+		}
+		if c == '\\' && quote == '"' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+				e.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+				e.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+				e.WriteByte('\t')
+			case '$':
+				b.WriteByte('$')
+				e.WriteString(literalDollar)
+			case '"', '\\':
+				b.WriteByte(s[i])
+				e.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+				e.WriteByte('\\')
+				e.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(c)
+		if c == '$' && quote == '\'' {
+			e.WriteString(literalDollar)
+		} else {
+			e.WriteByte(c)
+		}
+	}
+	return "", "", "", false
+}
+
+// ValidKey indica si un nombre de variable es válido
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// find devuelve la última definición de una variable, que es la que prevalece
+func (f *File) find(key string) *line {
+	for i := len(f.lines) - 1; i >= 0; i-- {
+		if f.lines[i].key == key {
+			return f.lines[i]
+		}
+	}
+	return nil
+}
+
+// Get devuelve el valor de una variable sin interpolar
+func (f *File) Get(key string) (string, bool) {
+	if l := f.find(key); l != nil {
+		return l.value, true
+	}
+	return "", false
+}
+
+// Has indica si el archivo define una variable
+func (f *File) Has(key string) bool {
+	return f.find(key) != nil
+}
+
+// Set define una variable con un valor literal: sus $ se escriben de modo que no se interpolen.
+// Si ya existe se reemplaza en su lugar (conservando export y el comentario de la línea) y se
+// eliminan sus definiciones repetidas; si no, se agrega al final.
+func (f *File) Set(key, value string) {
+	f.set(key, value, strings.ReplaceAll(value, "$", literalDollar))
+}
+
+// SetVar define una variable obtenida de otro archivo con Vars, conservando sus referencias
+// ${VAR} para que se interpolen en este archivo
+func (f *File) SetVar(v Var) {
+	if v.expand == "" {
+		f.Set(v.Key, v.Value)
+		return
+	}
+	f.set(v.Key, v.Value, v.expand)
+}
+
+// set define una variable con su valor y el valor a interpolar
+func (f *File) set(key, value, expand string) {
+	target := f.find(key)
+	if target == nil {
+		f.lines = append(f.lines, &line{key: key, value: value, expand: expand, dirty: true})
+		return
+	}
+	if target.value != value || target.expand != expand {
+		target.value, target.expand = value, expand
+		target.dirty = true
+	}
+	kept := f.lines[:0]
+	for _, l := range f.lines {
+		if l.key != key || l == target {
+			kept = append(kept, l)
+		}
+	}
+	f.lines = kept
+}
+
+// Unset elimina todas las definiciones de una variable. Devuelve false si no existía.
+func (f *File) Unset(key string) bool {
+	found := false
+	kept := f.lines[:0]
+	for _, l := range f.lines {
+		if l.key == key {
+			found = true
+			continue
+		}
+		kept = append(kept, l)
+	}
+	f.lines = kept
+	return found
+}
+
+// AddComment agrega una línea de comentario al final del archivo
+func (f *File) AddComment(text string) {
+	f.lines = append(f.lines, &line{raw: "# " + text})
+}
+
+// HasComment indica si el archivo tiene una línea de comentario con el texto indicado
+func (f *File) HasComment(text string) bool {
+	for _, l := range f.lines {
+		if !l.isVar() && strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l.raw), "#")) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBlank agrega una línea en blanco al final del archivo si la anterior no lo es
+func (f *File) AddBlank() {
+	if n := len(f.lines); n > 0 && (f.lines[n-1].isVar() || strings.TrimSpace(f.lines[n-1].raw) != "") {
+		f.lines = append(f.lines, &line{})
+	}
+}
+
+// Keys devuelve los nombres de las variables en el orden de su primera aparición
+func (f *File) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, l := range f.lines {
+		if l.isVar() && !seen[l.key] {
+			seen[l.key] = true
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+// Vars devuelve las variables en orden con el valor que prevalece, sin interpolar
+func (f *File) Vars() []Var {
+	keys := f.Keys()
+	vars := make([]Var, 0, len(keys))
+	for _, key := range keys {
+		l := f.find(key)
+		vars = append(vars, Var{Key: key, Value: l.value, expand: l.expand})
+	}
+	return vars
+}
+
+// Map devuelve las variables sin interpolar
+func (f *File) Map() map[string]string {
+	values := make(map[string]string)
+	for _, l := range f.lines {
+		if l.isVar() {
+			values[l.key] = l.value
+		}
+	}
+	return values
+}
+
+// Resolve devuelve las variables con las referencias ${VAR} resueltas, como lo hacen Laravel y
+// dotenv-expand: cada variable puede usar las definidas antes en el archivo o las del entorno
+// del proceso. Los valores entre comillas simples y los $ escapados no se interpolan.
+func (f *File) Resolve() map[string]string {
+	values := make(map[string]string)
+	for _, l := range f.lines {
+		if !l.isVar() {
+			continue
+		}
+		resolved := interpolationPattern.ReplaceAllStringFunc(l.expand, func(ref string) string {
+			name := interpolationPattern.FindStringSubmatch(ref)[1]
+			if value, ok := values[name]; ok {
+				return value
+			}
+			return os.Getenv(name)
+		})
+		values[l.key] = strings.ReplaceAll(resolved, literalDollar, "$")
+	}
+	return values
+}
+
+// Bytes devuelve el contenido del archivo. Las líneas sin modificar se escriben tal como se leyeron.
+func (f *File) Bytes() []byte {
+	var b strings.Builder
+	for i, l := range f.lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		if l.isVar() && l.dirty {
+			b.WriteString(l.format())
+		} else {
+			b.WriteString(l.raw)
+		}
+	}
+	if len(f.lines) > 0 && f.finalNewline {
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// Write guarda el archivo de forma atómica con los permisos indicados
+func (f *File) Write(path string, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".env-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error al crear archivo temporal: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(f.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error al escribir %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error al escribir %s: %v", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("error al cambiar permisos de %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error al guardar %s: %v", path, err)
+	}
+	return nil
+}
+
+// format escribe una variable modificada con las comillas que necesita su valor
+func (l *line) format() string {
+	var b strings.Builder
+	if l.export {
+		b.WriteString("export ")
+	}
+	b.WriteString(l.key)
+	b.WriteByte('=')
+	b.WriteString(quoteExpand(l.value, l.expand, l.quote))
+	if l.comment != "" {
+		b.WriteByte(' ')
+		b.WriteString(l.comment)
+	}
+	return b.String()
+}
+
+// Quote escribe un valor literal para un archivo .env. Se conservan las comillas simples
+// preferidas si el valor puede escribirse literalmente, y los valores con $ sin comillas
+// preferidas también se escriben entre comillas simples para que no se interpolen. Si no, se
+// usan comillas dobles, con los $ escapados, cuando el valor tiene espacios, comentarios,
+// comillas, $ o saltos de línea.
+func Quote(value string, preferred byte) string {
+	simple := preferred == '\'' || (preferred == 0 && strings.Contains(value, "$"))
+	if simple && !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	if preferred != '"' && value != "" && !strings.ContainsAny(value, " \t#'\"\\$\n\r") {
+		return value
+	}
+	if value == "" && preferred != '"' {
+		return ""
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`).Replace(value)
+	return `"` + escaped + `"`
+}
+
+// quoteExpand escribe un valor con referencias ${VAR}: sin comillas o entre comillas dobles,
+// para que se interpolen, con los $ literales escapados
+func quoteExpand(value, expand string, preferred byte) string {
+	if !strings.Contains(expand, "$") {
+		return Quote(value, preferred)
+	}
+	if preferred != '"' && !strings.ContainsAny(expand, " \t#'\"\\\n\r"+literalDollar) {
+		return expand
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, literalDollar, `\$`, "\n", `\n`, "\r", `\r`).Replace(expand)
+	return `"` + escaped + `"`
+}
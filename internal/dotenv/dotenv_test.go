@@ -0,0 +1,184 @@
+// internal/dotenv/dotenv_test.go
+package dotenv
+
+import (
+	"strings"
+	"testing"
+)
+
+// sample tiene comentarios, export, valores de varias líneas, secuencias de escape, $ y
+// variables repetidas
+const sample = `# Configuración de la aplicación
+APP_NAME="Mi App"
+export APP_ENV=production # entorno
+
+APP_URL=https://example.com
+ASSET_URL="${APP_URL}/assets"
+PRICE="\$5 por ${APP_NAME}"
+LITERAL='${APP_URL} sin interpolar'
+CERT="-----BEGIN-----
+abc
+-----END-----"
+ESCAPES="tab\tcomilla\"barra\\fin\n"
+DUPLICATE=first
+DUPLICATE=second
+`
+
+func mustParse(t *testing.T, data string) *File {
+	t.Helper()
+	f, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return f
+}
+
+// reparse escribe el archivo y lo vuelve a leer
+func reparse(t *testing.T, f *File) *File {
+	t.Helper()
+	return mustParse(t, string(f.Bytes()))
+}
+
+func TestParsePreservesContent(t *testing.T) {
+	f := mustParse(t, sample)
+	if got := string(f.Bytes()); got != sample {
+		t.Errorf("Bytes() cambió el archivo sin modificar:\n%s", got)
+	}
+}
+
+func TestGet(t *testing.T) {
+	f := mustParse(t, sample)
+	tests := map[string]string{
+		"APP_NAME":    "Mi App",
+		"APP_ENV":     "production",
+		"ASSET_URL":   "${APP_URL}/assets",
+		"PRICE":       "$5 por ${APP_NAME}",
+		"LITERAL":     "${APP_URL} sin interpolar",
+		"CERT":        "-----BEGIN-----\nabc\n-----END-----",
+		"ESCAPES":     "tab\tcomilla\"barra\\fin\n",
+		"DUPLICATE":   "second",
+		"NOT_DEFINED": "",
+	}
+	for key, want := range tests {
+		got, ok := f.Get(key)
+		if ok != (key != "NOT_DEFINED") || got != want {
+			t.Errorf("Get(%s) = %q, %v; se esperaba %q", key, got, ok, want)
+		}
+	}
+	if keys := strings.Join(f.Keys(), ","); !strings.HasSuffix(keys, "ESCAPES,DUPLICATE") {
+		t.Errorf("Keys() = %s; DUPLICATE debe aparecer una vez", keys)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	values := mustParse(t, sample).Resolve()
+	tests := map[string]string{
+		"ASSET_URL": "https://example.com/assets",
+		"PRICE":     "$5 por Mi App",
+		"LITERAL":   "${APP_URL} sin interpolar",
+	}
+	for key, want := range tests {
+		if got := values[key]; got != want {
+			t.Errorf("Resolve()[%s] = %q; se esperaba %q", key, got, want)
+		}
+	}
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"simple",
+		"con espacios",
+		"valor # no es comentario",
+		"pa$$word",
+		"${APP_URL}/literal",
+		"$ y 'comillas simples'",
+		`comillas "dobles" y \barras\`,
+		"varias\nlíneas\r\ny $HOME",
+		"tab\tfinal",
+	}
+	for _, quote := range []string{"", "'", `"`} {
+		for _, value := range values {
+			f := mustParse(t, "APP_URL=https://example.com\nKEY="+quote+"previo"+quote+"\n")
+			f.Set("KEY", value)
+			got := reparse(t, f)
+			if v, _ := got.Get("KEY"); v != value {
+				t.Errorf("Set(%q) con comillas %q: Get = %q\n%s", value, quote, v, f.Bytes())
+			}
+			if v := got.Resolve()["KEY"]; v != value {
+				t.Errorf("Set(%q) con comillas %q: Resolve = %q\n%s", value, quote, v, f.Bytes())
+			}
+		}
+	}
+}
+
+// Set reemplaza la definición que prevalece y elimina las repetidas
+func TestSetKeepsExportAndComment(t *testing.T) {
+	f := mustParse(t, "KEY=dup\nOTHER=1\nexport KEY=old # comentario\n")
+	f.Set("KEY", "nuevo valor")
+	want := "OTHER=1\nexport KEY=\"nuevo valor\" # comentario\n"
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() = %q; se esperaba %q", got, want)
+	}
+}
+
+func TestUnset(t *testing.T) {
+	f := mustParse(t, "A=1\nB=2\nA=3\n")
+	if !f.Unset("A") || f.Has("A") {
+		t.Fatal("Unset(A) no eliminó todas las definiciones")
+	}
+	if f.Unset("A") {
+		t.Error("Unset(A) devolvió true para una variable inexistente")
+	}
+	if got := string(f.Bytes()); got != "B=2\n" {
+		t.Errorf("Bytes() = %q", got)
+	}
+}
+
+func TestSetVarKeepsReferences(t *testing.T) {
+	source := mustParse(t, `URL="${HOST}/api"`+"\nPRICE=\"\\$5 ${CURRENCY}\"\nRAW='$x'\n")
+	f := mustParse(t, "HOST=example.com\nCURRENCY=USD\n")
+	for _, v := range source.Vars() {
+		f.SetVar(v)
+	}
+	values := reparse(t, f).Resolve()
+	tests := map[string]string{
+		"URL":   "example.com/api",
+		"PRICE": "$5 USD",
+		"RAW":   "$x",
+	}
+	for key, want := range tests {
+		if got := values[key]; got != want {
+			t.Errorf("Resolve()[%s] = %q; se esperaba %q\n%s", key, got, want, f.Bytes())
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value     string
+		preferred byte
+		want      string
+	}{
+		{"simple", 0, "simple"},
+		{"", 0, ""},
+		{"", '"', `""`},
+		{"con espacios", 0, `"con espacios"`},
+		{"pa$word", 0, "'pa$word'"},
+		{"pa$word", '"', `"pa\$word"`},
+		{"it's $5", 0, `"it's \$5"`},
+		{"literal", '\'', "'literal'"},
+		{"a\nb", '\'', `"a\nb"`},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.value, tt.preferred); got != tt.want {
+			t.Errorf("Quote(%q, %q) = %s; se esperaba %s", tt.value, tt.preferred, got, tt.want)
+		}
+	}
+}
+
+func TestParseUnclosedQuote(t *testing.T) {
+	if _, err := Parse([]byte("KEY=\"sin cerrar\nOTHER=1\n")); err == nil {
+		t.Error("Parse aceptó comillas sin cerrar")
+	}
+}
@@ -0,0 +1,234 @@
+// internal/utils/backupcrypt.go
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Las copias cifradas son una secuencia de bloques AES-256-GCM de hasta backupChunkSize bytes.
+// Cada bloque usa como nonce un prefijo aleatorio y su número de orden, y el último se marca en
+// los datos autenticados para detectar copias truncadas.
+const (
+	backupKeyFile   = "backup.key"
+	backupMagic     = "SMBACKUP1\n"
+	backupChunkSize = 64 * 1024
+)
+
+// BackupKeyPath devuelve la clave con la que se cifran las copias de seguridad. Es distinta de
+// la clave de los secretos para que rotar aquella no deje las copias ilegibles.
+func BackupKeyPath() string {
+	return filepath.Join(SecretsKeyDir, backupKeyFile)
+}
+
+// backupKey lee la clave de las copias de seguridad y la crea si create es true y no existe
+func backupKey(create bool) ([]byte, error) {
+	key, err := readMasterKey(BackupKeyPath())
+	switch {
+	case err == nil:
+		return key, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	case !create:
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("no existe la clave de las copias cifradas %s", BackupKeyPath()), err)
+	}
+	key, created, err := createMasterKey(BackupKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		fmt.Printf("Clave de las copias cifradas creada en %s; guarde una copia fuera del servidor\n", BackupKeyPath())
+	}
+	return key, nil
+}
+
+// EnsureBackupKey crea la clave de las copias cifradas si no existe. Se llama antes de copiar
+// varios sitios a la vez para que todas las copias usen la misma clave.
+func EnsureBackupKey() error {
+	_, err := backupKey(true)
+	return err
+}
+
+// backupGCM prepara el cifrador de las copias
+func backupGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupNonce devuelve el nonce de un bloque a partir del prefijo y su número de orden
+func backupNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[8:], counter)
+	return nonce
+}
+
+// backupAAD marca el último bloque de la copia
+func backupAAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// backupEncrypter cifra por bloques lo que se escribe en él
+type backupEncrypter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+// NewBackupEncrypter devuelve un escritor que cifra con la clave de las copias de seguridad,
+// creándola si no existe. Close escribe el último bloque; sin él la copia no puede descifrarse.
+func NewBackupEncrypter(w io.Writer) (io.WriteCloser, error) {
+	key, err := backupKey(true)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := backupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("error al generar el nonce: %v", err)
+	}
+	id, _ := hex.DecodeString(keyID(key))
+	header := append(append([]byte(backupMagic), id...), prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &backupEncrypter{w: w, gcm: gcm, prefix: prefix, buf: make([]byte, 0, backupChunkSize)}, nil
+}
+
+func (e *backupEncrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// Un bloque lleno solo se escribe cuando llegan más datos, así el último queda para Close
+		if len(e.buf) == backupChunkSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):backupChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// flush cifra y escribe el bloque pendiente
+func (e *backupEncrypter) flush(last bool) error {
+	sealed := e.gcm.Seal(nil, backupNonce(e.prefix, e.counter), e.buf, backupAAD(last))
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *backupEncrypter) Close() error {
+	return e.flush(true)
+}
+
+// backupDecrypter descifra una copia bloque a bloque
+type backupDecrypter struct {
+	r       *bufio.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+// IsEncryptedBackup indica si el contenido comienza como una copia cifrada por SiteManager
+func IsEncryptedBackup(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(backupMagic))
+}
+
+// NewBackupDecrypter devuelve un lector que descifra una copia con la clave de las copias de
+// seguridad. Devuelve un error si la copia está dañada, truncada o se cifró con otra clave.
+func NewBackupDecrypter(r io.Reader) (io.Reader, error) {
+	key, err := backupKey(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := backupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(backupMagic)+16)
+	if _, err := io.ReadFull(r, header); err != nil || !IsEncryptedBackup(header) {
+		return nil, NewError(ErrorValidacion, "la copia no está cifrada por SiteManager o está dañada", err)
+	}
+	if id := hex.EncodeToString(header[len(backupMagic) : len(backupMagic)+8]); id != keyID(key) {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("la copia se cifró con otra clave (%s)", id), nil)
+	}
+	return &backupDecrypter{r: bufio.NewReader(r), gcm: gcm, prefix: header[len(backupMagic)+8:]}, nil
+}
+
+func (d *backupDecrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next lee y descifra el siguiente bloque
+func (d *backupDecrypter) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return fmt.Errorf("la copia cifrada está truncada")
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > backupChunkSize+uint32(d.gcm.Overhead()) {
+		return fmt.Errorf("la copia cifrada está dañada")
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("la copia cifrada está truncada")
+	}
+
+	nonce := backupNonce(d.prefix, d.counter)
+	plain, err := d.gcm.Open(nil, nonce, sealed, backupAAD(false))
+	if err != nil {
+		if plain, err = d.gcm.Open(nil, nonce, sealed, backupAAD(true)); err != nil {
+			return fmt.Errorf("la copia cifrada está dañada o se modificó")
+		}
+		d.done = true
+		if _, err := d.r.Peek(1); err != io.EOF {
+			return fmt.Errorf("la copia cifrada tiene datos después del último bloque")
+		}
+	}
+	d.counter++
+	d.plain = plain
+	return nil
+}
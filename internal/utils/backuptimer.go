@@ -0,0 +1,95 @@
+// internal/utils/backuptimer.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// backupTimerUnit es el nombre de las unidades que ejecutan las copias programadas
+const backupTimerUnit = "sm-backup-db"
+
+// backupServiceTemplate ejecuta 'sm backup db --all' con baja prioridad de CPU y disco
+const backupServiceTemplate = `# Generado por SiteManager
+[Unit]
+Description=SiteManager: copias de seguridad de las bases de datos
+After=network.target postgresql.service mysql.service mariadb.service
+
+[Service]
+Type=oneshot
+ExecStart=%s
+Nice=10
+IOSchedulingClass=idle
+`
+
+// backupTimerTemplate programa el servicio; Persistent recupera las ejecuciones perdidas
+const backupTimerTemplate = `# Generado por SiteManager
+[Unit]
+Description=SiteManager: programa de copias de seguridad de las bases de datos
+
+[Timer]
+OnCalendar=%s
+RandomizedDelaySec=15min
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+
+// BackupTimerName devuelve el nombre del timer de las copias programadas
+func BackupTimerName() string {
+	return backupTimerUnit + ".timer"
+}
+
+// InstallBackupTimer instala y activa un timer de systemd que ejecuta el comando indicado
+// según onCalendar (por ejemplo "daily" o "*-*-* 03:00:00")
+func InstallBackupTimer(onCalendar string, command []string) error {
+	if strings.ContainsAny(onCalendar, "\n\r") {
+		return NewError(ErrorValidacion, fmt.Sprintf("programación inválida: %q", onCalendar), nil)
+	}
+	if output, err := exec.Command("systemd-analyze", "calendar", onCalendar).CombinedOutput(); err != nil {
+		return NewError(ErrorValidacion, fmt.Sprintf("programación inválida: %q", onCalendar), fmt.Errorf("%v\n%s", err, output))
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		escaped, err := systemdEscape(arg)
+		if err != nil {
+			return err
+		}
+		quoted[i] = `"` + escaped + `"`
+	}
+	units := map[string]string{
+		backupTimerUnit + ".service": fmt.Sprintf(backupServiceTemplate, strings.Join(quoted, " ")),
+		BackupTimerName():            fmt.Sprintf(backupTimerTemplate, onCalendar),
+	}
+	for name, content := range units {
+		if err := os.WriteFile(filepath.Join(systemdUnitDir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("error al escribir la unidad %s: %v", name, err)
+		}
+	}
+
+	manager := &SystemdManager{}
+	if err := manager.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return manager.systemctl("enable", "--now", BackupTimerName())
+}
+
+// RemoveBackupTimer desactiva y elimina el timer de las copias programadas
+func RemoveBackupTimer() error {
+	timer := filepath.Join(systemdUnitDir, BackupTimerName())
+	if !PathExists(timer) {
+		return NewError(ErrorValidacion, "las copias programadas no están instaladas", nil)
+	}
+	exec.Command("systemctl", "disable", "--now", BackupTimerName()).Run()
+	for _, name := range []string{BackupTimerName(), backupTimerUnit + ".service"} {
+		if err := os.Remove(filepath.Join(systemdUnitDir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error al eliminar la unidad %s: %v", name, err)
+		}
+	}
+	return (&SystemdManager{}).systemctl("daemon-reload")
+}
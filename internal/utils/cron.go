@@ -0,0 +1,72 @@
+// internal/utils/cron.go
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// cronMarkers devuelve las líneas que delimitan el bloque de cron de un sitio
+func cronMarkers(domain, name string) (string, string) {
+	return fmt.Sprintf("# BEGIN SiteManager %s %s", domain, name),
+		fmt.Sprintf("# END SiteManager %s %s", domain, name)
+}
+
+// SetUserCron agrega, reemplaza o (con entry vacío) elimina una entrada del crontab de un
+// usuario. Cada entrada se identifica por sitio y nombre para que los subdominios del mismo
+// usuario no se pisen.
+func SetUserCron(user, domain, name, entry string) error {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		if entry == "" {
+			return nil
+		}
+		return NewError(ErrorValidacion, "cron no está instalado (apt install cron)", nil)
+	}
+
+	output, err := exec.Command("crontab", "-l", "-u", user).CombinedOutput()
+	current := string(output)
+	if err != nil {
+		if !strings.Contains(current, "no crontab") {
+			return NewError(ErrorComando, fmt.Sprintf("error al leer el crontab de %s", user), fmt.Errorf("%v\n%s", err, output))
+		}
+		current = ""
+	}
+
+	begin, end := cronMarkers(domain, name)
+	var lines []string
+	skipping := false
+	for _, line := range strings.Split(strings.TrimRight(current, "\n"), "\n") {
+		switch {
+		case line == begin:
+			skipping = true
+		case line == end:
+			skipping = false
+		case !skipping && (line != "" || len(lines) > 0):
+			lines = append(lines, line)
+		}
+	}
+	if entry != "" {
+		lines = append(lines, begin, entry, end)
+	}
+
+	updated := strings.Join(lines, "\n")
+	if updated != "" {
+		updated += "\n"
+	}
+	if updated == current {
+		return nil
+	}
+
+	cmd := exec.Command("crontab", "-u", user, "-")
+	cmd.Stdin = strings.NewReader(updated)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("error al actualizar el crontab de %s", user), fmt.Errorf("%v\n%s", err, output))
+	}
+	return nil
+}
+
+// LaravelSchedulerEntry devuelve la entrada de cron que ejecuta el programador de Laravel cada minuto
+func LaravelSchedulerEntry(appDir, php string) string {
+	return fmt.Sprintf("* * * * * cd %s && %s artisan schedule:run >> /dev/null 2>&1", appDir, php)
+}
@@ -3,7 +3,6 @@ package utils
 
 import (
 	"fmt"
-	"os/exec"
 	"strings"
 )
 
@@ -56,53 +55,39 @@ func CreateDatabase(opts *DatabaseOptions) error {
 
 // createPostgreSQLDatabase crea una base de datos PostgreSQL si no existe
 func createPostgreSQLDatabase(opts *DatabaseOptions) error {
-	// Verificar si la base de datos ya existe
-	checkCmd := fmt.Sprintf("psql -U postgres -c \"SELECT 1 FROM pg_database WHERE datname='%s'\" | grep -q 1", opts.Name)
-	cmd := exec.Command("bash", "-c", checkCmd)
+	if err := validateDatabaseOptions(opts); err != nil {
+		return err
+	}
+	if opts.Schema != "" && opts.Schema != "public" {
+		if err := ValidateDatabaseIdentifier("esquema", opts.Schema, DBTypePostgreSQL); err != nil {
+			return err
+		}
+	}
 
-	if err := cmd.Run(); err == nil {
-		// La base de datos ya existe
+	server := postgresServer{}
+	exists, err := server.DatabaseExists(opts.Name)
+	if err != nil {
+		return fmt.Errorf("error al verificar la base de datos PostgreSQL: %v", err)
+	}
+	if exists {
 		fmt.Printf("Base de datos PostgreSQL '%s' ya existe\n", opts.Name)
 		return nil
 	}
 
-	// Crear base de datos
-	createCmd := fmt.Sprintf("psql -U postgres -c \"CREATE DATABASE %s;\"", opts.Name)
-	cmd = exec.Command("bash", "-c", createCmd)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al crear base de datos PostgreSQL: %v\n%s", err, output)
-	}
-
 	// Crear usuario si no existe
-	checkUserCmd := fmt.Sprintf("psql -U postgres -c \"SELECT 1 FROM pg_roles WHERE rolname='%s'\" | grep -q 1", opts.User)
-	cmd = exec.Command("bash", "-c", checkUserCmd)
-
-	if err := cmd.Run(); err != nil {
-		// El usuario no existe, crearlo
-		createUserCmd := fmt.Sprintf("psql -U postgres -c \"CREATE USER %s WITH ENCRYPTED PASSWORD '%s';\"", opts.User, opts.Password)
-		cmd = exec.Command("bash", "-c", createUserCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("error al crear usuario PostgreSQL: %v\n%s", err, output)
-		}
+	if err := ensureDatabaseUser(server, opts); err != nil {
+		return err
 	}
-
-	// Asignar privilegios
-	grantCmd := fmt.Sprintf("psql -U postgres -c \"GRANT ALL PRIVILEGES ON DATABASE %s TO %s;\"", opts.Name, opts.User)
-	cmd = exec.Command("bash", "-c", grantCmd)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al asignar privilegios: %v\n%s", err, output)
+	if err := server.CreateDatabase(opts.Name, opts.User); err != nil {
+		return err
 	}
 
 	// Crear schema si se especifica
 	if opts.Schema != "" && opts.Schema != "public" {
-		schemaCmd := fmt.Sprintf("psql -U postgres -d %s -c \"CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s;\"", opts.Name, opts.Schema, opts.User)
-		cmd = exec.Command("bash", "-c", schemaCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("error al crear schema: %v\n%s", err, output)
+		sql := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s;\n",
+			quoteIdent(DBTypePostgreSQL, opts.Schema), quoteIdent(DBTypePostgreSQL, opts.User))
+		if _, err := server.psql(opts.Name, sql); err != nil {
+			return fmt.Errorf("error al crear schema: %v", err)
 		}
 	}
 
@@ -112,17 +97,10 @@ func createPostgreSQLDatabase(opts *DatabaseOptions) error {
 
 // createMySQLDatabase crea una base de datos MySQL si no existe
 func createMySQLDatabase(opts *DatabaseOptions) error {
-	// Verificar si la base de datos ya existe
-	checkCmd := fmt.Sprintf("mysql -u root -e \"SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME='%s'\" | grep -q %s", opts.Name, opts.Name)
-	cmd := exec.Command("bash", "-c", checkCmd)
-
-	if err := cmd.Run(); err == nil {
-		// La base de datos ya existe
-		fmt.Printf("Base de datos MySQL '%s' ya existe\n", opts.Name)
-		return nil
+	if err := validateDatabaseOptions(opts); err != nil {
+		return err
 	}
 
-	// Crear base de datos
 	charset := "utf8mb4"
 	collation := "utf8mb4_unicode_ci"
 
@@ -134,39 +112,61 @@ func createMySQLDatabase(opts *DatabaseOptions) error {
 		collation = opts.Collation
 	}
 
-	createCmd := fmt.Sprintf("mysql -u root -e \"CREATE DATABASE %s CHARACTER SET %s COLLATE %s;\"", opts.Name, charset, collation)
-	cmd = exec.Command("bash", "-c", createCmd)
-
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al crear base de datos MySQL: %v\n%s", err, output)
+	// Charset y collation no admiten comillas en SQL, así que se restringen a nombres simples
+	for _, name := range []string{charset, collation} {
+		if !dbIdentifierPattern.MatchString(strings.ToLower(name)) {
+			return NewError(ErrorValidacion, fmt.Sprintf("charset o collation inválido: %q", name), nil)
+		}
 	}
 
-	// Crear usuario si no existe
-	checkUserCmd := fmt.Sprintf("mysql -u root -e \"SELECT User FROM mysql.user WHERE User='%s'\" | grep -q %s", opts.User, opts.User)
-	cmd = exec.Command("bash", "-c", checkUserCmd)
-
-	if err := cmd.Run(); err != nil {
-		// El usuario no existe, crearlo
-		createUserCmd := fmt.Sprintf("mysql -u root -e \"CREATE USER '%s'@'localhost' IDENTIFIED BY '%s';\"", opts.User, opts.Password)
-		cmd = exec.Command("bash", "-c", createUserCmd)
-
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("error al crear usuario MySQL: %v\n%s", err, output)
-		}
+	server := mysqlServer{}
+	exists, err := server.DatabaseExists(opts.Name)
+	if err != nil {
+		return fmt.Errorf("error al verificar la base de datos MySQL: %v", err)
+	}
+	if exists {
+		fmt.Printf("Base de datos MySQL '%s' ya existe\n", opts.Name)
+		return nil
 	}
 
-	// Asignar privilegios
-	grantCmd := fmt.Sprintf("mysql -u root -e \"GRANT ALL PRIVILEGES ON %s.* TO '%s'@'localhost'; FLUSH PRIVILEGES;\"", opts.Name, opts.User)
-	cmd = exec.Command("bash", "-c", grantCmd)
+	sql := fmt.Sprintf("CREATE DATABASE %s CHARACTER SET %s COLLATE %s;\n", quoteIdent(DBTypeMySQL, opts.Name), charset, collation)
+	if _, err := server.mysql(sql); err != nil {
+		return fmt.Errorf("error al crear base de datos MySQL: %v", err)
+	}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error al asignar privilegios: %v\n%s", err, output)
+	// Crear usuario si no existe y asignarle la base de datos
+	if err := ensureDatabaseUser(server, opts); err != nil {
+		return err
+	}
+	if err := server.Grant(opts.Name, opts.User); err != nil {
+		return err
 	}
 
 	fmt.Printf("Base de datos MySQL '%s' creada correctamente\n", opts.Name)
 	return nil
 }
 
+// validateDatabaseOptions verifica los nombres de la base de datos y del usuario antes de
+// usarlos en SQL
+func validateDatabaseOptions(opts *DatabaseOptions) error {
+	if err := ValidateDatabaseIdentifier("base de datos", opts.Name, opts.Type); err != nil {
+		return err
+	}
+	return ValidateDatabaseIdentifier("usuario", opts.User, opts.Type)
+}
+
+// ensureDatabaseUser crea el usuario de la base de datos si no existe
+func ensureDatabaseUser(server DatabaseServer, opts *DatabaseOptions) error {
+	exists, err := server.UserExists(opts.User)
+	if err != nil {
+		return fmt.Errorf("error al verificar el usuario %s: %v", opts.User, err)
+	}
+	if exists {
+		return nil
+	}
+	return server.CreateUser(opts.User, opts.Password)
+}
+
 // ParseDatabaseURL analiza una URL de conexión a base de datos y devuelve las opciones
 func ParseDatabaseURL(url string) (*DatabaseOptions, error) {
 	opts := &DatabaseOptions{
@@ -0,0 +1,324 @@
+// internal/utils/dbbackup.go
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat es el formato de la fecha en el nombre de las copias
+const backupTimeFormat = "20060102-150405"
+
+// backupNamePattern reconoce las copias de bases de datos: <base>-<fecha>.<extensión>[.enc]
+var backupNamePattern = regexp.MustCompile(`^([a-z_][a-z0-9_]*)-(\d{8}-\d{6})(\.dump|\.sql\.gz)(\.enc)?$`)
+
+// DatabaseBackup es una copia de seguridad de una base de datos
+type DatabaseBackup struct {
+	Path      string
+	Database  string
+	Engine    DatabaseType
+	CreatedAt time.Time
+	Encrypted bool
+	Size      int64
+}
+
+// BackupRetention indica cuántas copias diarias, semanales y mensuales se conservan. Se
+// conserva la copia más reciente de cada día, semana o mes, y siempre la última.
+type BackupRetention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// Enabled indica si la política elimina copias
+func (r BackupRetention) Enabled() bool {
+	return r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0
+}
+
+// Expired devuelve las copias que la política no conserva. backups debe estar ordenado de la
+// más reciente a la más antigua.
+func (r BackupRetention) Expired(backups []DatabaseBackup) []DatabaseBackup {
+	if !r.Enabled() || len(backups) == 0 {
+		return nil
+	}
+
+	keep := map[string]bool{backups[0].Path: true}
+	periods := []struct {
+		limit int
+		key   func(t time.Time) string
+	}{
+		{r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{r.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, period := range periods {
+		seen := make(map[string]bool)
+		for _, backup := range backups {
+			key := period.key(backup.CreatedAt)
+			if len(seen) >= period.limit {
+				break
+			}
+			if !seen[key] {
+				seen[key] = true
+				keep[backup.Path] = true
+			}
+		}
+	}
+
+	var expired []DatabaseBackup
+	for _, backup := range backups {
+		if !keep[backup.Path] {
+			expired = append(expired, backup)
+		}
+	}
+	return expired
+}
+
+// BackupDatabase guarda una copia de la base de datos en dir, cifrada si encrypt es true. La
+// copia se escribe en un archivo temporal que solo root puede leer y se renombra al terminar.
+func BackupDatabase(db SiteDatabase, dir string, encrypt bool) (*DatabaseBackup, error) {
+	server, err := NewDatabaseServer(db.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de copias %s: %v", dir, err)
+	}
+
+	backup := &DatabaseBackup{Database: db.Name, Engine: db.Engine, CreatedAt: time.Now(), Encrypted: encrypt}
+	name := db.Name + "-" + backup.CreatedAt.Format(backupTimeFormat) + server.DumpExtension()
+	if encrypt {
+		name += ".enc"
+	}
+	backup.Path = filepath.Join(dir, name)
+
+	tmp := backup.Path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear %s: %v", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	var w io.Writer = file
+	var encrypter io.WriteCloser
+	if encrypt {
+		if encrypter, err = NewBackupEncrypter(file); err != nil {
+			return nil, err
+		}
+		w = encrypter
+	}
+	if err := server.Dump(db.Name, w); err != nil {
+		return nil, err
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return nil, fmt.Errorf("error al cifrar la copia: %v", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("error al escribir %s: %v", tmp, err)
+	}
+	if info, err := file.Stat(); err == nil {
+		backup.Size = info.Size()
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("error al escribir %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, backup.Path); err != nil {
+		return nil, fmt.Errorf("error al guardar la copia: %v", err)
+	}
+	return backup, nil
+}
+
+// ListDatabaseBackups devuelve las copias de una base de datos guardadas en dir, de la más
+// reciente a la más antigua. Sin nombre devuelve las de todas las bases de datos.
+func ListDatabaseBackups(dir, database string) ([]DatabaseBackup, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el directorio de copias %s: %v", dir, err)
+	}
+
+	var backups []DatabaseBackup
+	for _, entry := range entries {
+		backup, ok := ParseBackupName(filepath.Join(dir, entry.Name()))
+		if !ok || entry.IsDir() || (database != "" && backup.Database != database) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// ParseBackupName obtiene la base de datos, la fecha y el formato de una copia por su nombre
+func ParseBackupName(path string) (DatabaseBackup, bool) {
+	match := backupNamePattern.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return DatabaseBackup{}, false
+	}
+	createdAt, err := time.ParseInLocation(backupTimeFormat, match[2], time.Local)
+	if err != nil {
+		return DatabaseBackup{}, false
+	}
+	engine := DBTypePostgreSQL
+	if strings.HasPrefix(match[3], ".sql") {
+		engine = DBTypeMySQL
+	}
+	return DatabaseBackup{Path: path, Database: match[1], Engine: engine, CreatedAt: createdAt, Encrypted: match[4] != ""}, true
+}
+
+// PruneDatabaseBackups elimina las copias de una base de datos que la política no conserva y
+// devuelve las eliminadas
+func PruneDatabaseBackups(dir, database string, retention BackupRetention) ([]DatabaseBackup, error) {
+	backups, err := ListDatabaseBackups(dir, database)
+	if err != nil {
+		return nil, err
+	}
+	expired := retention.Expired(backups)
+	for _, backup := range expired {
+		if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error al eliminar la copia %s: %v", backup.Path, err)
+		}
+	}
+	return expired, nil
+}
+
+// backupReader lee una copia y cierra su archivo al terminar
+type backupReader struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenDatabaseBackup abre una copia para leerla, descifrándola si está cifrada
+func OpenDatabaseBackup(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir la copia %s: %v", path, err)
+	}
+	reader := bufio.NewReader(file)
+	header, _ := reader.Peek(len(backupMagic))
+	if !IsEncryptedBackup(header) {
+		return backupReader{reader, file}, nil
+	}
+	decrypter, err := NewBackupDecrypter(reader)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return backupReader{decrypter, file}, nil
+}
+
+// verifyDatabaseBackup lee la copia completa para detectar daños antes de vaciar la base de
+// datos de destino
+func verifyDatabaseBackup(path string, engine DatabaseType) error {
+	backup, err := OpenDatabaseBackup(path)
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	var r io.Reader = backup
+	if engine == DBTypeMySQL {
+		gz, err := gzip.NewReader(backup)
+		if err != nil {
+			return fmt.Errorf("la copia no es un archivo gzip válido: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("la copia %s está dañada: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// RestoreDatabase reemplaza el contenido de la base de datos por el de una copia, cargada
+// con el usuario de la base de datos y su contraseña
+func RestoreDatabase(db SiteDatabase, password, path string) error {
+	if parsed, ok := ParseBackupName(path); ok && parsed.Engine != db.Engine {
+		return NewError(ErrorValidacion, fmt.Sprintf("la copia es de %s y la base de datos %s es %s", parsed.Engine, db.Name, db.Engine), nil)
+	}
+	if err := checkRestorePassword(db, password); err != nil {
+		return err
+	}
+	server, err := NewDatabaseServer(db.Engine)
+	if err != nil {
+		return err
+	}
+	if err := verifyDatabaseBackup(path, db.Engine); err != nil {
+		return err
+	}
+
+	backup, err := OpenDatabaseBackup(path)
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+	if err := server.ResetDatabase(db.Name, db.User); err != nil {
+		return err
+	}
+	return server.Restore(db.Name, db.User, password, db.Host, db.Port, backup)
+}
+
+// CopyDatabase reemplaza el contenido de dst por una copia de src, cargada con el usuario de
+// dst y su contraseña. Ambas bases de datos deben usar el mismo motor; el volcado pasa
+// directamente al cliente sin escribirse en disco.
+func CopyDatabase(src, dst SiteDatabase, password string) error {
+	if src.Engine != dst.Engine {
+		return NewError(ErrorValidacion, fmt.Sprintf("no se puede copiar una base de datos %s en una %s", src.Engine, dst.Engine), nil)
+	}
+	if err := checkRestorePassword(dst, password); err != nil {
+		return err
+	}
+	server, err := NewDatabaseServer(src.Engine)
+	if err != nil {
+		return err
+	}
+	if err := server.ResetDatabase(dst.Name, dst.User); err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	dumped := make(chan error, 1)
+	go func() {
+		err := server.Dump(src.Name, writer)
+		writer.CloseWithError(err)
+		dumped <- err
+	}()
+	restoreErr := server.Restore(dst.Name, dst.User, password, dst.Host, dst.Port, reader)
+	// Liberar el volcado si la restauración terminó antes de leerlo completo
+	reader.Close()
+	if err := <-dumped; err != nil {
+		return fmt.Errorf("error al copiar la base de datos %s: %v", src.Name, err)
+	}
+	return restoreErr
+}
+
+// checkRestorePassword comprueba antes de vaciar la base de datos que se tiene la contraseña
+// con la que MySQL carga la copia
+func checkRestorePassword(db SiteDatabase, password string) error {
+	if db.Engine == DBTypeMySQL && password == "" {
+		return NewError(ErrorValidacion, fmt.Sprintf("falta la contraseña de %s en los secretos para restaurar %s; genere una con 'sm db passwd'", db.User, db.Name), nil)
+	}
+	return nil
+}
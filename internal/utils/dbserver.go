@@ -0,0 +1,516 @@
+// internal/utils/dbserver.go
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dbIdentifierPattern valida los nombres de bases de datos y usuarios que crea SiteManager
+var dbIdentifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// mysqlSitePrivileges son los privilegios que recibe el usuario de un sitio sobre su base de
+// datos en MySQL/MariaDB: los necesarios para migraciones, sin privilegios globales
+const mysqlSitePrivileges = "SELECT, INSERT, UPDATE, DELETE, CREATE, ALTER, DROP, INDEX, REFERENCES, " +
+	"CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE, CREATE VIEW, SHOW VIEW, CREATE ROUTINE, ALTER ROUTINE, TRIGGER, EVENT"
+
+// DatabaseServer administra bases de datos y usuarios en un servidor local
+type DatabaseServer interface {
+	// Engine devuelve el motor del servidor
+	Engine() DatabaseType
+	// DefaultPort devuelve el puerto por defecto del motor
+	DefaultPort() int
+	// Check verifica que el servidor esté disponible
+	Check() error
+	DatabaseExists(name string) (bool, error)
+	UserExists(user string) (bool, error)
+	// CreateUser crea un usuario sin privilegios globales
+	CreateUser(user, password string) error
+	SetPassword(user, password string) error
+	DropUser(user string) error
+	// CreateDatabase crea una base de datos a la que solo accede el usuario indicado
+	CreateDatabase(name, user string) error
+	// Grant da al usuario acceso completo solo a la base de datos indicada
+	Grant(name, user string) error
+	DropDatabase(name string) error
+	// Shell abre un cliente interactivo conectado como el usuario de la base de datos
+	Shell(name, user, password, host string, port int) error
+	// Dump escribe una copia comprimida de la base de datos en w
+	Dump(name string, w io.Writer) error
+	// DumpExtension es la extensión de los archivos que genera Dump
+	DumpExtension() string
+	// ResetDatabase elimina la base de datos y la vuelve a crear vacía para el usuario
+	ResetDatabase(name, user string) error
+	// Restore carga en una base de datos vacía una copia generada por Dump conectado como el
+	// usuario, que solo tiene acceso a ella; los objetos quedan a su nombre
+	Restore(name, user, password, host string, port int, r io.Reader) error
+	// RunScript ejecuta un script SQL sobre la base de datos conectado como su usuario, que
+	// solo tiene acceso a ella
+	RunScript(name, user, password, host string, port int, r io.Reader) error
+}
+
+// ParseDatabaseEngine normaliza el nombre de un motor de base de datos
+func ParseDatabaseEngine(name string) (DatabaseType, error) {
+	switch strings.ToLower(name) {
+	case "postgresql", "postgres", "pgsql", "pg":
+		return DBTypePostgreSQL, nil
+	case "mysql", "mariadb":
+		return DBTypeMySQL, nil
+	default:
+		return "", NewError(ErrorValidacion, fmt.Sprintf("motor de base de datos no soportado: %s (use postgresql o mysql)", name), nil)
+	}
+}
+
+// NewDatabaseServer devuelve el administrador del motor indicado
+func NewDatabaseServer(engine DatabaseType) (DatabaseServer, error) {
+	switch engine {
+	case DBTypePostgreSQL:
+		return postgresServer{}, nil
+	case DBTypeMySQL:
+		return mysqlServer{}, nil
+	default:
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("motor de base de datos no soportado: %s", engine), nil)
+	}
+}
+
+// ValidateDatabaseIdentifier verifica un nombre de base de datos o de usuario. Solo se aceptan
+// minúsculas, números y guiones bajos para que el nombre sea válido en ambos motores.
+func ValidateDatabaseIdentifier(kind, name string, engine DatabaseType) error {
+	max := 63
+	if engine == DBTypeMySQL {
+		max = 64
+		if kind == "usuario" {
+			max = 32
+		}
+	}
+	if !dbIdentifierPattern.MatchString(name) {
+		return NewError(ErrorValidacion, fmt.Sprintf("nombre de %s inválido: %q (use minúsculas, números y guiones bajos)", kind, name), nil)
+	}
+	if len(name) > max {
+		return NewError(ErrorValidacion, fmt.Sprintf("el nombre de %s %q supera los %d caracteres", kind, name, max), nil)
+	}
+	return nil
+}
+
+// quoteIdent escribe un identificador SQL entre las comillas del motor
+func quoteIdent(engine DatabaseType, name string) string {
+	if engine == DBTypeMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral escribe un texto SQL entre comillas simples. MySQL interpreta además la barra
+// invertida como escape.
+func quoteLiteral(engine DatabaseType, value string) string {
+	if engine == DBTypeMySQL {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// runSQL ejecuta SQL enviado por la entrada estándar del cliente, de modo que ni las
+// sentencias ni las contraseñas aparecen en la línea de comandos. Los valores de redact se
+// ocultan en los mensajes de error.
+func runSQL(cmd *exec.Cmd, sql string, redact ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		for _, value := range redact {
+			if value != "" {
+				message = strings.ReplaceAll(message, value, "********")
+			}
+		}
+		return "", fmt.Errorf("%v: %s", err, message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// postgresServer administra PostgreSQL como el usuario postgres
+type postgresServer struct{}
+
+func (postgresServer) Engine() DatabaseType { return DBTypePostgreSQL }
+func (postgresServer) DefaultPort() int     { return 5432 }
+
+// psql ejecuta SQL como superusuario. VERBOSITY terse evita que los errores repitan la
+// sentencia con sus valores.
+func (postgresServer) psql(database, sql string, redact ...string) (string, error) {
+	args := []string{"-u", "postgres", "psql", "-X", "-q", "-t", "-A", "-v", "ON_ERROR_STOP=1"}
+	if database != "" {
+		args = append(args, "-d", database)
+	}
+	return runSQL(exec.Command("sudo", args...), "\\set VERBOSITY terse\n"+sql, redact...)
+}
+
+func (s postgresServer) Check() error {
+	if output, err := exec.Command("sudo", "-u", "postgres", "pg_isready").CombinedOutput(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("PostgreSQL no está disponible: %s", strings.TrimSpace(string(output))), err)
+	}
+	return nil
+}
+
+func (s postgresServer) exists(sql string) (bool, error) {
+	output, err := s.psql("", sql)
+	if err != nil {
+		return false, err
+	}
+	return output == "1", nil
+}
+
+func (s postgresServer) DatabaseExists(name string) (bool, error) {
+	return s.exists(fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname = %s;\n", quoteLiteral(DBTypePostgreSQL, name)))
+}
+
+func (s postgresServer) UserExists(user string) (bool, error) {
+	return s.exists(fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname = %s;\n", quoteLiteral(DBTypePostgreSQL, user)))
+}
+
+func (s postgresServer) CreateUser(user, password string) error {
+	_, err := s.psql("", fmt.Sprintf("CREATE ROLE %s LOGIN NOSUPERUSER NOCREATEDB NOCREATEROLE PASSWORD %s;\n",
+		quoteIdent(DBTypePostgreSQL, user), quoteLiteral(DBTypePostgreSQL, password)), password)
+	if err != nil {
+		return fmt.Errorf("error al crear el usuario PostgreSQL %s: %v", user, err)
+	}
+	return nil
+}
+
+func (s postgresServer) SetPassword(user, password string) error {
+	_, err := s.psql("", fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s;\n",
+		quoteIdent(DBTypePostgreSQL, user), quoteLiteral(DBTypePostgreSQL, password)), password)
+	if err != nil {
+		return fmt.Errorf("error al cambiar la contraseña del usuario PostgreSQL %s: %v", user, err)
+	}
+	return nil
+}
+
+func (s postgresServer) DropUser(user string) error {
+	if _, err := s.psql("", fmt.Sprintf("DROP ROLE IF EXISTS %s;\n", quoteIdent(DBTypePostgreSQL, user))); err != nil {
+		return fmt.Errorf("error al eliminar el usuario PostgreSQL %s: %v", user, err)
+	}
+	return nil
+}
+
+// CreateDatabase crea la base de datos con el usuario como propietario y sin acceso para PUBLIC
+func (s postgresServer) CreateDatabase(name, user string) error {
+	_, err := s.psql("", fmt.Sprintf("CREATE DATABASE %s OWNER %s;\n", quoteIdent(DBTypePostgreSQL, name), quoteIdent(DBTypePostgreSQL, user)))
+	if err != nil {
+		return fmt.Errorf("error al crear la base de datos PostgreSQL %s: %v", name, err)
+	}
+	return s.revokePublic(name)
+}
+
+// Grant hace al usuario propietario de la base de datos y de su esquema public
+func (s postgresServer) Grant(name, user string) error {
+	db, role := quoteIdent(DBTypePostgreSQL, name), quoteIdent(DBTypePostgreSQL, user)
+	if _, err := s.psql("", fmt.Sprintf("ALTER DATABASE %s OWNER TO %s;\n", db, role)); err != nil {
+		return fmt.Errorf("error al asignar la base de datos %s a %s: %v", name, user, err)
+	}
+	if _, err := s.psql(name, fmt.Sprintf("ALTER SCHEMA public OWNER TO %s;\n", role)); err != nil {
+		return fmt.Errorf("error al asignar el esquema public de %s a %s: %v", name, user, err)
+	}
+	return s.revokePublic(name)
+}
+
+// revokePublic impide que otros usuarios se conecten a la base de datos
+func (s postgresServer) revokePublic(name string) error {
+	if _, err := s.psql("", fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC;\n", quoteIdent(DBTypePostgreSQL, name))); err != nil {
+		return fmt.Errorf("error al restringir el acceso a %s: %v", name, err)
+	}
+	return nil
+}
+
+// DropDatabase cierra las conexiones abiertas, que impedirían eliminar la base de datos
+func (s postgresServer) DropDatabase(name string) error {
+	sql := fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid();\n",
+		quoteLiteral(DBTypePostgreSQL, name))
+	if _, err := s.psql("", sql); err != nil {
+		return fmt.Errorf("error al cerrar las conexiones a %s: %v", name, err)
+	}
+	if _, err := s.psql("", fmt.Sprintf("DROP DATABASE IF EXISTS %s;\n", quoteIdent(DBTypePostgreSQL, name))); err != nil {
+		return fmt.Errorf("error al eliminar la base de datos PostgreSQL %s: %v", name, err)
+	}
+	return nil
+}
+
+// Shell abre psql con la contraseña en el entorno del proceso, no en sus argumentos
+func (postgresServer) Shell(name, user, password, host string, port int) error {
+	cmd := exec.Command("psql", "-h", host, "-p", strconv.Itoa(port), "-U", user, "-d", name)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// Dump genera una copia en el formato personalizado de pg_dump, que ya está comprimido
+func (postgresServer) Dump(name string, w io.Writer) error {
+	return runDump(exec.Command("sudo", "-u", "postgres", "pg_dump", "-Fc", "-d", name), w)
+}
+
+func (postgresServer) DumpExtension() string { return ".dump" }
+
+// ResetDatabase elimina la base de datos, cerrando sus conexiones, y la crea vacía
+func (s postgresServer) ResetDatabase(name, user string) error {
+	if err := s.DropDatabase(name); err != nil {
+		return err
+	}
+	return s.CreateDatabase(name, user)
+}
+
+// Restore usa pg_restore en una sola transacción: si algo falla, la base de datos queda vacía.
+// Las sentencias se ejecutan con el rol del usuario (--role), por lo que no necesita su contraseña.
+func (postgresServer) Restore(name, user, password, host string, port int, r io.Reader) error {
+	cmd := exec.Command("sudo", "-u", "postgres", "pg_restore", "--no-owner", "--no-privileges",
+		"--role="+user, "--single-transaction", "-d", name)
+	return runInput(cmd, r)
+}
+
+// RunScript ejecuta el script en una sola transacción y se detiene en el primer error
+func (postgresServer) RunScript(name, user, password, host string, port int, r io.Reader) error {
+	cmd := exec.Command("psql", "-X", "-q", "-v", "ON_ERROR_STOP=1", "--single-transaction",
+		"-h", host, "-p", strconv.Itoa(port), "-U", user, "-d", name)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
+	return runInput(cmd, r)
+}
+
+// mysqlServer administra MySQL o MariaDB como root a través del socket local
+type mysqlServer struct{}
+
+func (mysqlServer) Engine() DatabaseType { return DBTypeMySQL }
+func (mysqlServer) DefaultPort() int     { return 3306 }
+
+// mysql ejecuta SQL como root
+func (mysqlServer) mysql(sql string, redact ...string) (string, error) {
+	return runSQL(exec.Command("mysql", "-u", "root", "--batch", "--skip-column-names"), sql, redact...)
+}
+
+func (s mysqlServer) Check() error {
+	if output, err := exec.Command("mysqladmin", "-u", "root", "ping").CombinedOutput(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("MySQL no está disponible: %s", strings.TrimSpace(string(output))), err)
+	}
+	return nil
+}
+
+func (s mysqlServer) exists(sql string) (bool, error) {
+	output, err := s.mysql(sql)
+	if err != nil {
+		return false, err
+	}
+	return output == "1", nil
+}
+
+// account escribe la cuenta local de un usuario ('usuario'@'localhost')
+func (mysqlServer) account(user string) string {
+	return quoteLiteral(DBTypeMySQL, user) + "@'localhost'"
+}
+
+func (s mysqlServer) DatabaseExists(name string) (bool, error) {
+	return s.exists(fmt.Sprintf("SELECT 1 FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = %s;\n", quoteLiteral(DBTypeMySQL, name)))
+}
+
+func (s mysqlServer) UserExists(user string) (bool, error) {
+	return s.exists(fmt.Sprintf("SELECT 1 FROM mysql.user WHERE User = %s AND Host = 'localhost';\n", quoteLiteral(DBTypeMySQL, user)))
+}
+
+func (s mysqlServer) CreateUser(user, password string) error {
+	_, err := s.mysql(fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s;\n", s.account(user), quoteLiteral(DBTypeMySQL, password)), password)
+	if err != nil {
+		return fmt.Errorf("error al crear el usuario MySQL %s: %v", user, err)
+	}
+	return nil
+}
+
+func (s mysqlServer) SetPassword(user, password string) error {
+	_, err := s.mysql(fmt.Sprintf("ALTER USER %s IDENTIFIED BY %s;\n", s.account(user), quoteLiteral(DBTypeMySQL, password)), password)
+	if err != nil {
+		return fmt.Errorf("error al cambiar la contraseña del usuario MySQL %s: %v", user, err)
+	}
+	return nil
+}
+
+func (s mysqlServer) DropUser(user string) error {
+	if _, err := s.mysql(fmt.Sprintf("DROP USER IF EXISTS %s;\n", s.account(user))); err != nil {
+		return fmt.Errorf("error al eliminar el usuario MySQL %s: %v", user, err)
+	}
+	return nil
+}
+
+func (s mysqlServer) CreateDatabase(name, user string) error {
+	_, err := s.mysql(fmt.Sprintf("CREATE DATABASE %s CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;\n", quoteIdent(DBTypeMySQL, name)))
+	if err != nil {
+		return fmt.Errorf("error al crear la base de datos MySQL %s: %v", name, err)
+	}
+	return s.Grant(name, user)
+}
+
+func (s mysqlServer) Grant(name, user string) error {
+	_, err := s.mysql(fmt.Sprintf("GRANT %s ON %s.* TO %s;\n", mysqlSitePrivileges, quoteIdent(DBTypeMySQL, name), s.account(user)))
+	if err != nil {
+		return fmt.Errorf("error al asignar privilegios sobre %s a %s: %v", name, user, err)
+	}
+	return nil
+}
+
+func (s mysqlServer) DropDatabase(name string) error {
+	if _, err := s.mysql(fmt.Sprintf("DROP DATABASE IF EXISTS %s;\n", quoteIdent(DBTypeMySQL, name))); err != nil {
+		return fmt.Errorf("error al eliminar la base de datos MySQL %s: %v", name, err)
+	}
+	return nil
+}
+
+// Shell abre el cliente mysql leyendo las credenciales de un archivo temporal que solo root
+// puede leer, para que la contraseña no aparezca en la lista de procesos
+func (mysqlServer) Shell(name, user, password, host string, port int) error {
+	defaults, err := mysqlDefaultsFile(user, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(defaults)
+
+	cmd := exec.Command("mysql", "--defaults-extra-file="+defaults, name)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// mysqlDefaultsFile escribe un archivo de opciones [client] con las credenciales de un usuario
+func mysqlDefaultsFile(user, password, host string, port int) (string, error) {
+	file, err := os.CreateTemp("", "sm-mysql-*.cnf")
+	if err != nil {
+		return "", fmt.Errorf("error al crear archivo temporal: %v", err)
+	}
+	defer file.Close()
+	if err := file.Chmod(0600); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error al cambiar permisos de %s: %v", file.Name(), err)
+	}
+	quote := func(value string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	content := fmt.Sprintf("[client]\nuser=%s\npassword=%s\nhost=%s\nport=%d\n", quote(user), quote(password), quote(host), port)
+	if _, err := file.WriteString(content); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error al escribir %s: %v", file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+// Dump genera una copia SQL consistente (--single-transaction) comprimida con gzip
+func (mysqlServer) Dump(name string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	cmd := exec.Command("mysqldump", "-u", "root", "--single-transaction", "--quick", "--routines", "--triggers", "--no-tablespaces", name)
+	if err := runDump(cmd, gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (mysqlServer) DumpExtension() string { return ".sql.gz" }
+
+func (s mysqlServer) ResetDatabase(name, user string) error {
+	if err := s.DropDatabase(name); err != nil {
+		return err
+	}
+	return s.CreateDatabase(name, user)
+}
+
+// Restore descomprime la copia y la carga con el cliente mysql como el usuario del sitio, de
+// modo que una copia no pueda modificar otras bases de datos ni usuarios
+func (s mysqlServer) Restore(name, user, password, host string, port int, r io.Reader) error {
+	if password == "" {
+		return NewError(ErrorValidacion, fmt.Sprintf("falta la contraseña de %s en los secretos para restaurar %s", user, name), nil)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("la copia no es un archivo gzip válido: %v", err)
+	}
+	defer gz.Close()
+
+	defaults, err := mysqlDefaultsFile(user, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(defaults)
+
+	dump := stripMySQLDefiners(gz)
+	defer dump.Close()
+	return runInput(exec.Command("mysql", "--defaults-extra-file="+defaults, name), dump)
+}
+
+// mysqlDefinerPattern reconoce las cláusulas DEFINER de rutinas, triggers y vistas
+var mysqlDefinerPattern = regexp.MustCompile("DEFINER=`(?:[^`]|``)*`@`(?:[^`]|``)*`\\s*")
+
+// stripMySQLDefiners quita las cláusulas DEFINER de un volcado: mysqldump las escribe con el
+// usuario root y el usuario del sitio solo puede crear objetos a su nombre. Las filas de los
+// INSERT se copian sin cambios.
+func stripMySQLDefiners(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			line, err := reader.ReadString('\n')
+			if !strings.HasPrefix(line, "INSERT ") && strings.Contains(line, "DEFINER=") {
+				line = mysqlDefinerPattern.ReplaceAllString(line, "")
+			}
+			if _, werr := io.WriteString(pw, line); werr != nil {
+				pw.CloseWithError(werr)
+				return
+			}
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// RunScript ejecuta el script con el cliente mysql y se detiene en el primer error
+func (mysqlServer) RunScript(name, user, password, host string, port int, r io.Reader) error {
+	defaults, err := mysqlDefaultsFile(user, password, host, port)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(defaults)
+	return runInput(exec.Command("mysql", "--defaults-extra-file="+defaults, name), r)
+}
+
+// runDump ejecuta un comando de volcado y escribe su salida en w
+func runDump(cmd *exec.Cmd, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al ejecutar %s: %v: %s", clientName(cmd), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// runInput ejecuta un comando que lee sus datos de r
+func runInput(cmd *exec.Cmd, r io.Reader) error {
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stderr = r, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al ejecutar %s: %v: %s", clientName(cmd), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// clientName devuelve el programa que ejecuta cmd, aunque se ejecute con sudo -u
+func clientName(cmd *exec.Cmd) string {
+	if filepath.Base(cmd.Args[0]) == "sudo" && len(cmd.Args) > 3 {
+		return cmd.Args[3]
+	}
+	return filepath.Base(cmd.Args[0])
+}
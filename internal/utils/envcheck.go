@@ -0,0 +1,239 @@
+// internal/utils/envcheck.go
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tipos de valor que admite el esquema de variables de entorno
+const (
+	EnvTypeString = "string"
+	EnvTypeInt    = "int"
+	EnvTypeBool   = "bool"
+	EnvTypeURL    = "url"
+	EnvTypeEmail  = "email"
+	EnvTypeEnum   = "enum"
+)
+
+// placeholderPattern reconoce los valores de ejemplo que nunca deberían llegar a producción
+var placeholderPattern = regexp.MustCompile(`(?i)^(change[-_ ]?me.*|.*please[-_ ]?change.*|your[-_ ].*|<[^>]*>|x{3,}|todo|tbd|fixme|placeholder|\.\.\.)$`)
+
+// EnvSchemaEntry describe el valor esperado de una variable de entorno
+type EnvSchemaEntry struct {
+	Type     string   `yaml:"type"`
+	Required bool     `yaml:"required"`
+	Values   []string `yaml:"values"`
+}
+
+// UnmarshalYAML permite declarar solo el tipo ('PORT: int') o el objeto completo
+func (e *EnvSchemaEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Type = node.Value
+		return nil
+	}
+	type rawEntry EnvSchemaEntry
+	var raw rawEntry
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*e = EnvSchemaEntry(raw)
+	return nil
+}
+
+// Validate verifica que la entrada del esquema sea válida
+func (e EnvSchemaEntry) Validate() error {
+	switch e.Type {
+	case "", EnvTypeString, EnvTypeInt, EnvTypeBool, EnvTypeURL, EnvTypeEmail:
+		if len(e.Values) > 0 {
+			return fmt.Errorf("values solo se usa con el tipo enum")
+		}
+	case EnvTypeEnum:
+		if len(e.Values) == 0 {
+			return fmt.Errorf("el tipo enum requiere values")
+		}
+	default:
+		return fmt.Errorf("tipo no soportado: %s", e.Type)
+	}
+	return nil
+}
+
+// check verifica un valor no vacío contra el tipo declarado
+func (e EnvSchemaEntry) check(value string) error {
+	switch e.Type {
+	case EnvTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("debe ser un número entero")
+		}
+	case EnvTypeBool:
+		switch strings.ToLower(value) {
+		case "true", "false", "1", "0", "yes", "no", "on", "off", "(true)", "(false)":
+		default:
+			return fmt.Errorf("debe ser true o false")
+		}
+	case EnvTypeURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("debe ser una URL con esquema y host")
+		}
+	case EnvTypeEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Errorf("debe ser una dirección de correo")
+		}
+	case EnvTypeEnum:
+		for _, allowed := range e.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("debe ser uno de: %s", strings.Join(e.Values, ", "))
+	}
+	return nil
+}
+
+// EnvIssueKind es el tipo de problema encontrado en una variable
+type EnvIssueKind string
+
+// Problemas que detecta la verificación del .env
+const (
+	EnvIssueMissing     EnvIssueKind = "falta"
+	EnvIssueEmpty       EnvIssueKind = "vacía"
+	EnvIssuePlaceholder EnvIssueKind = "valor de ejemplo"
+	EnvIssueInvalid     EnvIssueKind = "valor inválido"
+	EnvIssueUnknown     EnvIssueKind = "desconocida"
+)
+
+// EnvIssue es un problema de una variable del .env. Los problemas bloqueantes detienen el
+// despliegue en modo estricto; el resto son advertencias.
+type EnvIssue struct {
+	Key      string
+	Kind     EnvIssueKind
+	Detail   string
+	Blocking bool
+}
+
+// String describe el problema
+func (i EnvIssue) String() string {
+	if i.Detail != "" {
+		return fmt.Sprintf("%s: %s (%s)", i.Key, i.Kind, i.Detail)
+	}
+	return fmt.Sprintf("%s: %s", i.Key, i.Kind)
+}
+
+// EnvReport es el resultado de verificar un .env
+type EnvReport struct {
+	Issues []EnvIssue
+}
+
+// Blocking devuelve los problemas que detienen el despliegue en modo estricto
+func (r *EnvReport) Blocking() []EnvIssue {
+	var issues []EnvIssue
+	for _, issue := range r.Issues {
+		if issue.Blocking {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// EnvCheckInput son las fuentes con las que se compara un .env
+type EnvCheckInput struct {
+	// Values son las variables del .env ya interpoladas
+	Values map[string]string
+	// Example son las variables de .env.example
+	Example map[string]string
+	// Schema y Required provienen del manifiesto del repositorio
+	Schema   map[string]EnvSchemaEntry
+	Required []string
+	// Generated son las variables que el despliegue genera después de la verificación
+	Generated []string
+}
+
+// CheckEnv compara las variables de un .env con .env.example y el esquema del repositorio.
+// Informa las variables que faltan, están vacías, conservan un valor de ejemplo o no cumplen
+// su tipo, y como advertencia las que no declara ninguna de las fuentes.
+func CheckEnv(in EnvCheckInput) *EnvReport {
+	report := &EnvReport{}
+
+	required := make(map[string]bool)
+	for _, key := range in.Required {
+		required[key] = true
+	}
+	expected := make(map[string]bool)
+	for key := range in.Example {
+		expected[key] = true
+	}
+	for key, entry := range in.Schema {
+		expected[key] = true
+		if entry.Required {
+			required[key] = true
+		}
+	}
+	for key := range required {
+		expected[key] = true
+	}
+	generated := make(map[string]bool)
+	for _, key := range in.Generated {
+		generated[key] = true
+	}
+
+	for _, key := range sortedKeys(expected) {
+		value, defined := in.Values[key]
+		_, inExample := in.Example[key]
+		switch {
+		case value == "" && generated[key]:
+			continue
+		case !defined:
+			// Las variables opcionales del esquema pueden omitirse
+			if inExample || required[key] {
+				report.add(key, EnvIssueMissing, "", true)
+			}
+			continue
+		case value == "":
+			report.add(key, EnvIssueEmpty, "", required[key])
+			continue
+		}
+
+		if placeholderPattern.MatchString(value) {
+			report.add(key, EnvIssuePlaceholder, "", true)
+		} else if example := in.Example[key]; IsSecretEnvKey(key) && example != "" && value == example && !strings.EqualFold(value, "null") {
+			report.add(key, EnvIssuePlaceholder, "igual que en .env.example", true)
+		}
+		if entry, ok := in.Schema[key]; ok {
+			if err := entry.check(value); err != nil {
+				report.add(key, EnvIssueInvalid, err.Error(), true)
+			}
+		}
+	}
+
+	// Solo hay variables desconocidas si alguna fuente declara las esperadas
+	if len(in.Example) > 0 || len(in.Schema) > 0 {
+		for _, key := range sortedKeys(in.Values) {
+			if !expected[key] {
+				report.add(key, EnvIssueUnknown, "no está en .env.example ni en el esquema", false)
+			}
+		}
+	}
+	return report
+}
+
+// add agrega un problema al informe
+func (r *EnvReport) add(key string, kind EnvIssueKind, detail string, blocking bool) {
+	r.Issues = append(r.Issues, EnvIssue{Key: key, Kind: kind, Detail: detail, Blocking: blocking})
+}
+
+// sortedKeys devuelve las claves de un mapa ordenadas
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
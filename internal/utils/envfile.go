@@ -0,0 +1,52 @@
+// internal/utils/envfile.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/elmersh/sitemanager/internal/dotenv"
+)
+
+// EnvFileMode son los permisos de los archivos .env: los lee el usuario del sitio, que ejecuta
+// la aplicación y su pool de PHP-FPM, pero no el resto de usuarios del servidor
+const EnvFileMode os.FileMode = 0640
+
+// secretEnvKeyPattern reconoce las variables cuyo valor no se muestra por defecto
+var secretEnvKeyPattern = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|KEY|CREDENTIAL|PRIVATE|SALT|DSN|(DATABASE|REDIS|MONGO(DB)?|AMQP)_URL)`)
+
+// ParseEnvAssignment separa una asignación 'CLAVE=valor' y valida el nombre de la variable
+func ParseEnvAssignment(assignment string) (string, string, error) {
+	key, value, ok := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !ok {
+		return "", "", NewError(ErrorValidacion, fmt.Sprintf("asignación no válida: %s (use CLAVE=valor)", assignment), nil)
+	}
+	if err := ValidateEnvKey(key); err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// ValidateEnvKey verifica el nombre de una variable de entorno
+func ValidateEnvKey(key string) error {
+	if !dotenv.ValidKey(key) {
+		return NewError(ErrorValidacion, fmt.Sprintf("nombre de variable no válido: %q", key), nil)
+	}
+	return nil
+}
+
+// IsSecretEnvKey indica si el nombre de una variable sugiere que su valor es secreto
+func IsSecretEnvKey(key string) bool {
+	return secretEnvKeyPattern.MatchString(key)
+}
+
+// MaskEnvValue oculta el valor de una variable secreta
+func MaskEnvValue(key, value string) string {
+	if value == "" || !IsSecretEnvKey(key) {
+		return value
+	}
+	return "********"
+}
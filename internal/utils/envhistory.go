@@ -0,0 +1,154 @@
+// internal/utils/envhistory.go
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envSnapshotsToKeep es la cantidad de versiones del .env que se conservan por sitio
+const envSnapshotsToKeep = 50
+
+// EnvSnapshot describe una versión guardada del .env de un sitio
+type EnvSnapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	User      string    `json:"user"`
+	// Source es la operación que escribió el .env (env set, deploy, rollback...)
+	Source   string `json:"source"`
+	DeployID string `json:"deploy_id,omitempty"`
+	Release  string `json:"release,omitempty"`
+	Checksum string `json:"checksum"`
+}
+
+// envHistoryDir devuelve el directorio con las versiones del .env de un sitio. Contiene
+// secretos, por lo que solo root puede leerlo.
+func envHistoryDir(domain string) string {
+	return filepath.Join(SiteStateDir(domain), "env")
+}
+
+// envChecksum identifica el contenido de un .env
+func envChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveEnvSnapshot guarda una versión nueva del .env de un sitio. Si el contenido es igual al
+// de la última versión no se crea otra y se devuelve la última.
+func SaveEnvSnapshot(domain string, data []byte, snapshot EnvSnapshot) (*EnvSnapshot, error) {
+	history, err := LoadEnvHistory(domain)
+	if err != nil {
+		return nil, err
+	}
+	checksum := envChecksum(data)
+	if len(history) > 0 && history[0].Checksum == checksum {
+		return &history[0], nil
+	}
+
+	if _, err := EnsureSiteStateDir(domain); err != nil {
+		return nil, err
+	}
+	dir := envHistoryDir(domain)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de versiones del .env: %v", err)
+	}
+
+	snapshot.Version = 1
+	if len(history) > 0 {
+		snapshot.Version = history[0].Version + 1
+	}
+	snapshot.CreatedAt = time.Now()
+	snapshot.Checksum = checksum
+	if snapshot.User == "" {
+		snapshot.User = InvokingUser()
+	}
+
+	base := filepath.Join(dir, strconv.Itoa(snapshot.Version))
+	if err := os.WriteFile(base+".env", data, 0600); err != nil {
+		return nil, fmt.Errorf("error al guardar la versión del .env: %v", err)
+	}
+	meta, err := json.MarshalIndent(&snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(base+".json.tmp", meta, 0600); err != nil {
+		return nil, fmt.Errorf("error al guardar la versión del .env: %v", err)
+	}
+	if err := os.Rename(base+".json.tmp", base+".json"); err != nil {
+		return nil, fmt.Errorf("error al guardar la versión del .env: %v", err)
+	}
+
+	// Eliminar las versiones más antiguas
+	for i := envSnapshotsToKeep - 1; i < len(history); i++ {
+		old := filepath.Join(dir, strconv.Itoa(history[i].Version))
+		os.Remove(old + ".json")
+		os.Remove(old + ".env")
+	}
+	return &snapshot, nil
+}
+
+// LoadEnvHistory devuelve las versiones guardadas del .env de un sitio, de la más reciente
+// a la más antigua
+func LoadEnvHistory(domain string) ([]EnvSnapshot, error) {
+	entries, err := os.ReadDir(envHistoryDir(domain))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer las versiones del .env: %v", err)
+	}
+
+	var history []EnvSnapshot
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(envHistoryDir(domain), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la versión %s del .env: %v", entry.Name(), err)
+		}
+		var snapshot EnvSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			fmt.Printf("Advertencia: la versión %s del .env está dañada: %v\n", entry.Name(), err)
+			continue
+		}
+		history = append(history, snapshot)
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Version > history[j].Version
+	})
+	return history, nil
+}
+
+// LoadEnvSnapshot devuelve una versión del .env de un sitio y su contenido
+func LoadEnvSnapshot(domain string, version int) (*EnvSnapshot, []byte, error) {
+	history, err := LoadEnvHistory(domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range history {
+		if history[i].Version != version {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(envHistoryDir(domain), strconv.Itoa(version)+".env"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error al leer la versión %d del .env: %v", version, err)
+		}
+		return &history[i], data, nil
+	}
+	return nil, nil, NewError(ErrorValidacion, fmt.Sprintf("no existe la versión %d del .env de %s", version, domain), nil)
+}
+
+// Matches indica si la versión tiene el mismo contenido que data
+func (s *EnvSnapshot) Matches(data []byte) bool {
+	return s.Checksum == envChecksum(data)
+}
@@ -0,0 +1,132 @@
+// internal/utils/healthcheck.go
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHealthTimeout es la ventana de reintentos por defecto de la verificación
+	DefaultHealthTimeout = 60 * time.Second
+	// DefaultHealthInterval es la espera entre intentos por defecto
+	DefaultHealthInterval = 2 * time.Second
+)
+
+// HealthCheckOptions define cómo se verifica que una aplicación responde
+type HealthCheckOptions struct {
+	Disabled       bool          `yaml:"disabled"`
+	Path           string        `yaml:"path"`
+	ExpectedStatus int           `yaml:"status"`
+	BodyContains   string        `yaml:"body"`
+	Timeout        time.Duration `yaml:"timeout"`
+	Interval       time.Duration `yaml:"interval"`
+}
+
+// HealthTarget indica dónde se envía la petición de verificación
+type HealthTarget struct {
+	// URL base sin ruta, por ejemplo http://127.0.0.1:3001
+	BaseURL string
+	// Host se envía como cabecera Host (y SNI si la URL es https)
+	Host string
+}
+
+// WaitForHealthy realiza peticiones GET al objetivo hasta que responde según lo esperado
+// o se agota la ventana de reintentos.
+func WaitForHealthy(target HealthTarget, opts HealthCheckOptions) error {
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		// No seguir redirecciones: la respuesta del propio servidor es lo que se evalúa
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				ServerName: target.Host,
+				// La petición es local; el certificado se valida por Certbot, no aquí
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	url := strings.TrimSuffix(target.BaseURL, "/") + path
+	deadline := time.Now().Add(timeout)
+	attempt := 0
+	var lastErr error
+
+	for {
+		attempt++
+		lastErr = probeOnce(client, url, target.Host, opts)
+		if lastErr == nil {
+			fmt.Printf("Verificación de salud correcta: %s (intento %d)\n", url, attempt)
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			break
+		}
+		fmt.Printf("Verificación de salud pendiente (intento %d): %v\n", attempt, lastErr)
+		time.Sleep(interval)
+	}
+
+	return NewError(ErrorValidacion, fmt.Sprintf("la aplicación no respondió correctamente en %s tras %d intentos", timeout, attempt), lastErr)
+}
+
+// probeOnce realiza una única petición y evalúa la respuesta
+func probeOnce(client *http.Client, url, host string, opts HealthCheckOptions) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if host != "" {
+		req.Host = host
+	}
+	req.Header.Set("User-Agent", "SiteManager-HealthCheck")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if opts.ExpectedStatus != 0 {
+		if resp.StatusCode != opts.ExpectedStatus {
+			return fmt.Errorf("código HTTP %d, se esperaba %d", resp.StatusCode, opts.ExpectedStatus)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("código HTTP %d", resp.StatusCode)
+	}
+
+	if opts.BodyContains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return fmt.Errorf("error al leer la respuesta: %v", err)
+		}
+		if !strings.Contains(string(body), opts.BodyContains) {
+			return fmt.Errorf("la respuesta no contiene %q", opts.BodyContains)
+		}
+	}
+
+	return nil
+}
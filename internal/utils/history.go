@@ -0,0 +1,242 @@
+// internal/utils/history.go
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Estados posibles de un despliegue
+const (
+	DeployStatusRunning    = "en_curso"
+	DeployStatusSuccess    = "exitoso"
+	DeployStatusFailed     = "fallido"
+	DeployStatusRolledBack = "revertido"
+)
+
+// DeployRecord es la entrada del historial de un despliegue
+type DeployRecord struct {
+	ID         string        `json:"id"`
+	Domain     string        `json:"domain"`
+	User       string        `json:"user"`
+	Repository string        `json:"repository"`
+	Branch     string        `json:"branch"`
+	Commit     string        `json:"commit,omitempty"`
+	Type       string        `json:"type,omitempty"`
+	Release    string        `json:"release,omitempty"`
+	EnvVersion int           `json:"env_version,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Steps      []StepRecord  `json:"steps"`
+	LogFile    string        `json:"log_file"`
+}
+
+// StepRecord registra el resultado de una etapa del despliegue
+type StepRecord struct {
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// DeployRecorder guarda el registro de un despliegue en curso y su log completo.
+// Todos sus métodos aceptan un receptor nil para que el historial nunca bloquee un despliegue.
+type DeployRecorder struct {
+	Record DeployRecord
+	dir    string
+	log    *os.File
+}
+
+// deploysDir devuelve el directorio del historial de despliegues de un sitio
+func deploysDir(domain string) string {
+	return filepath.Join(SiteStateDir(domain), "deploys")
+}
+
+// StartDeployRecord crea el registro de un despliegue y su archivo de log
+func StartDeployRecord(id, domain, repository, branch string) (*DeployRecorder, error) {
+	if _, err := EnsureSiteStateDir(domain); err != nil {
+		return nil, err
+	}
+	dir := deploysDir(domain)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de historial: %v", err)
+	}
+
+	logPath := filepath.Join(dir, id+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el log del despliegue: %v", err)
+	}
+
+	r := &DeployRecorder{
+		Record: DeployRecord{
+			ID:         id,
+			Domain:     domain,
+			User:       InvokingUser(),
+			Repository: repository,
+			Branch:     branch,
+			StartedAt:  time.Now(),
+			Status:     DeployStatusRunning,
+			LogFile:    logPath,
+		},
+		dir: dir,
+		log: logFile,
+	}
+	fmt.Fprintf(logFile, "# Despliegue %s de %s por %s (%s, rama %s)\n", id, domain, r.Record.User, repository, branch)
+
+	return r, r.save()
+}
+
+// Write agrega texto al log completo del despliegue
+func (r *DeployRecorder) Write(p []byte) (int, error) {
+	if r == nil || r.log == nil {
+		return len(p), nil
+	}
+	return r.log.Write(p)
+}
+
+// LogCommand guarda en el log un comando ejecutado y su salida
+func (r *DeployRecorder) LogCommand(command string, output []byte) {
+	if r == nil {
+		return
+	}
+	fmt.Fprintf(r, "$ %s\n%s", command, output)
+	if len(output) > 0 && output[len(output)-1] != '\n' {
+		fmt.Fprintln(r)
+	}
+}
+
+// Step ejecuta una etapa del despliegue registrando su duración y resultado
+func (r *DeployRecorder) Step(name string, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	step := StepRecord{Name: name, StartedAt: time.Now(), Status: DeployStatusRunning}
+	fmt.Fprintf(r, "\n## %s\n", name)
+
+	err := fn()
+	step.Duration = time.Since(step.StartedAt).Round(time.Millisecond)
+	step.Status = DeployStatusSuccess
+	if err != nil {
+		step.Status = DeployStatusFailed
+		step.Error = err.Error()
+		fmt.Fprintf(r, "Error: %v\n", err)
+	}
+
+	r.Record.Steps = append(r.Record.Steps, step)
+	if saveErr := r.save(); saveErr != nil {
+		fmt.Printf("Advertencia: no se pudo actualizar el historial: %v\n", saveErr)
+	}
+	return err
+}
+
+// Finish cierra el registro con el resultado final del despliegue
+func (r *DeployRecorder) Finish(err error) {
+	if r == nil {
+		return
+	}
+
+	r.Record.FinishedAt = time.Now()
+	r.Record.Duration = r.Record.FinishedAt.Sub(r.Record.StartedAt).Round(time.Second)
+	if err != nil {
+		r.Record.Error = err.Error()
+		if r.Record.Status != DeployStatusRolledBack {
+			r.Record.Status = DeployStatusFailed
+		}
+	} else {
+		r.Record.Status = DeployStatusSuccess
+	}
+
+	fmt.Fprintf(r, "\n# Resultado: %s (%s)\n", r.Record.Status, r.Record.Duration)
+	if saveErr := r.save(); saveErr != nil {
+		fmt.Printf("Advertencia: no se pudo guardar el historial: %v\n", saveErr)
+	}
+	r.log.Close()
+}
+
+// save escribe el registro en disco de forma atómica
+func (r *DeployRecorder) save() error {
+	data, err := json.MarshalIndent(r.Record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.dir, r.Record.ID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadDeployHistory devuelve los despliegues registrados de un sitio, del más reciente al más antiguo
+func LoadDeployHistory(domain string) ([]DeployRecord, error) {
+	entries, err := os.ReadDir(deploysDir(domain))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el historial: %v", err)
+	}
+
+	var records []DeployRecord
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		record, err := LoadDeployRecord(domain, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			fmt.Printf("Advertencia: %v\n", err)
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.After(records[j].StartedAt)
+	})
+	return records, nil
+}
+
+// LoadDeployRecord carga un despliegue del historial por su identificador
+func LoadDeployRecord(domain, id string) (*DeployRecord, error) {
+	if id == "" || strings.ContainsAny(id, "/\\") || strings.HasPrefix(id, ".") {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("identificador de despliegue inválido: %s", id), nil)
+	}
+
+	data, err := os.ReadFile(filepath.Join(deploysDir(domain), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("no existe el despliegue %s para %s", id, domain), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el despliegue %s: %v", id, err)
+	}
+
+	var record DeployRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("el registro del despliegue %s está dañado: %v", id, err)
+	}
+	return &record, nil
+}
+
+// InvokingUser devuelve el usuario que ejecutó sm (a través de sudo si corresponde)
+func InvokingUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "desconocido"
+}
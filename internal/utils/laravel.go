@@ -0,0 +1,145 @@
+// internal/utils/laravel.go
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Empaquetadores de assets de Laravel
+const (
+	AssetBundlerVite = "vite"
+	AssetBundlerMix  = "mix"
+)
+
+// Servidores de aplicación soportados por Laravel Octane
+const (
+	OctaneServerSwoole     = "swoole"
+	OctaneServerRoadRunner = "roadrunner"
+	OctaneServerFrankenPHP = "frankenphp"
+)
+
+// DefaultOctaneMaxMemory es el límite de memoria del proceso de Octane, que incluye a sus workers
+const DefaultOctaneMaxMemory = "1G"
+
+// LaravelAssets describe la compilación del frontend de una aplicación Laravel
+type LaravelAssets struct {
+	Bundler        string
+	PackageManager PackageManager
+	// Script es el script de package.json que compila los assets para producción
+	Script string
+}
+
+// DetectLaravelAssets detecta si una aplicación Laravel compila assets con Vite o Laravel Mix.
+// Devuelve nil si el proyecto no tiene package.json o no define un script de compilación.
+func DetectLaravelAssets(appDir string) (*LaravelAssets, error) {
+	data, err := os.ReadFile(filepath.Join(appDir, "package.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer package.json: %v", err)
+	}
+	var packageJSON struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &packageJSON); err != nil {
+		return nil, fmt.Errorf("error al parsear package.json: %v", err)
+	}
+
+	assets := &LaravelAssets{Bundler: AssetBundlerVite, Script: "build"}
+	vite := false
+	for _, name := range []string{"vite.config.js", "vite.config.ts", "vite.config.mjs", "vite.config.mts"} {
+		if PathExists(filepath.Join(appDir, name)) {
+			vite = true
+			break
+		}
+	}
+	if !vite && PathExists(filepath.Join(appDir, "webpack.mix.js")) {
+		// Laravel Mix compila para producción con 'npm run production'
+		assets.Bundler = AssetBundlerMix
+		if _, ok := packageJSON.Scripts["production"]; ok {
+			assets.Script = "production"
+		}
+	}
+	if _, ok := packageJSON.Scripts[assets.Script]; !ok {
+		return nil, nil
+	}
+
+	if assets.PackageManager, err = DetectPackageManager(appDir); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// OctaneConfig describe cómo se ejecuta una aplicación Laravel con Octane
+type OctaneConfig struct {
+	Server string `yaml:"server,omitempty"`
+	// Workers es la cantidad de workers de Octane; 0 usa uno por CPU
+	Workers int `yaml:"workers,omitempty"`
+	// MaxRequests recicla cada worker tras atender esa cantidad de peticiones
+	MaxRequests int `yaml:"max_requests,omitempty"`
+}
+
+// Enabled indica si la aplicación se ejecuta con Octane en lugar de PHP-FPM
+func (c OctaneConfig) Enabled() bool {
+	return c.Server != ""
+}
+
+// Validate verifica la configuración de Octane
+func (c OctaneConfig) Validate() error {
+	switch c.Server {
+	case "", OctaneServerSwoole, OctaneServerRoadRunner, OctaneServerFrankenPHP:
+	default:
+		return fmt.Errorf("servidor de Octane no soportado: %s (use swoole, roadrunner o frankenphp)", c.Server)
+	}
+	if c.Workers < 0 || c.MaxRequests < 0 {
+		return fmt.Errorf("octane: los workers y max_requests no pueden ser negativos")
+	}
+	return nil
+}
+
+// Command devuelve el comando 'octane:start' que escucha solo en localhost en el puerto indicado
+func (c OctaneConfig) Command(php string, port int) string {
+	args := []string{php, "artisan", "octane:start",
+		"--server=" + c.Server, "--host=127.0.0.1", fmt.Sprintf("--port=%d", port), "--no-interaction"}
+	if c.Workers > 0 {
+		args = append(args, fmt.Sprintf("--workers=%d", c.Workers))
+	}
+	if c.MaxRequests > 0 {
+		args = append(args, fmt.Sprintf("--max-requests=%d", c.MaxRequests))
+	}
+	return strings.Join(args, " ")
+}
+
+// Binary devuelve el binario que Octane descarga en la raíz del proyecto para el servidor
+func (c OctaneConfig) Binary() string {
+	switch c.Server {
+	case OctaneServerRoadRunner:
+		return "rr"
+	case OctaneServerFrankenPHP:
+		return "frankenphp"
+	default:
+		return ""
+	}
+}
+
+// CheckSwooleExtension verifica que PHP tenga cargada la extensión de Swoole u OpenSwoole
+func CheckSwooleExtension(php string) error {
+	output, err := exec.Command(php, "-m").Output()
+	if err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("error al listar las extensiones de %s", php), err)
+	}
+	for _, module := range strings.Split(string(output), "\n") {
+		switch strings.TrimSpace(strings.ToLower(module)) {
+		case "swoole", "openswoole":
+			return nil
+		}
+	}
+	return NewError(ErrorValidacion,
+		fmt.Sprintf("Octane con Swoole necesita la extensión swoole u openswoole en %s (pecl install swoole)", php), nil)
+}
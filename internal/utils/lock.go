@@ -0,0 +1,167 @@
+// internal/utils/lock.go
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval es la espera entre intentos al esperar un bloqueo
+const lockPollInterval = time.Second
+
+// LockInfo describe quién tiene el bloqueo de un sitio
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	User      string    `json:"user"`
+	Operation string    `json:"operation"`
+	Since     time.Time `json:"since"`
+}
+
+// SiteLock es un bloqueo exclusivo sobre un sitio (flock sobre <estado>/lock).
+// El sistema operativo lo libera si el proceso termina inesperadamente.
+type SiteLock struct {
+	file *os.File
+	path string
+}
+
+// AcquireSiteLock obtiene el bloqueo de un sitio para una operación. Si otro proceso lo
+// tiene, devuelve un error indicando quién y desde cuándo, o espera si wait es true.
+func AcquireSiteLock(domain, operation string, wait bool) (*SiteLock, error) {
+	dir, err := EnsureSiteStateDir(domain)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "lock")
+
+	waiting := false
+	for {
+		lock, holder, err := tryLock(path)
+		if err != nil {
+			return nil, err
+		}
+		if lock != nil {
+			if err := lock.writeInfo(operation); err != nil {
+				lock.Release()
+				return nil, err
+			}
+			return lock, nil
+		}
+
+		// El sistema libera flock cuando termina el proceso que lo tomó, así que un bloqueo
+		// tomado nunca es huérfano: si el PID registrado ya no existe, otro proceso conserva el
+		// descriptor. El archivo no se elimina: otro proceso podría tomar el bloqueo a la vez.
+		holderText := describeHolder(holder)
+		if holder != nil && holder.PID > 0 && !processAlive(holder.PID) {
+			holderText = fmt.Sprintf("%s; el PID %d ya no existe, pero otro proceso conserva el bloqueo", holderText, holder.PID)
+		}
+
+		if !wait {
+			return nil, NewError(ErrorValidacion, fmt.Sprintf("el sitio %s está bloqueado: %s. Usa --wait para esperar", domain, holderText), nil)
+		}
+		if !waiting {
+			fmt.Printf("El sitio %s está bloqueado: %s. Esperando...\n", domain, holderText)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// tryLock intenta tomar el bloqueo sin esperar. Si está tomado devuelve la información
+// de quien lo tiene.
+func tryLock(path string) (*SiteLock, *LockInfo, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al abrir el archivo de bloqueo %s: %v", path, err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		defer file.Close()
+		if err != syscall.EWOULDBLOCK {
+			return nil, nil, fmt.Errorf("error al bloquear %s: %v", path, err)
+		}
+		return nil, readLockInfo(file), nil
+	}
+
+	// Si el archivo fue reemplazado mientras se tomaba el bloqueo (por ejemplo, al borrar el
+	// directorio de estado), volver a intentar
+	if current, err := os.Stat(path); err != nil || !sameFile(file, current) {
+		file.Close()
+		return tryLock(path)
+	}
+
+	return &SiteLock{file: file, path: path}, nil, nil
+}
+
+// writeInfo guarda en el archivo de bloqueo quién lo tiene
+func (l *SiteLock) writeInfo(operation string) error {
+	info := LockInfo{
+		PID:       os.Getpid(),
+		User:      InvokingUser(),
+		Operation: operation,
+		Since:     time.Now(),
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("error al escribir el bloqueo: %v", err)
+	}
+	if _, err := l.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("error al escribir el bloqueo: %v", err)
+	}
+	return nil
+}
+
+// Release libera el bloqueo
+func (l *SiteLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Truncate(0)
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	l.file = nil
+}
+
+// readLockInfo lee la información del proceso que tiene el bloqueo
+func readLockInfo(file *os.File) *LockInfo {
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// describeHolder describe quién tiene un bloqueo para los mensajes al usuario
+func describeHolder(info *LockInfo) string {
+	if info == nil {
+		return "otro proceso tiene el bloqueo"
+	}
+	return fmt.Sprintf("%s ejecuta '%s' desde %s (PID %d)",
+		info.User, info.Operation, info.Since.Format("2006-01-02 15:04:05"), info.PID)
+}
+
+// processAlive verifica si un proceso existe
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// sameFile verifica que un archivo abierto siga siendo el de la ruta indicada
+func sameFile(file *os.File, info os.FileInfo) bool {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(openInfo, info)
+}
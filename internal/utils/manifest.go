@@ -0,0 +1,254 @@
+// internal/utils/manifest.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/elmersh/sitemanager/internal/dotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFileName es el nombre del archivo de despliegue que puede incluir un repositorio
+const ManifestFileName = ".sitemanager.yml"
+
+// DefaultStepTimeout es el tiempo máximo de ejecución de un paso si no se especifica
+const DefaultStepTimeout = 15 * time.Minute
+
+// envKeyPattern valida los nombres de variables de entorno
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ProjectManifest representa el archivo .sitemanager.yml de un repositorio
+type ProjectManifest struct {
+	Version      int                `yaml:"version"`
+	Type         string             `yaml:"type"`
+	Subdirectory string             `yaml:"subdirectory"`
+	PublicDir    string             `yaml:"public_dir"`
+	Output       string             `yaml:"output"`
+	Start        string             `yaml:"start"`
+	Node         string             `yaml:"node"`
+	Queue        QueueConfig        `yaml:"queue"`
+	Scheduler    *bool              `yaml:"scheduler"`
+	Octane       OctaneConfig       `yaml:"octane"`
+	Env          ManifestEnv        `yaml:"env"`
+	Hooks        ManifestHooks      `yaml:"hooks"`
+	Health       HealthCheckOptions `yaml:"health"`
+}
+
+// ManifestEnv contiene los requisitos de entorno declarados por el proyecto
+type ManifestEnv struct {
+	Required []string `yaml:"required"`
+	// Schema declara el tipo de las variables; Strict detiene el despliegue si el .env
+	// no pasa la verificación
+	Schema map[string]EnvSchemaEntry `yaml:"schema"`
+	Strict bool                      `yaml:"strict"`
+}
+
+// ManifestHooks contiene los pasos que se ejecutan en cada fase del despliegue
+type ManifestHooks struct {
+	Build       []DeployStep `yaml:"build"`
+	PreMigrate  []DeployStep `yaml:"pre_migrate"`
+	PostDeploy  []DeployStep `yaml:"post_deploy"`
+	HealthCheck []DeployStep `yaml:"health_check"`
+}
+
+// DeployStep es un comando que se ejecuta como el usuario del sitio
+type DeployStep struct {
+	Name    string        `yaml:"name"`
+	Run     string        `yaml:"run"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// UnmarshalYAML permite declarar un paso como texto simple o como objeto
+func (s *DeployStep) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		s.Run = node.Value
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("línea %d: un paso debe ser un comando o un objeto con 'run'", node.Line)
+	}
+
+	// Rechazar claves desconocidas para detectar errores de escritura
+	for i := 0; i < len(node.Content); i += 2 {
+		switch key := node.Content[i].Value; key {
+		case "name", "run", "timeout":
+		default:
+			return fmt.Errorf("línea %d: clave desconocida en paso: %s", node.Content[i].Line, key)
+		}
+	}
+
+	type rawStep DeployStep
+	var raw rawStep
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*s = DeployStep(raw)
+	return nil
+}
+
+// Label devuelve el nombre del paso o el comando si no tiene nombre
+func (s DeployStep) Label() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Run
+}
+
+// EffectiveTimeout devuelve el tiempo máximo del paso aplicando el valor por defecto
+func (s DeployStep) EffectiveTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultStepTimeout
+}
+
+// LoadProjectManifest carga y valida el archivo .sitemanager.yml de un repositorio.
+// Devuelve nil sin error si el archivo no existe.
+func LoadProjectManifest(repoDir string) (*ProjectManifest, error) {
+	manifestPath := filepath.Join(repoDir, ManifestFileName)
+	data, err := os.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", ManifestFileName, err)
+	}
+
+	var manifest ProjectManifest
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("%s no es válido", ManifestFileName), err)
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("%s no es válido", ManifestFileName), err)
+	}
+
+	return &manifest, nil
+}
+
+// Validate verifica que el manifiesto cumpla con el esquema soportado
+func (m *ProjectManifest) Validate() error {
+	if m.Version != 0 && m.Version != 1 {
+		return fmt.Errorf("versión de esquema no soportada: %d", m.Version)
+	}
+
+	switch m.Type {
+	case "", "laravel", "nodejs":
+	default:
+		return fmt.Errorf("tipo de aplicación no soportado: %s", m.Type)
+	}
+
+	if err := validateRelativePath("subdirectory", m.Subdirectory); err != nil {
+		return err
+	}
+	if err := validateRelativePath("public_dir", m.PublicDir); err != nil {
+		return err
+	}
+	if err := validateRelativePath("output", m.Output); err != nil {
+		return err
+	}
+	if HasControlChars(m.Start) || HasControlChars(m.Node) {
+		return fmt.Errorf("start y node no pueden contener saltos de línea ni caracteres de control")
+	}
+	if m.Output != "" && m.Start != "" {
+		return fmt.Errorf("output y start no pueden usarse juntos: un build estático no ejecuta un proceso")
+	}
+
+	if err := m.Queue.Validate(); err != nil {
+		return err
+	}
+	if err := m.Octane.Validate(); err != nil {
+		return err
+	}
+
+	for _, key := range m.Env.Required {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("env.required: nombre de variable inválido: %q", key)
+		}
+	}
+	for key, entry := range m.Env.Schema {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("env.schema: nombre de variable inválido: %q", key)
+		}
+		if err := entry.Validate(); err != nil {
+			return fmt.Errorf("env.schema.%s: %v", key, err)
+		}
+	}
+
+	if m.Health.ExpectedStatus != 0 && (m.Health.ExpectedStatus < 100 || m.Health.ExpectedStatus > 599) {
+		return fmt.Errorf("health.status: código HTTP inválido: %d", m.Health.ExpectedStatus)
+	}
+	if m.Health.Timeout < 0 || m.Health.Interval < 0 {
+		return fmt.Errorf("health: timeout e interval no pueden ser negativos")
+	}
+	if m.Health.Path != "" && !strings.HasPrefix(m.Health.Path, "/") {
+		return fmt.Errorf("health.path debe comenzar con /")
+	}
+
+	phases := map[string][]DeployStep{
+		"build":        m.Hooks.Build,
+		"pre_migrate":  m.Hooks.PreMigrate,
+		"post_deploy":  m.Hooks.PostDeploy,
+		"health_check": m.Hooks.HealthCheck,
+	}
+	for phase, steps := range phases {
+		for i, step := range steps {
+			if strings.TrimSpace(step.Run) == "" {
+				return fmt.Errorf("hooks.%s[%d]: el comando 'run' es obligatorio", phase, i)
+			}
+			if step.Timeout < 0 {
+				return fmt.Errorf("hooks.%s[%d]: el timeout no puede ser negativo", phase, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRelativePath verifica que una ruta sea relativa y no salga del repositorio
+func validateRelativePath(field, path string) error {
+	if path == "" {
+		return nil
+	}
+	if filepath.IsAbs(path) {
+		return fmt.Errorf("%s debe ser una ruta relativa al repositorio", field)
+	}
+	clean := filepath.Clean(path)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%s no puede salir del repositorio", field)
+	}
+	return nil
+}
+
+// MissingEnvKeys devuelve las variables requeridas que no están definidas en un archivo .env
+func MissingEnvKeys(envPath string, required []string) ([]string, error) {
+	if len(required) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	env, err := dotenv.Load(envPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error al leer %s: %v", envPath, err)
+	}
+	if env != nil {
+		values = env.Resolve()
+	}
+
+	var missing []string
+	for _, key := range required {
+		if values[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/elmersh/sitemanager/internal/dotenv"
 )
 
 // NodeJSFrameworkType representa el tipo de framework de Node.js
@@ -28,6 +31,20 @@ const (
 	FrameworkVueJS NodeJSFrameworkType = "vuejs"
 	// FrameworkNuxtJS representa Nuxt.js
 	FrameworkNuxtJS NodeJSFrameworkType = "nuxtjs"
+	// FrameworkRemix representa Remix
+	FrameworkRemix NodeJSFrameworkType = "remix"
+	// FrameworkAstro representa Astro
+	FrameworkAstro NodeJSFrameworkType = "astro"
+	// FrameworkSvelteKit representa SvelteKit
+	FrameworkSvelteKit NodeJSFrameworkType = "sveltekit"
+	// FrameworkFastify representa Fastify
+	FrameworkFastify NodeJSFrameworkType = "fastify"
+	// FrameworkHono representa Hono
+	FrameworkHono NodeJSFrameworkType = "hono"
+	// FrameworkKoa representa Koa
+	FrameworkKoa NodeJSFrameworkType = "koa"
+	// FrameworkVite representa un proyecto Vite sin servidor
+	FrameworkVite NodeJSFrameworkType = "vite"
 )
 
 // NodeJSProjectInfo contiene información sobre un proyecto Node.js
@@ -46,6 +63,121 @@ type NodeJSProjectInfo struct {
 	HasNodeModules   bool
 	RequiresDatabase bool
 	DBType           string // postgresql, mysql, mongodb, etc.
+	PackageManager   PackageManager
+	Scripts          map[string]string
+	// Static indica que el build genera solo archivos estáticos que sirve Nginx desde OutputDir
+	Static    bool
+	OutputDir string
+	// SPA indica que las rutas desconocidas deben responder con index.html
+	SPA bool
+	// NextStandalone indica que Next.js genera un servidor independiente en .next/standalone
+	NextStandalone bool
+}
+
+// packageJSONInfo contiene los campos de package.json usados para detectar el framework
+type packageJSONInfo struct {
+	Main            string            `json:"main"`
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// dependency indica si alguno de los paquetes es una dependencia de producción
+func (p packageJSONInfo) dependency(names ...string) bool {
+	for _, name := range names {
+		if _, ok := p.Dependencies[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// uses indica si alguno de los paquetes está en dependencies o devDependencies
+func (p packageJSONInfo) uses(names ...string) bool {
+	for _, name := range names {
+		if _, ok := p.Dependencies[name]; ok {
+			return true
+		}
+		if _, ok := p.DevDependencies[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// usesScope indica si el proyecto usa algún paquete del scope indicado (por ejemplo @remix-run/)
+func (p packageJSONInfo) usesScope(scope string) bool {
+	for name := range p.Dependencies {
+		if strings.HasPrefix(name, scope) {
+			return true
+		}
+	}
+	for name := range p.DevDependencies {
+		if strings.HasPrefix(name, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectFramework identifica el framework del proyecto. Los frameworks con servidor propio se
+// comprueban antes que las herramientas de build, que también aparecen en sus dependencias.
+func detectFramework(info *NodeJSProjectInfo, pkg packageJSONInfo) {
+	server := true
+	switch {
+	case pkg.dependency("@nestjs/core"):
+		info.Framework = FrameworkNestJS
+	case pkg.dependency("next"):
+		info.Framework = FrameworkNextJS
+	case pkg.uses("nuxt", "nuxt3"):
+		info.Framework = FrameworkNuxtJS
+		// 'nuxt generate' prerenderiza todo el sitio en .output/public
+		if strings.Contains(pkg.Scripts["build"], "nuxt generate") {
+			info.Static, info.OutputDir = true, ".output/public"
+		}
+	case pkg.usesScope("@remix-run/"):
+		info.Framework = FrameworkRemix
+	case pkg.uses("astro"):
+		info.Framework = FrameworkAstro
+		// Sin el adaptador de Node, Astro genera un sitio estático en dist
+		if !pkg.uses("@astrojs/node") {
+			info.Static, info.OutputDir = true, "dist"
+		}
+	case pkg.uses("@sveltejs/kit"):
+		info.Framework = FrameworkSvelteKit
+		if pkg.uses("@sveltejs/adapter-static") {
+			info.Static, info.OutputDir = true, "build"
+		}
+	case pkg.dependency("fastify"):
+		info.Framework = FrameworkFastify
+	case pkg.dependency("hono"):
+		info.Framework = FrameworkHono
+	case pkg.dependency("koa"):
+		info.Framework = FrameworkKoa
+	case pkg.dependency("express"):
+		info.Framework = FrameworkExpress
+	case pkg.uses("react-scripts"):
+		info.Framework = FrameworkReactJS
+		info.Static, info.OutputDir, info.SPA = true, "build", true
+	case pkg.uses("@vue/cli-service"):
+		info.Framework = FrameworkVueJS
+		info.Static, info.OutputDir, info.SPA = true, "dist", true
+	case pkg.uses("vite"):
+		info.Framework = FrameworkVite
+		if pkg.uses("react") {
+			info.Framework = FrameworkReactJS
+		} else if pkg.uses("vue") {
+			info.Framework = FrameworkVueJS
+		}
+		info.Static, info.OutputDir, info.SPA = true, "dist", true
+	default:
+		server = false
+	}
+
+	if server && !info.Static {
+		info.DefaultPort = 3000
+		info.RequiresEnv = true
+	}
 }
 
 // DetectNodeJSFramework detecta el framework de Node.js utilizado en un proyecto
@@ -83,6 +215,12 @@ func DetectNodeJSFramework(appDir string) (*NodeJSProjectInfo, error) {
 		return info, fmt.Errorf("error al parsear package.json: %v", err)
 	}
 
+	// Detectar el gestor de paquetes (npm, pnpm, yarn, bun)
+	info.PackageManager, err = DetectPackageManager(appDir)
+	if err != nil {
+		return info, err
+	}
+
 	// Detectar si usa TypeScript
 	if deps, ok := packageJSON["dependencies"].(map[string]interface{}); ok {
 		if _, exists := deps["typescript"]; exists {
@@ -101,31 +239,19 @@ func DetectNodeJSFramework(appDir string) (*NodeJSProjectInfo, error) {
 		info.HasTypeScript = true
 	}
 
-	// Detectar NestJS
-	if deps, ok := packageJSON["dependencies"].(map[string]interface{}); ok {
-		if _, exists := deps["@nestjs/core"]; exists {
-			info.Framework = FrameworkNestJS
-			info.DefaultPort = 3000
-			info.RequiresEnv = true
-		}
-	}
-
-	// Detectar NextJS
-	if deps, ok := packageJSON["dependencies"].(map[string]interface{}); ok {
-		if _, exists := deps["next"]; exists {
-			info.Framework = FrameworkNextJS
-			info.DefaultPort = 3000
-			info.RequiresEnv = true
-		}
+	// Detectar el framework a partir de las dependencias y los scripts
+	var pkg packageJSONInfo
+	if err := json.Unmarshal(packageData, &pkg); err != nil {
+		return info, fmt.Errorf("error al parsear package.json: %v", err)
 	}
-
-	// Detectar Express
-	if deps, ok := packageJSON["dependencies"].(map[string]interface{}); ok {
-		if _, exists := deps["express"]; exists && info.Framework == FrameworkUnknown {
-			info.Framework = FrameworkExpress
-			info.DefaultPort = 3000
-			info.RequiresEnv = true
-		}
+	info.Scripts = pkg.Scripts
+	info.StartCommand = pkg.Scripts["start"]
+	info.BuildCommand = pkg.Scripts["build"]
+	info.DevCommand = pkg.Scripts["dev"]
+	info.MainFile = pkg.Main
+	detectFramework(info, pkg)
+	if info.Framework == FrameworkNextJS {
+		info.NextStandalone = detectNextStandalone(appDir)
 	}
 
 	// Detectar Prisma
@@ -167,55 +293,25 @@ func DetectNodeJSFramework(appDir string) (*NodeJSProjectInfo, error) {
 	// Verificar más detalladamente el tipo de base de datos
 	// Si se detectó Prisma pero no se pudo determinar el tipo de base de datos
 	if info.HasPrisma && info.DBType == "" {
-		// Buscar en archivo .env.example o .env si existe
-		envExamplePath := filepath.Join(appDir, ".env.example")
-		envPath := filepath.Join(appDir, ".env")
-
-		var envContent string
-
-		// Intentar leer .env.example primero
-		if _, err := os.Stat(envExamplePath); err == nil {
-			if data, err := os.ReadFile(envExamplePath); err == nil {
-				envContent = string(data)
+		// Buscar DATABASE_URL en .env.example o, si no existe, en .env
+		var env *dotenv.File
+		for _, name := range []string{".env.example", ".env"} {
+			if f, err := dotenv.Load(filepath.Join(appDir, name)); err == nil {
+				env = f
+				break
 			}
 		}
-
-		// Si no encontramos .env.example, intentar con .env
-		if envContent == "" {
-			if _, err := os.Stat(envPath); err == nil {
-				if data, err := os.ReadFile(envPath); err == nil {
-					envContent = string(data)
-				}
-			}
-		}
-
-		// Buscar DATABASE_URL en el contenido
-		if envContent != "" {
-			lines := strings.Split(envContent, "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if strings.HasPrefix(line, "DATABASE_URL=") || strings.HasPrefix(line, "DATABASE_URL =") {
-					value := strings.SplitN(line, "=", 2)[1]
-					value = strings.TrimSpace(value)
-
-					// Eliminar comillas si las hay
-					if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-						(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-						value = value[1 : len(value)-1]
-					}
-
-					// Detectar tipo de base de datos por la URL
-					if strings.HasPrefix(value, "postgresql://") {
-						info.DBType = "postgresql"
-					} else if strings.HasPrefix(value, "mysql://") {
-						info.DBType = "mysql"
-					} else if strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "sqlite:") {
-						info.DBType = "sqlite"
-					} else if strings.HasPrefix(value, "mongodb://") {
-						info.DBType = "mongodb"
-					}
-
-					break
+		if env != nil {
+			if value, ok := env.Resolve()["DATABASE_URL"]; ok {
+				// Detectar tipo de base de datos por la URL
+				if strings.HasPrefix(value, "postgresql://") {
+					info.DBType = "postgresql"
+				} else if strings.HasPrefix(value, "mysql://") {
+					info.DBType = "mysql"
+				} else if strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "sqlite:") {
+					info.DBType = "sqlite"
+				} else if strings.HasPrefix(value, "mongodb://") {
+					info.DBType = "mongodb"
 				}
 			}
 		}
@@ -266,272 +362,237 @@ func DetectNodeJSFramework(appDir string) (*NodeJSProjectInfo, error) {
 	}
 
 	// Leer variables de .env.example si existe
-	envExamplePath := filepath.Join(appDir, ".env.example")
-	if _, err := os.Stat(envExamplePath); err == nil {
-		// Leer el archivo .env.example
-		data, err := os.ReadFile(envExamplePath)
-		if err == nil {
-			// Parsear variables
-			lines := strings.Split(string(data), "\n")
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				parts := strings.SplitN(line, "=", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					value := strings.TrimSpace(parts[1])
-
-					// Eliminar comillas si las hay
-					if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-						(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-						value = value[1 : len(value)-1]
-					}
-
-					info.EnvVars[key] = value
-				}
-			}
+	if example, err := dotenv.Load(filepath.Join(appDir, ".env.example")); err == nil {
+		for key, value := range example.Map() {
+			info.EnvVars[key] = value
 		}
 	}
 
 	return info, nil
 }
 
-// ConfigureNodeJSEnv configura el archivo .env para una aplicación Node.js
-func ConfigureNodeJSEnv(appDir string, projectInfo *NodeJSProjectInfo, userValues map[string]string) error {
+// ConfigureNodeJSEnv configura el archivo .env para una aplicación Node.js. Las variables se
+// definen sobre el .env existente conservando su formato; notes se agregan como comentarios.
+func ConfigureNodeJSEnv(appDir string, projectInfo *NodeJSProjectInfo, userValues map[string]string, notes ...string) error {
 	// Ruta del archivo .env.example
 	examplePath := filepath.Join(appDir, ".env.example")
 
 	// Ruta del archivo .env
 	envPath := filepath.Join(appDir, ".env")
 
-	// Variables a configurar
-	envVars := make(map[string]string)
-
-	// Si ya existe un archivo .env, leerlo primero
-	if _, err := os.Stat(envPath); err == nil {
-		// El archivo .env ya existe, leerlo
-		data, err := os.ReadFile(envPath)
-		if err != nil {
+	// Si ya existe un archivo .env, partir de él
+	env := dotenv.New()
+	mode := EnvFileMode
+	isNew := true
+	if info, err := os.Stat(envPath); err == nil {
+		if env, err = dotenv.Load(envPath); err != nil {
 			return fmt.Errorf("error al leer archivo .env existente: %v", err)
 		}
-
-		// Parsear variables existentes
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				// Eliminar comillas alrededor del valor si existen
-				if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-					(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-					value = value[1 : len(value)-1]
-				}
-
-				envVars[key] = value
-			}
-		}
+		mode = info.Mode().Perm()
+		isNew = false
+	} else {
+		env.AddComment("Archivo generado por SiteManager")
+		env.AddBlank()
 	}
 
-	// Verificar si hay un archivo .env.example
-	var exampleVars map[string]string
+	// Llenar projectInfo.EnvVars con las variables de ejemplo que el .env aún no define
 	if _, err := os.Stat(examplePath); err == nil {
-		// El archivo .env.example existe, leerlo
-		data, err := os.ReadFile(examplePath)
+		example, err := dotenv.Load(examplePath)
 		if err != nil {
 			return fmt.Errorf("error al leer archivo .env.example: %v", err)
 		}
-
-		// Parsear variables de ejemplo
-		exampleVars = make(map[string]string)
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				// Eliminar comillas alrededor del valor si existen
-				if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-					(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-					value = value[1 : len(value)-1]
-				}
-
-				// Solo agregar a exampleVars si la clave no está ya en envVars
-				if _, exists := envVars[key]; !exists {
-					exampleVars[key] = value
-				}
+		for _, v := range example.Vars() {
+			if !env.Has(v.Key) {
+				projectInfo.EnvVars[v.Key] = v.Value
 			}
 		}
-
-		// Llenar projectInfo.EnvVars con las variables de ejemplo
-		for key, value := range exampleVars {
-			projectInfo.EnvVars[key] = value
-		}
 	}
 
-	// Agregar valores proporcionados por el usuario
+	// Priorizar las variables de base de datos y de NextJS; el resto en orden alfabético
+	groups := []struct {
+		title string
+		keys  []string
+	}{
+		{"Configuración de base de datos", []string{"DATABASE_URL", "DB_CONNECTION", "DB_HOST", "DB_PORT", "DB_DATABASE", "DB_USERNAME", "DB_PASSWORD"}},
+		{"Configuración de NextJS", []string{"NEXT_PUBLIC_API_URL", "NEXT_PUBLIC_IMAGE_DOMAINS", "NEXT_PUBLIC_IMAGES_URL", "NEXT_PUBLIC_PWA_ENABLED", "NEXT_PUBLIC_BODY_SIZE_LIMIT"}},
+		{"Otras configuraciones", nil},
+	}
+	pending := make(map[string]string, len(userValues))
 	for key, value := range userValues {
-		envVars[key] = value
-	}
-
-	// Ahora tenemos todas las variables, incluidas las existentes y las nuevas
-	// Generar contenido del archivo .env
-	var content strings.Builder
-
-	// Agregar encabezado
-	content.WriteString("# Archivo generado por SiteManager\n\n")
-
-	// Priorizar las variables relacionadas con la base de datos
-	dbKeys := []string{
-		"DATABASE_URL",
-		"DB_CONNECTION",
-		"DB_HOST",
-		"DB_PORT",
-		"DB_DATABASE",
-		"DB_USERNAME",
-		"DB_PASSWORD",
-	}
-
-	// Agregar primero las variables de base de datos
-	content.WriteString("# Configuración de base de datos\n")
-	for _, key := range dbKeys {
-		if value, exists := envVars[key]; exists {
-			// Verificar si el valor necesita comillas
-			if strings.Contains(value, " ") || strings.Contains(value, "#") {
-				content.WriteString(fmt.Sprintf("%s=\"%s\"\n", key, value))
-			} else {
-				content.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+		pending[key] = value
+	}
+	for _, group := range groups {
+		keys := group.keys
+		if keys == nil {
+			for key := range pending {
+				keys = append(keys, key)
 			}
-			// Eliminar la clave del mapa para no repetirla después
-			delete(envVars, key)
+			sort.Strings(keys)
 		}
-	}
-	content.WriteString("\n")
-
-	// Agregar variables de NextJS si existen
-	nextjsKeys := []string{
-		"NEXT_PUBLIC_API_URL",
-		"NEXT_PUBLIC_IMAGE_DOMAINS",
-		"NEXT_PUBLIC_IMAGES_URL",
-		"NEXT_PUBLIC_PWA_ENABLED",
-		"NEXT_PUBLIC_BODY_SIZE_LIMIT",
-	}
-
-	hasNextJSVars := false
-	for _, key := range nextjsKeys {
-		if _, exists := envVars[key]; exists {
-			if !hasNextJSVars {
-				content.WriteString("# Configuración de NextJS\n")
-				hasNextJSVars = true
+		started := false
+		for _, key := range keys {
+			value, ok := pending[key]
+			if !ok {
+				continue
 			}
-			value := envVars[key]
-			if strings.Contains(value, " ") || strings.Contains(value, "#") {
-				content.WriteString(fmt.Sprintf("%s=\"%s\"\n", key, value))
-			} else {
-				content.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+			// En un archivo nuevo cada grupo lleva su encabezado
+			if isNew && !started {
+				env.AddComment(group.title)
+				started = true
 			}
-			delete(envVars, key)
+			env.Set(key, value)
+			delete(pending, key)
+		}
+		if started {
+			env.AddBlank()
 		}
 	}
-	if hasNextJSVars {
-		content.WriteString("\n")
-	}
-
-	// Luego agregar el resto de variables
-	content.WriteString("# Otras configuraciones\n")
-
-	// Ordenar claves para una salida predecible
-	keys := make([]string, 0, len(envVars))
-	for key := range envVars {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
 
-	for _, key := range keys {
-		value := envVars[key]
-		// Verificar si el valor necesita comillas
-		if strings.Contains(value, " ") || strings.Contains(value, "#") {
-			content.WriteString(fmt.Sprintf("%s=\"%s\"\n", key, value))
-		} else {
-			content.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+	blank := false
+	for _, note := range notes {
+		if env.HasComment(note) {
+			continue
+		}
+		if !blank {
+			env.AddBlank()
+			blank = true
 		}
+		env.AddComment(note)
 	}
 
 	// Escribir el archivo .env
-	if err := os.WriteFile(envPath, []byte(content.String()), 0644); err != nil {
+	if err := env.Write(envPath, mode); err != nil {
 		return fmt.Errorf("error al escribir archivo .env: %v", err)
 	}
 
 	return nil
 }
 
-// GetNodeJSStartCommand devuelve el comando para iniciar una aplicación Node.js
-func GetNodeJSStartCommand(info *NodeJSProjectInfo) string {
-	// Si hay un comando start explícito, usarlo
-	if info.StartCommand != "" {
-		return "npm run start"
+// nextStandalonePattern reconoce la opción output: 'standalone' de next.config
+var nextStandalonePattern = regexp.MustCompile(`output\s*:\s*["'\x60]standalone["'\x60]`)
+
+// detectNextStandalone indica si next.config activa la salida standalone
+func detectNextStandalone(appDir string) bool {
+	for _, name := range []string{"next.config.js", "next.config.mjs", "next.config.cjs", "next.config.ts", "next.config.mts"} {
+		data, err := os.ReadFile(filepath.Join(appDir, name))
+		if err == nil && nextStandalonePattern.Match(data) {
+			return true
+		}
 	}
+	return false
+}
+
+// NextStandaloneServer es el servidor que genera Next.js con output: 'standalone'
+const NextStandaloneServer = ".next/standalone/server.js"
 
-	// Si no hay comando start, usar el framework para determinar el comando
+// GetNodeJSStartCommand devuelve el comando para iniciar una aplicación Node.js. Todos los
+// comandos leen el puerto de la variable PORT que define el gestor de procesos.
+func GetNodeJSStartCommand(info *NodeJSProjectInfo) string {
+	pm := info.PackageManager
 	switch info.Framework {
 	case FrameworkNestJS:
+		// start suele ser 'nest start', que compila de nuevo; start:prod ejecuta el build
+		if info.Scripts["start:prod"] != "" {
+			return pm.Run("start:prod")
+		}
+		if info.StartCommand != "" {
+			return pm.Run("start")
+		}
 		if info.HasTypeScript {
 			return "node dist/src/main.js"
 		}
 		return "node src/main.js"
 	case FrameworkNextJS:
-		return "next start"
-	case FrameworkExpress:
-		if info.MainFile != "" {
-			return fmt.Sprintf("node %s", info.MainFile)
+		// El servidor standalone incluye sus dependencias y no necesita next
+		if info.NextStandalone {
+			return "node " + NextStandaloneServer
 		}
-		return "node index.js"
-	case FrameworkReactJS:
-		return "serve -s build"
-	default:
-		// Comando genérico
-		if info.MainFile != "" {
-			return fmt.Sprintf("node %s", info.MainFile)
+		return pm.Exec("next start")
+	case FrameworkNuxtJS:
+		return "node .output/server/index.mjs"
+	case FrameworkRemix:
+		if info.StartCommand != "" {
+			return pm.Run("start")
 		}
-		return "node index.js"
+		return pm.Exec("remix-serve ./build/server/index.js")
+	case FrameworkAstro:
+		// El script start de Astro suele ser 'astro dev'; el adaptador de Node genera el servidor
+		return "node ./dist/server/entry.mjs"
+	case FrameworkSvelteKit:
+		// adapter-node genera el servidor en build/
+		return "node build"
 	}
+
+	// Si hay un script start explícito, usarlo
+	if info.StartCommand != "" {
+		return pm.Run("start")
+	}
+	if info.MainFile != "" {
+		return fmt.Sprintf("node %s", info.MainFile)
+	}
+	return "node index.js"
 }
 
 // GetNodeJSBuildCommand devuelve el comando para compilar una aplicación Node.js
 func GetNodeJSBuildCommand(info *NodeJSProjectInfo) string {
-	// Si hay un comando build explícito, usarlo
+	// Si hay un script build explícito, usarlo
 	if info.BuildCommand != "" {
-		return fmt.Sprintf("npm run build")
+		return info.PackageManager.Run("build")
 	}
 
-	// Si no hay comando build, usar el framework para determinar el comando
+	// Si no hay script build, usar el framework para determinar el comando
+	pm := info.PackageManager
 	switch info.Framework {
 	case FrameworkNestJS:
 		if info.HasTypeScript {
-			return "npm run build"
+			return pm.Exec("nest build")
 		}
 		return ""
 	case FrameworkNextJS:
-		return "npm run build"
+		return pm.Exec("next build")
+	case FrameworkNuxtJS:
+		return pm.Exec("nuxt build")
+	case FrameworkRemix:
+		return pm.Exec("remix build")
+	case FrameworkAstro:
+		return pm.Exec("astro build")
+	case FrameworkSvelteKit, FrameworkVite:
+		return pm.Exec("vite build")
 	case FrameworkReactJS:
-		return "react-scripts build"
+		// Create React App compila en build/, Vite en dist/
+		if info.OutputDir == "dist" {
+			return pm.Exec("vite build")
+		}
+		return pm.Exec("react-scripts build")
 	default:
 		// No hay comando build por defecto para otros frameworks
 		return ""
 	}
 }
+
+// startScriptPattern reconoce los comandos que ejecutan el script start de package.json
+var startScriptPattern = regexp.MustCompile(`^(npm|pnpm|yarn|bun)( run)? start$`)
+
+// ResolveStartScript devuelve el script "start" de package.json cuando el comando es 'npm start',
+// 'pnpm run start' o equivalente, para poder ejecutarlo directamente. En otro caso devuelve el
+// comando sin cambios.
+func ResolveStartScript(appDir, command string) string {
+	if !startScriptPattern.MatchString(command) {
+		return command
+	}
+
+	packageData, err := os.ReadFile(filepath.Join(appDir, "package.json"))
+	if err != nil {
+		return command
+	}
+	var packageJSON struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(packageData, &packageJSON); err != nil {
+		return command
+	}
+	if start := strings.TrimSpace(packageJSON.Scripts["start"]); start != "" {
+		return start
+	}
+	return command
+}
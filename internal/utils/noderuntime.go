@@ -0,0 +1,513 @@
+// internal/utils/noderuntime.go
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ubicaciones por defecto de las versiones de Node.js administradas por SiteManager
+const (
+	DefaultNodeDir      = "/opt/sitemanager/node"
+	DefaultNodeCacheDir = "/var/cache/sitemanager/node"
+	DefaultNodeMirror   = "https://nodejs.org/dist"
+)
+
+// NodeRuntime configura dónde se instalan y de dónde se obtienen las versiones de Node.js
+type NodeRuntime struct {
+	// Dir contiene una instalación por versión (v20.11.1/bin/node, ...)
+	Dir string
+	// CacheDir guarda los tarballs oficiales (node-v20.11.1-linux-x64.tar.gz)
+	CacheDir string
+	// Mirror es la URL base de las distribuciones oficiales
+	Mirror string
+	// Allowed limita las versiones mayores que se pueden usar (node_versions)
+	Allowed []string
+}
+
+// nodeRuntime es la configuración activa (node_dir, node_cache_dir, node_mirror y node_versions)
+var nodeRuntime = NodeRuntime{
+	Dir:      DefaultNodeDir,
+	CacheDir: DefaultNodeCacheDir,
+	Mirror:   DefaultNodeMirror,
+}
+
+// SetNodeRuntime establece la configuración de las versiones de Node.js
+func SetNodeRuntime(rt NodeRuntime) {
+	if rt.Dir != "" {
+		nodeRuntime.Dir = rt.Dir
+	}
+	if rt.CacheDir != "" {
+		nodeRuntime.CacheDir = rt.CacheDir
+	}
+	if rt.Mirror != "" {
+		nodeRuntime.Mirror = strings.TrimSuffix(rt.Mirror, "/")
+	}
+	nodeRuntime.Allowed = rt.Allowed
+}
+
+// NodeBinDir devuelve el directorio con los binarios (node, npm, npx) de una versión instalada
+func NodeBinDir(version string) string {
+	return filepath.Join(nodeRuntime.Dir, "v"+version, "bin")
+}
+
+// DetectNodeVersionSpec obtiene la versión de Node.js que pide un proyecto a partir de
+// .nvmrc, .node-version o el campo engines.node de package.json, en ese orden.
+// Devuelve también el archivo del que se obtuvo.
+func DetectNodeVersionSpec(appDir string) (spec string, source string) {
+	for _, name := range []string{".nvmrc", ".node-version"} {
+		data, err := os.ReadFile(filepath.Join(appDir, name))
+		if err != nil {
+			continue
+		}
+		// Solo cuenta la primera línea que no sea un comentario
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				return line, name
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(appDir, "package.json"))
+	if err != nil {
+		return "", ""
+	}
+	var packageJSON struct {
+		Engines map[string]string `json:"engines"`
+	}
+	if json.Unmarshal(data, &packageJSON) == nil && strings.TrimSpace(packageJSON.Engines["node"]) != "" {
+		return strings.TrimSpace(packageJSON.Engines["node"]), "package.json (engines.node)"
+	}
+	return "", ""
+}
+
+// EnsureNodeVersion resuelve una especificación de versión (20, 20.11, ^18.17, >=18 <21, lts/*)
+// a una versión concreta y la instala si hace falta. Se prefieren, en este orden, las
+// versiones ya instaladas, los tarballs de la caché local y la última versión del mirror.
+func EnsureNodeVersion(spec string) (string, error) {
+	constraint, err := parseNodeConstraint(spec)
+	if err != nil {
+		return "", err
+	}
+
+	if version, ok := constraint.best(installedNodeVersions()); ok {
+		return version.String(), nil
+	}
+
+	if version, ok := constraint.best(cachedNodeVersions()); ok {
+		if err := installNodeTarball(version, cachedNodeTarball(version)); err != nil {
+			return "", err
+		}
+		return version.String(), nil
+	}
+
+	remote, err := mirrorNodeVersions(constraint.lts)
+	if err != nil {
+		return "", err
+	}
+	version, ok := constraint.best(remote)
+	if !ok {
+		return "", NewError(ErrorValidacion, fmt.Sprintf("no hay una versión de Node.js que cumpla '%s'%s", spec, allowedNodeHint()), nil)
+	}
+
+	tarball, err := downloadNodeTarball(version)
+	if err != nil {
+		return "", err
+	}
+	if err := installNodeTarball(version, tarball); err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+// nodeVersion es una versión concreta de Node.js
+type nodeVersion [3]int
+
+// String devuelve la versión sin el prefijo v
+func (v nodeVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// less indica si la versión es anterior a otra
+func (v nodeVersion) less(other nodeVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+// parseNodeVersion interpreta una versión completa como v20.11.1
+func parseNodeVersion(s string) (nodeVersion, bool) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) != 3 {
+		return nodeVersion{}, false
+	}
+	var v nodeVersion
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nodeVersion{}, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// nodeComparator es una condición simple sobre la versión (>=18, ^20.1, 20.x, ...)
+type nodeComparator struct {
+	op    string
+	base  nodeVersion
+	parts int // componentes indicados en la versión base (0 = cualquiera)
+}
+
+// nodeConstraint es una especificación de versión: alternativas (||) de condiciones que deben cumplirse todas
+type nodeConstraint struct {
+	groups [][]nodeComparator
+	// lts limita la elección a versiones LTS (lts/*)
+	lts bool
+}
+
+// nodeComparatorPattern reconoce una condición con su operador y una versión parcial
+var nodeComparatorPattern = regexp.MustCompile(`^(>=|<=|>|<|=|\^|~)?v?(\d+|x|\*)(?:\.(\d+|x|\*))?(?:\.(\d+|x|\*))?$`)
+
+// nodeOperatorSpace reconoce un operador separado de su versión por espacios
+var nodeOperatorSpace = regexp.MustCompile(`(>=|<=|>|<|=)\s+`)
+
+// parseNodeConstraint interpreta una especificación de versión de Node.js
+func parseNodeConstraint(spec string) (*nodeConstraint, error) {
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "", "node", "latest", "stable", "current", "*", "x":
+		return &nodeConstraint{groups: [][]nodeComparator{{}}}, nil
+	case "lts/*", "lts":
+		return &nodeConstraint{groups: [][]nodeComparator{{}}, lts: true}, nil
+	}
+	if strings.HasPrefix(spec, "lts/") {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("versión de Node.js no soportada: %s (use lts/* o un número de versión)", spec), nil)
+	}
+
+	constraint := &nodeConstraint{}
+	for _, alternative := range strings.Split(spec, "||") {
+		// ">= 18" se normaliza a ">=18"
+		fields := strings.Fields(nodeOperatorSpace.ReplaceAllString(alternative, "$1"))
+		if len(fields) == 0 {
+			return nil, NewError(ErrorValidacion, fmt.Sprintf("especificación de versión de Node.js no válida: %s", spec), nil)
+		}
+		var group []nodeComparator
+		for _, field := range fields {
+			match := nodeComparatorPattern.FindStringSubmatch(field)
+			if match == nil {
+				return nil, NewError(ErrorValidacion, fmt.Sprintf("especificación de versión de Node.js no válida: %s", spec), nil)
+			}
+			comparator := nodeComparator{op: match[1]}
+			for i, part := range match[2:] {
+				if part == "" || part == "x" || part == "*" {
+					break
+				}
+				comparator.base[i], _ = strconv.Atoi(part)
+				comparator.parts = i + 1
+			}
+			group = append(group, comparator)
+		}
+		constraint.groups = append(constraint.groups, group)
+	}
+	return constraint, nil
+}
+
+// matches indica si una versión cumple la especificación y las versiones permitidas
+func (c *nodeConstraint) matches(v nodeVersion) bool {
+	if !nodeMajorAllowed(v[0]) {
+		return false
+	}
+	// Sin información del mirror, las versiones mayores pares son las LTS
+	if c.lts && v[0]%2 != 0 {
+		return false
+	}
+	for _, group := range c.groups {
+		ok := true
+		for _, comparator := range group {
+			if !comparator.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// best devuelve la versión más reciente que cumple la especificación
+func (c *nodeConstraint) best(versions []nodeVersion) (nodeVersion, bool) {
+	var best nodeVersion
+	found := false
+	for _, v := range versions {
+		if c.matches(v) && (!found || best.less(v)) {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// matches indica si una versión cumple la condición
+func (c nodeComparator) matches(v nodeVersion) bool {
+	if c.parts == 0 {
+		return true
+	}
+	// upper es la primera versión posterior al rango indicado (20.11 -> 20.12.0)
+	upper := c.base
+	upper[c.parts-1]++
+	for i := c.parts; i < len(upper); i++ {
+		upper[i] = 0
+	}
+
+	switch c.op {
+	case "", "=":
+		return !v.less(c.base) && v.less(upper)
+	case ">=":
+		return !v.less(c.base)
+	case ">":
+		return !v.less(upper)
+	case "<":
+		return v.less(c.base)
+	case "<=":
+		return v.less(upper)
+	case "^":
+		return !v.less(c.base) && v[0] == c.base[0]
+	case "~":
+		if c.parts == 1 {
+			return !v.less(c.base) && v[0] == c.base[0]
+		}
+		return !v.less(c.base) && v[0] == c.base[0] && v[1] == c.base[1]
+	}
+	return false
+}
+
+// nodeMajorAllowed indica si la versión mayor está en la lista de versiones permitidas
+func nodeMajorAllowed(major int) bool {
+	if len(nodeRuntime.Allowed) == 0 {
+		return true
+	}
+	for _, allowed := range nodeRuntime.Allowed {
+		if strings.TrimPrefix(allowed, "v") == strconv.Itoa(major) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedNodeHint describe las versiones permitidas para los mensajes de error
+func allowedNodeHint() string {
+	if len(nodeRuntime.Allowed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" entre las versiones permitidas (node_versions: %s)", strings.Join(nodeRuntime.Allowed, ", "))
+}
+
+// installedNodeVersions devuelve las versiones instaladas en el directorio administrado
+func installedNodeVersions() []nodeVersion {
+	entries, err := os.ReadDir(nodeRuntime.Dir)
+	if err != nil {
+		return nil
+	}
+	var versions []nodeVersion
+	for _, entry := range entries {
+		if v, ok := parseNodeVersion(entry.Name()); ok && PathExists(filepath.Join(NodeBinDir(v.String()), "node")) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// nodeDistName devuelve el nombre de la distribución oficial para la arquitectura actual
+func nodeDistName(v nodeVersion) string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x64"
+	case "arm":
+		arch = "armv7l"
+	}
+	return fmt.Sprintf("node-v%s-linux-%s", v, arch)
+}
+
+// cachedNodeTarball devuelve la ruta del tarball de una versión en la caché, o "" si no está
+func cachedNodeTarball(v nodeVersion) string {
+	for _, ext := range []string{".tar.gz", ".tar.xz"} {
+		path := filepath.Join(nodeRuntime.CacheDir, nodeDistName(v)+ext)
+		if PathExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// cachedNodeVersions devuelve las versiones disponibles en la caché de tarballs
+func cachedNodeVersions() []nodeVersion {
+	entries, err := os.ReadDir(nodeRuntime.CacheDir)
+	if err != nil {
+		return nil
+	}
+	var versions []nodeVersion
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Name(), "node-")
+		if i := strings.Index(name, "-linux-"); i > 0 {
+			if v, ok := parseNodeVersion(name[:i]); ok && cachedNodeTarball(v) != "" {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions
+}
+
+// nodeHTTPClient descarga el índice y las distribuciones de Node.js
+var nodeHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+// mirrorNodeVersions obtiene las versiones publicadas en el mirror
+func mirrorNodeVersions(ltsOnly bool) ([]nodeVersion, error) {
+	resp, err := nodeHTTPClient.Get(nodeRuntime.Mirror + "/index.json")
+	if err != nil {
+		return nil, NewError(ErrorComando, fmt.Sprintf("no se pudo consultar el mirror de Node.js (%s); copie el tarball a %s", nodeRuntime.Mirror, nodeRuntime.CacheDir), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewError(ErrorComando, fmt.Sprintf("el mirror de Node.js respondió %s", resp.Status), nil)
+	}
+
+	var index []struct {
+		Version string      `json:"version"`
+		LTS     interface{} `json:"lts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("error al interpretar el índice de versiones de Node.js: %v", err)
+	}
+
+	var versions []nodeVersion
+	for _, release := range index {
+		if lts, _ := release.LTS.(string); ltsOnly && lts == "" {
+			continue
+		}
+		if v, ok := parseNodeVersion(release.Version); ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[j].less(versions[i]) })
+	return versions, nil
+}
+
+// downloadNodeTarball descarga la distribución de una versión a la caché verificando su SHA-256
+func downloadNodeTarball(v nodeVersion) (string, error) {
+	if err := os.MkdirAll(nodeRuntime.CacheDir, 0755); err != nil {
+		return "", fmt.Errorf("error al crear la caché de Node.js: %v", err)
+	}
+
+	name := nodeDistName(v) + ".tar.gz"
+	baseURL := fmt.Sprintf("%s/v%s", nodeRuntime.Mirror, v)
+	expected, err := nodeTarballChecksum(baseURL, name)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Descargando Node.js v%s...\n", v)
+	resp, err := nodeHTTPClient.Get(baseURL + "/" + name)
+	if err != nil {
+		return "", NewError(ErrorComando, fmt.Sprintf("error al descargar %s", name), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", NewError(ErrorComando, fmt.Sprintf("error al descargar %s: %s", name, resp.Status), nil)
+	}
+
+	path := filepath.Join(nodeRuntime.CacheDir, name)
+	file, err := os.Create(path + ".part")
+	if err != nil {
+		return "", fmt.Errorf("error al crear %s: %v", path, err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	file.Close()
+	if err != nil {
+		os.Remove(path + ".part")
+		return "", fmt.Errorf("error al descargar %s: %v", name, err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != expected {
+		os.Remove(path + ".part")
+		return "", NewError(ErrorComando, fmt.Sprintf("la suma SHA-256 de %s no coincide con la publicada", name), nil)
+	}
+
+	if err := os.Rename(path+".part", path); err != nil {
+		return "", fmt.Errorf("error al guardar %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// nodeTarballChecksum obtiene la suma SHA-256 publicada de una distribución
+func nodeTarballChecksum(baseURL, name string) (string, error) {
+	resp, err := nodeHTTPClient.Get(baseURL + "/SHASUMS256.txt")
+	if err != nil {
+		return "", NewError(ErrorComando, "error al descargar SHASUMS256.txt", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", NewError(ErrorComando, fmt.Sprintf("error al descargar SHASUMS256.txt: %s", resp.Status), nil)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	return "", NewError(ErrorComando, fmt.Sprintf("no se encontró la suma SHA-256 de %s", name), nil)
+}
+
+// installNodeTarball extrae una distribución en el directorio administrado
+func installNodeTarball(v nodeVersion, tarball string) error {
+	target := filepath.Join(nodeRuntime.Dir, "v"+v.String())
+	if err := os.MkdirAll(nodeRuntime.Dir, 0755); err != nil {
+		return fmt.Errorf("error al crear %s: %v", nodeRuntime.Dir, err)
+	}
+
+	// Extraer en un directorio temporal para no dejar instalaciones a medias
+	tmpDir, err := os.MkdirTemp(nodeRuntime.Dir, ".v"+v.String()+"-")
+	if err != nil {
+		return fmt.Errorf("error al crear directorio temporal: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fmt.Printf("Instalando Node.js v%s en %s...\n", v, target)
+	if output, err := exec.Command("tar", "-xf", tarball, "-C", tmpDir, "--strip-components=1", "--no-same-owner").CombinedOutput(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("error al extraer %s", tarball), fmt.Errorf("%v\n%s", err, output))
+	}
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return fmt.Errorf("error al ajustar permisos de %s: %v", target, err)
+	}
+
+	if err := os.Rename(tmpDir, target); err != nil {
+		// Otro despliegue pudo instalar la misma versión al mismo tiempo
+		if PathExists(filepath.Join(target, "bin", "node")) {
+			return nil
+		}
+		return fmt.Errorf("error al instalar Node.js v%s: %v", v, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// internal/utils/packagemanager.go
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Gestores de paquetes de Node.js soportados
+const (
+	PackageManagerNPM  = "npm"
+	PackageManagerPNPM = "pnpm"
+	PackageManagerYarn = "yarn"
+	PackageManagerBun  = "bun"
+)
+
+// PackageManager describe el gestor de paquetes de un proyecto Node.js
+type PackageManager struct {
+	Name string
+	// Version es la versión fijada en el campo packageManager de package.json
+	Version string
+	// Lockfile es el archivo de bloqueo encontrado; vacío si el proyecto no tiene
+	Lockfile string
+}
+
+// lockfiles asocia cada archivo de bloqueo con su gestor, en orden de prioridad
+var lockfiles = []struct {
+	file    string
+	manager string
+}{
+	{"pnpm-lock.yaml", PackageManagerPNPM},
+	{"yarn.lock", PackageManagerYarn},
+	{"bun.lock", PackageManagerBun},
+	{"bun.lockb", PackageManagerBun},
+	{"package-lock.json", PackageManagerNPM},
+	{"npm-shrinkwrap.json", PackageManagerNPM},
+}
+
+// DetectPackageManager detecta el gestor de paquetes de un proyecto. El campo packageManager
+// de package.json tiene prioridad; si no existe se usa el archivo de bloqueo y, sin él, npm.
+func DetectPackageManager(appDir string) (PackageManager, error) {
+	pm := PackageManager{Name: PackageManagerNPM}
+	declared := false
+
+	if data, err := os.ReadFile(filepath.Join(appDir, "package.json")); err == nil {
+		var packageJSON struct {
+			PackageManager string `json:"packageManager"`
+		}
+		if json.Unmarshal(data, &packageJSON) == nil && packageJSON.PackageManager != "" {
+			// Formato: nombre@versión[+sha]
+			name, version, _ := strings.Cut(packageJSON.PackageManager, "@")
+			version, _, _ = strings.Cut(version, "+")
+			switch name {
+			case PackageManagerNPM, PackageManagerPNPM, PackageManagerYarn, PackageManagerBun:
+				pm.Name, pm.Version, declared = name, version, true
+			default:
+				return pm, NewError(ErrorValidacion, fmt.Sprintf("gestor de paquetes no soportado en package.json: %s", packageJSON.PackageManager), nil)
+			}
+		}
+	}
+
+	for _, lock := range lockfiles {
+		if !PathExists(filepath.Join(appDir, lock.file)) {
+			continue
+		}
+		if !declared {
+			pm.Name = lock.manager
+		}
+		if lock.manager == pm.Name {
+			pm.Lockfile = lock.file
+			break
+		}
+	}
+	return pm, nil
+}
+
+// yarnBerry indica si el proyecto usa Yarn 2 o posterior
+func (pm PackageManager) yarnBerry() bool {
+	if pm.Name != PackageManagerYarn || pm.Version == "" {
+		return false
+	}
+	major, err := strconv.Atoi(strings.SplitN(pm.Version, ".", 2)[0])
+	return err == nil && major >= 2
+}
+
+// UsesCorepack indica si el gestor se obtiene con corepack
+func (pm PackageManager) UsesCorepack() bool {
+	return pm.Name == PackageManagerPNPM || pm.Name == PackageManagerYarn
+}
+
+// String describe el gestor con su versión y archivo de bloqueo
+func (pm PackageManager) String() string {
+	s := pm.Name
+	if pm.Version != "" {
+		s += "@" + pm.Version
+	}
+	if pm.Lockfile != "" {
+		s += " (" + pm.Lockfile + ")"
+	}
+	return s
+}
+
+// InstallCommand devuelve el comando que instala las dependencias respetando el archivo de
+// bloqueo, o el que permite actualizarlo si frozen es false
+func (pm PackageManager) InstallCommand(frozen bool) string {
+	switch pm.Name {
+	case PackageManagerPNPM:
+		if frozen {
+			return "pnpm install --frozen-lockfile"
+		}
+		return "pnpm install --no-frozen-lockfile"
+	case PackageManagerYarn:
+		if pm.yarnBerry() {
+			if frozen {
+				return "yarn install --immutable"
+			}
+			return "yarn install --no-immutable"
+		}
+		if frozen {
+			return "yarn install --frozen-lockfile"
+		}
+		return "yarn install"
+	case PackageManagerBun:
+		if frozen {
+			return "bun install --frozen-lockfile"
+		}
+		return "bun install"
+	default:
+		if frozen {
+			return "npm ci"
+		}
+		return "npm install"
+	}
+}
+
+// Run devuelve el comando que ejecuta un script de package.json
+func (pm PackageManager) Run(script string) string {
+	return fmt.Sprintf("%s run %s", pm.Name, script)
+}
+
+// RunArgs devuelve el comando que ejecuta un script de package.json con argumentos adicionales
+func (pm PackageManager) RunArgs(script string, args string) string {
+	// Solo npm necesita separar los argumentos del script con --
+	if pm.Name == PackageManagerNPM {
+		return fmt.Sprintf("npm run %s -- %s", script, args)
+	}
+	return fmt.Sprintf("%s run %s %s", pm.Name, script, args)
+}
+
+// Exec devuelve el comando que ejecuta un binario instalado en node_modules
+func (pm PackageManager) Exec(command string) string {
+	switch pm.Name {
+	case PackageManagerPNPM:
+		return "pnpm exec " + command
+	case PackageManagerYarn:
+		return "yarn " + command
+	case PackageManagerBun:
+		return "bunx " + command
+	default:
+		return "npx " + command
+	}
+}
@@ -0,0 +1,94 @@
+// internal/utils/phpfpm.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+)
+
+// ProcessManagerPHPFPM identifica al servicio PHP-FPM que atiende los sitios Laravel
+const ProcessManagerPHPFPM = "php-fpm"
+
+// phpSocketPattern extrae la versión de PHP del socket de FPM (compartido o del pool del sitio)
+// en una configuración de Nginx
+var phpSocketPattern = regexp.MustCompile(`php(\d+\.\d+)-fpm(?:-[^\s;/]+)?\.sock`)
+
+// PHPFPMManager controla el servicio PHP-FPM de una versión de PHP.
+// El servicio es compartido por todos los sitios que usan esa versión.
+type PHPFPMManager struct {
+	Version string
+}
+
+// Name devuelve el nombre del gestor
+func (m *PHPFPMManager) Name() string {
+	return ProcessManagerPHPFPM
+}
+
+// ServiceName devuelve el nombre de la unidad de systemd de PHP-FPM
+func (m *PHPFPMManager) ServiceName() string {
+	return fmt.Sprintf("php%s-fpm.service", m.Version)
+}
+
+// Install no hace nada: el servicio lo instala el paquete de PHP
+func (m *PHPFPMManager) Install(app AppProcess) error {
+	return nil
+}
+
+// Start inicia el servicio PHP-FPM
+func (m *PHPFPMManager) Start(app AppProcess) error {
+	return (&SystemdManager{}).systemctl("start", m.ServiceName())
+}
+
+// Stop detiene el servicio PHP-FPM
+func (m *PHPFPMManager) Stop(app AppProcess) error {
+	return (&SystemdManager{}).systemctl("stop", m.ServiceName())
+}
+
+// Restart reinicia el servicio PHP-FPM
+func (m *PHPFPMManager) Restart(app AppProcess) error {
+	return (&SystemdManager{}).systemctl("restart", m.ServiceName())
+}
+
+// Reload recarga PHP-FPM terminando las peticiones en curso
+func (m *PHPFPMManager) Reload(app AppProcess) error {
+	return (&SystemdManager{}).systemctl("reload", m.ServiceName())
+}
+
+// Scale no está disponible: la cantidad de workers la define el pool de PHP-FPM
+func (m *PHPFPMManager) Scale(app AppProcess, instances int) error {
+	return NewError(ErrorValidacion, "el escalado de instancias no está disponible para sitios PHP; ajuste el pool de PHP-FPM", nil)
+}
+
+// Info obtiene el estado del servicio PHP-FPM
+func (m *PHPFPMManager) Info(app AppProcess) (*ProcessInfo, error) {
+	return systemdUnitInfo(m.ServiceName())
+}
+
+// Remove no hace nada: el servicio es compartido con otros sitios
+func (m *PHPFPMManager) Remove(app AppProcess) error {
+	return nil
+}
+
+// DetectPHPVersion obtiene la versión de PHP a partir del socket de FPM usado en una configuración de Nginx
+func DetectPHPVersion(nginxConfigPath string) string {
+	content, err := os.ReadFile(nginxConfigPath)
+	if err != nil {
+		return ""
+	}
+	if match := phpSocketPattern.FindSubmatch(content); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// PHPBinary devuelve el binario de PHP de una versión si está instalado, o php en otro caso
+func PHPBinary(version string) string {
+	if version != "" {
+		if path, err := exec.LookPath("php" + version); err == nil {
+			return path
+		}
+	}
+	return "php"
+}
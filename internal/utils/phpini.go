@@ -0,0 +1,174 @@
+// internal/utils/phpini.go
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// phpIniKeyPattern valida el nombre de una directiva de php.ini
+var phpIniKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z0-9_]+)*$`)
+
+// phpSizePattern reconoce los tamaños abreviados de php.ini (64M, 1G, 512K o bytes)
+var phpSizePattern = regexp.MustCompile(`^(\d+)([KkMmGg]?)$`)
+
+// protectedPHPIniKeys son las directivas que define SiteManager para aislar el pool del sitio
+var protectedPHPIniKeys = map[string]string{
+	"open_basedir":      "se limita al home del usuario del sitio",
+	"disable_functions": "use --disable-functions al crear el sitio",
+	"upload_tmp_dir":    "usa el directorio temporal privado del sitio",
+	"sys_temp_dir":      "usa el directorio temporal privado del sitio",
+	"session.save_path": "usa el directorio temporal privado del sitio",
+	"error_log":         "se escribe en el directorio de logs del sitio",
+	"log_errors":        "siempre está activado",
+}
+
+// OPcachePresets son los ajustes de OPcache por sitio que se aplican con 'sm site php-ini opcache'.
+// El tamaño de la memoria compartida y del buffer de JIT es común a todo PHP-FPM y se define en su php.ini.
+var OPcachePresets = map[string]map[string]string{
+	// production no revisa si los archivos cambiaron: cada despliegue recarga PHP-FPM
+	"production": {
+		"opcache.enable":              "1",
+		"opcache.validate_timestamps": "0",
+	},
+	"development": {
+		"opcache.enable":              "1",
+		"opcache.validate_timestamps": "1",
+		"opcache.revalidate_freq":     "0",
+	},
+	"jit": {
+		"opcache.enable":              "1",
+		"opcache.validate_timestamps": "0",
+		"opcache.jit":                 "tracing",
+	},
+	"off": {
+		"opcache.enable": "0",
+	},
+	// default elimina los ajustes de OPcache del sitio y vuelve a los del servidor
+	"default": {},
+}
+
+// OPcachePresetNames devuelve los nombres de los presets de OPcache ordenados
+func OPcachePresetNames() []string {
+	names := make([]string, 0, len(OPcachePresets))
+	for name := range OPcachePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyOPcachePreset reemplaza los ajustes de OPcache de un sitio por los de un preset
+func ApplyOPcachePreset(ini map[string]string, preset string) error {
+	values, ok := OPcachePresets[preset]
+	if !ok {
+		return NewError(ErrorValidacion,
+			fmt.Sprintf("preset de OPcache desconocido: %s (%s)", preset, strings.Join(OPcachePresetNames(), ", ")), nil)
+	}
+	for key := range ini {
+		if strings.HasPrefix(key, "opcache.") {
+			delete(ini, key)
+		}
+	}
+	for key, value := range values {
+		ini[key] = value
+	}
+	return nil
+}
+
+// ParsePHPIniDirective separa una asignación 'clave=valor' de php.ini y la valida
+func ParsePHPIniDirective(assignment string) (string, string, error) {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return "", "", NewError(ErrorValidacion, fmt.Sprintf("directiva no válida: %s (use clave=valor)", assignment), nil)
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if err := ValidatePHPIniDirective(key, value); err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// ValidatePHPIniDirective verifica que una directiva pueda escribirse en el pool del sitio
+func ValidatePHPIniDirective(key, value string) error {
+	if !phpIniKeyPattern.MatchString(key) {
+		return NewError(ErrorValidacion, fmt.Sprintf("nombre de directiva no válido: %s", key), nil)
+	}
+	if reason, ok := protectedPHPIniKeys[key]; ok {
+		return NewError(ErrorValidacion, fmt.Sprintf("%s no se puede modificar: %s", key, reason), nil)
+	}
+	if value == "" || strings.ContainsAny(value, "\n\r;\"") {
+		return NewError(ErrorValidacion, fmt.Sprintf("valor no válido para %s: %q", key, value), nil)
+	}
+	switch key {
+	case "upload_max_filesize", "post_max_size", "memory_limit":
+		if value != "-1" && !phpSizePattern.MatchString(value) {
+			return NewError(ErrorValidacion, fmt.Sprintf("%s debe ser un tamaño como 64M o 1G", key), nil)
+		}
+	}
+	return nil
+}
+
+// isPHPIniFlag indica si un valor es booleano y se escribe con php_admin_flag
+func isPHPIniFlag(value string) bool {
+	switch strings.ToLower(value) {
+	case "on", "off":
+		return true
+	}
+	return false
+}
+
+// parsePHPSize convierte un tamaño de php.ini a bytes
+func parsePHPSize(value string) (int64, bool) {
+	match := phpSizePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	switch strings.ToUpper(match[2]) {
+	case "K":
+		size <<= 10
+	case "M":
+		size <<= 20
+	case "G":
+		size <<= 30
+	}
+	return size, true
+}
+
+// PHPIniBodySize devuelve el client_max_body_size de Nginx que corresponde a los límites de subida
+// del sitio (el mayor entre upload_max_filesize y post_max_size), o "" si el sitio no los define.
+// Un límite de 0 en PHP significa sin límite, igual que en Nginx.
+func PHPIniBodySize(ini map[string]string) string {
+	var max int64 = -1
+	for _, key := range []string{"upload_max_filesize", "post_max_size"} {
+		size, ok := parsePHPSize(ini[key])
+		if !ok {
+			continue
+		}
+		if size == 0 {
+			return "0"
+		}
+		if size > max {
+			max = size
+		}
+	}
+	switch {
+	case max < 0:
+		return ""
+	case max%(1<<30) == 0:
+		return fmt.Sprintf("%dG", max>>30)
+	case max%(1<<20) == 0:
+		return fmt.Sprintf("%dM", max>>20)
+	case max%(1<<10) == 0:
+		return fmt.Sprintf("%dK", max>>10)
+	default:
+		return strconv.FormatInt(max, 10)
+	}
+}
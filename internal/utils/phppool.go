@@ -0,0 +1,321 @@
+// internal/utils/phppool.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Modos de gestión de procesos de un pool de PHP-FPM
+const (
+	PHPPoolOnDemand = "ondemand"
+	PHPPoolDynamic  = "dynamic"
+	PHPPoolStatic   = "static"
+)
+
+// Valores por defecto de los pools dedicados
+const (
+	DefaultPHPPoolMaxChildren = 5
+	DefaultPHPPoolMaxRequests = 500
+	// DefaultDisableFunctions bloquea la ejecución de comandos del sistema desde peticiones web.
+	// proc_open y popen se permiten porque los usan el transporte sendmail y Symfony Process.
+	DefaultDisableFunctions = "exec,passthru,shell_exec,system,pcntl_exec,show_source"
+)
+
+// PHPPoolSettings guarda los ajustes del pool dedicado de PHP-FPM de un sitio
+type PHPPoolSettings struct {
+	PM               string `yaml:"pm,omitempty"`
+	MaxChildren      int    `yaml:"max_children,omitempty"`
+	MaxRequests      int    `yaml:"max_requests,omitempty"`
+	DisableFunctions string `yaml:"disable_functions,omitempty"`
+	// INI son directivas de php.ini propias del sitio (upload_max_filesize, memory_limit, opcache.*)
+	INI map[string]string `yaml:"ini,omitempty"`
+}
+
+// Validate verifica los ajustes del pool
+func (s PHPPoolSettings) Validate() error {
+	switch s.PM {
+	case "", PHPPoolOnDemand, PHPPoolDynamic, PHPPoolStatic:
+	default:
+		return NewError(ErrorValidacion, fmt.Sprintf("modo de pool no válido: %s (ondemand, dynamic, static)", s.PM), nil)
+	}
+	if s.MaxChildren < 0 || s.MaxRequests < 0 {
+		return NewError(ErrorValidacion, "los límites del pool de PHP-FPM no pueden ser negativos", nil)
+	}
+	if strings.ContainsAny(s.DisableFunctions, " \t\n;\"'") {
+		return NewError(ErrorValidacion, "disable_functions debe ser una lista separada por comas sin espacios", nil)
+	}
+	for key, value := range s.INI {
+		if err := ValidatePHPIniDirective(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PHPFPMPool es el pool de PHP-FPM dedicado de un sitio: se ejecuta como el usuario del sitio,
+// con su propio socket y limitado a su directorio home
+type PHPFPMPool struct {
+	Domain  string
+	User    string
+	Version string
+	// BaseDir es el directorio del sitio creado por 'sm site' (en los subdominios, el suyo dentro
+	// del dominio principal) y AppsDir el de sus releases, dentro del home del usuario
+	BaseDir string
+	AppsDir string
+	PHPPoolSettings
+}
+
+// NewPHPFPMPool describe el pool de un sitio a partir del directorio del sitio. El pool no se
+// limita al home del usuario: los subdominios lo comparten con el dominio principal y podrían
+// leer las aplicaciones y los .env de los demás.
+func NewPHPFPMPool(domain, username, siteDir, version string, settings PHPPoolSettings) (PHPFPMPool, error) {
+	if siteDir == "" || !filepath.IsAbs(siteDir) {
+		return PHPFPMPool{}, NewError(ErrorValidacion, fmt.Sprintf("se desconoce el directorio de %s; no se puede crear su pool de PHP-FPM", domain), nil)
+	}
+	u, err := user.Lookup(username)
+	if err != nil || u.HomeDir == "" {
+		return PHPFPMPool{}, NewError(ErrorValidacion, fmt.Sprintf("no se encontró el home del usuario %s", username), err)
+	}
+	return PHPFPMPool{
+		Domain:          domain,
+		User:            username,
+		Version:         version,
+		BaseDir:         filepath.Clean(siteDir),
+		AppsDir:         filepath.Join(u.HomeDir, "apps", domain),
+		PHPPoolSettings: settings,
+	}, nil
+}
+
+// OpenBasedir devuelve los directorios a los que accede el código del sitio. Terminan en /
+// para que PHP no acepte otros directorios que comiencen igual.
+func (p PHPFPMPool) OpenBasedir() string {
+	dirs := []string{
+		filepath.Join(p.BaseDir, "public_html"),
+		filepath.Join(p.BaseDir, "logs"),
+		p.TmpDir(),
+		p.AppsDir,
+		"/usr/share/php",
+	}
+	for i, dir := range dirs {
+		dirs[i] = dir + "/"
+	}
+	return strings.Join(append(dirs, "/dev/urandom"), ":")
+}
+
+// ConfPath devuelve el archivo del pool dentro de la configuración de la versión de PHP
+func (p PHPFPMPool) ConfPath() string {
+	return filepath.Join("/etc/php", p.Version, "fpm", "pool.d", fmt.Sprintf("sm-%s.conf", p.Domain))
+}
+
+// Socket devuelve el socket del pool; incluye la versión para que DetectPHPVersion la reconozca
+func (p PHPFPMPool) Socket() string {
+	return fmt.Sprintf("/run/php/php%s-fpm-%s.sock", p.Version, p.Domain)
+}
+
+// TmpDir devuelve el directorio temporal privado del usuario (subidas y sesiones)
+func (p PHPFPMPool) TmpDir() string {
+	return filepath.Join(p.BaseDir, "tmp")
+}
+
+// ErrorLog devuelve el log de errores de PHP del sitio
+func (p PHPFPMPool) ErrorLog() string {
+	return filepath.Join(p.BaseDir, "logs", fmt.Sprintf("%s_php_error.log", p.Domain))
+}
+
+// phpPoolTemplate es la configuración del pool dedicado de un sitio
+var phpPoolTemplate = template.Must(template.New("pool").Parse(`; Generado por SiteManager para {{.Domain}}
+[{{.Domain}}]
+user = {{.User}}
+group = {{.User}}
+
+listen = {{.Socket}}
+listen.owner = www-data
+listen.group = www-data
+listen.mode = 0660
+
+pm = {{.PM}}
+pm.max_children = {{.MaxChildren}}
+{{- if eq .PM "dynamic"}}
+pm.start_servers = {{.StartServers}}
+pm.min_spare_servers = {{.MinSpare}}
+pm.max_spare_servers = {{.MaxSpare}}
+{{- end}}
+{{- if eq .PM "ondemand"}}
+pm.process_idle_timeout = 10s
+{{- end}}
+pm.max_requests = {{.MaxRequests}}
+
+chdir = /
+catch_workers_output = yes
+
+; Aislamiento: el código del sitio solo accede a sus directorios y a los de su aplicación
+php_admin_value[open_basedir] = {{.OpenBasedir}}
+php_admin_value[disable_functions] = {{.DisableFunctions}}
+php_admin_value[upload_tmp_dir] = {{.TmpDir}}
+php_admin_value[sys_temp_dir] = {{.TmpDir}}
+php_admin_value[session.save_path] = {{.TmpDir}}
+php_admin_value[error_log] = {{.ErrorLog}}
+php_admin_flag[log_errors] = on
+{{- if .INI}}
+
+; Directivas de php.ini del sitio ('sm site php-ini')
+{{- range .INI}}
+php_admin_{{.Kind}}[{{.Key}}] = {{.Value}}
+{{- end}}
+{{- end}}
+`))
+
+// phpIniLine es una directiva de php.ini escrita en el pool
+type phpIniLine struct {
+	Kind  string
+	Key   string
+	Value string
+}
+
+// render genera el contenido del pool con los valores por defecto aplicados
+func (p PHPFPMPool) render() ([]byte, error) {
+	pm := p.PM
+	if pm == "" {
+		pm = PHPPoolOnDemand
+	}
+	maxChildren := p.MaxChildren
+	if maxChildren == 0 {
+		maxChildren = DefaultPHPPoolMaxChildren
+	}
+	maxRequests := p.MaxRequests
+	if maxRequests == 0 {
+		maxRequests = DefaultPHPPoolMaxRequests
+	}
+	disable := p.DisableFunctions
+	if disable == "" {
+		disable = DefaultDisableFunctions
+	}
+	// Valores de pm = dynamic proporcionales a max_children
+	minSpare := (maxChildren + 3) / 4
+	maxSpare := (maxChildren + 1) / 2
+	if maxSpare < minSpare {
+		maxSpare = minSpare
+	}
+
+	// Directivas del sitio en orden estable para no reescribir el pool sin cambios
+	keys := make([]string, 0, len(p.INI))
+	for key := range p.INI {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ini := make([]phpIniLine, 0, len(keys))
+	for _, key := range keys {
+		kind := "value"
+		if isPHPIniFlag(p.INI[key]) {
+			kind = "flag"
+		}
+		ini = append(ini, phpIniLine{Kind: kind, Key: key, Value: p.INI[key]})
+	}
+
+	var buf bytes.Buffer
+	err := phpPoolTemplate.Execute(&buf, map[string]interface{}{
+		"Domain":           p.Domain,
+		"User":             p.User,
+		"Socket":           p.Socket(),
+		"PM":               pm,
+		"MaxChildren":      maxChildren,
+		"StartServers":     minSpare,
+		"MinSpare":         minSpare,
+		"MaxSpare":         maxSpare,
+		"MaxRequests":      maxRequests,
+		"BaseDir":          p.BaseDir,
+		"DisableFunctions": disable,
+		"TmpDir":           p.TmpDir(),
+		"ErrorLog":         p.ErrorLog(),
+		"INI":              ini,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error al generar el pool de PHP-FPM: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Install escribe el pool, valida la configuración de PHP-FPM y lo recarga. Si la validación
+// falla se restaura el pool anterior.
+func (p PHPFPMPool) Install() error {
+	content, err := p.render()
+	if err != nil {
+		return err
+	}
+
+	poolDir := filepath.Dir(p.ConfPath())
+	if _, err := os.Stat(poolDir); err != nil {
+		return NewError(ErrorValidacion, fmt.Sprintf("PHP-FPM %s no está instalado (no existe %s)", p.Version, poolDir), err)
+	}
+
+	// Directorio temporal privado y log de errores del usuario
+	if err := os.MkdirAll(p.TmpDir(), 0700); err != nil {
+		return fmt.Errorf("error al crear el directorio temporal del sitio: %v", err)
+	}
+	exec.Command("chown", fmt.Sprintf("%s:%s", p.User, p.User), p.TmpDir()).Run()
+	if err := os.MkdirAll(filepath.Dir(p.ErrorLog()), 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	}
+	if file, err := os.OpenFile(p.ErrorLog(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		file.Close()
+		exec.Command("chown", fmt.Sprintf("%s:%s", p.User, p.User), p.ErrorLog()).Run()
+	}
+
+	previous, readErr := os.ReadFile(p.ConfPath())
+	if readErr == nil && bytes.Equal(previous, content) {
+		return nil
+	}
+	if err := os.WriteFile(p.ConfPath(), content, 0644); err != nil {
+		return fmt.Errorf("error al escribir el pool de PHP-FPM: %v", err)
+	}
+
+	if err := p.test(); err != nil {
+		if readErr == nil {
+			os.WriteFile(p.ConfPath(), previous, 0644)
+		} else {
+			os.Remove(p.ConfPath())
+		}
+		return err
+	}
+
+	fmt.Printf("Pool de PHP-FPM %s creado en %s\n", p.Version, p.ConfPath())
+	return p.reload()
+}
+
+// Remove elimina el pool y recarga PHP-FPM
+func (p PHPFPMPool) Remove() error {
+	if _, err := os.Stat(p.ConfPath()); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Remove(p.ConfPath()); err != nil {
+		return fmt.Errorf("error al eliminar el pool de PHP-FPM: %v", err)
+	}
+	fmt.Printf("Pool de PHP-FPM %s eliminado\n", p.Version)
+	return p.reload()
+}
+
+// test valida la configuración completa de PHP-FPM de la versión del pool
+func (p PHPFPMPool) test() error {
+	binary := fmt.Sprintf("php-fpm%s", p.Version)
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil
+	}
+	if output, err := exec.Command(binary, "-t").CombinedOutput(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("la configuración de PHP-FPM %s no es válida", p.Version),
+			fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(output))))
+	}
+	return nil
+}
+
+// reload recarga el servicio PHP-FPM de la versión del pool
+func (p PHPFPMPool) reload() error {
+	return (&PHPFPMManager{Version: p.Version}).Reload(AppProcess{})
+}
@@ -0,0 +1,325 @@
+// internal/utils/pm2.go
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PM2Manager ejecuta las aplicaciones con PM2 como el usuario del sitio
+type PM2Manager struct{}
+
+// Name devuelve el nombre del gestor
+func (m *PM2Manager) Name() string {
+	return ProcessManagerPM2
+}
+
+// ConfigPath devuelve la ruta del archivo de configuración de PM2 de la aplicación
+func (m *PM2Manager) ConfigPath(app AppProcess) string {
+	return filepath.Join(app.HomeDir, fmt.Sprintf("pm2.%s.config.json", app.Name))
+}
+
+// pm2Config es el archivo de configuración (ecosystem) de PM2 de una aplicación
+type pm2Config struct {
+	Apps []pm2App `json:"apps"`
+}
+
+// pm2App describe una aplicación en el archivo de configuración de PM2
+type pm2App struct {
+	Name             string            `json:"name"`
+	Script           string            `json:"script"`
+	Args             []string          `json:"args,omitempty"`
+	NodeArgs         []string          `json:"node_args,omitempty"`
+	Interpreter      string            `json:"interpreter,omitempty"`
+	Cwd              string            `json:"cwd"`
+	Env              map[string]string `json:"env"`
+	ErrorFile        string            `json:"error_file"`
+	OutFile          string            `json:"out_file"`
+	MergeLogs        bool              `json:"merge_logs"`
+	MaxMemoryRestart string            `json:"max_memory_restart"`
+	RestartDelay     int               `json:"restart_delay"`
+	Watch            bool              `json:"watch"`
+	ExecMode         string            `json:"exec_mode"`
+	Instances        int               `json:"instances"`
+	Autorestart      bool              `json:"autorestart"`
+}
+
+// Install escribe el archivo de configuración de PM2
+func (m *PM2Manager) Install(app AppProcess) error {
+	if err := PrepareAppLogs(app); err != nil {
+		return err
+	}
+
+	config, err := m.appConfig(app)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pm2Config{Apps: []pm2App{config}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error al generar configuración PM2: %v", err)
+	}
+
+	configPath := m.ConfigPath(app)
+	if err := os.WriteFile(configPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error al crear archivo de configuración PM2: %v", err)
+	}
+
+	// Cambiar propietario del archivo de configuración
+	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", app.User, app.User), configPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// ValidatePM2Cluster rechaza el modo cluster con una versión de Node.js administrada: PM2 crea
+// las instancias con el módulo cluster de su propio node e ignora el intérprete configurado.
+func ValidatePM2Cluster(tuning ProcessTuning, nodeVersion string) error {
+	if tuning.Cluster() && nodeVersion != "" {
+		return NewError(ErrorValidacion, fmt.Sprintf("el modo cluster de PM2 no puede usar Node.js v%s: las instancias se ejecutarían con el node de PM2; use el modo fork o el gestor systemd", nodeVersion), nil)
+	}
+	return nil
+}
+
+// appConfig traduce la aplicación y sus ajustes a la configuración de PM2
+func (m *PM2Manager) appConfig(app AppProcess) (pm2App, error) {
+	if err := ValidatePM2Cluster(app.ProcessTuning, app.NodeVersion); err != nil {
+		return pm2App{}, err
+	}
+	config := pm2App{
+		Name:   app.Name,
+		Script: app.Command,
+		Cwd:    app.WorkDir,
+		Env: map[string]string{
+			"NODE_ENV": "production",
+			"PORT":     strconv.Itoa(app.Port),
+		},
+		ErrorFile:        app.ErrorLog(),
+		OutFile:          app.OutputLog(),
+		MergeLogs:        true,
+		MaxMemoryRestart: app.EffectiveMaxMemory(),
+		RestartDelay:     app.EffectiveRestartDelay(),
+		ExecMode:         ExecModeFork,
+		Instances:        1,
+		Autorestart:      true,
+	}
+	for key, value := range app.Env {
+		config.Env[key] = value
+	}
+
+	// En modo cluster, 'npm start' se reemplaza por el script que ejecuta
+	if app.Cluster() {
+		app.Command = ResolveStartScript(app.WorkDir, app.Command)
+	}
+
+	// Con 'node <script>' PM2 ejecuta el script directamente, lo que permite el modo cluster
+	if nodeArgs, script, args, ok := app.NodeEntry(); ok {
+		config.Script = script
+		config.Args = args
+		config.NodeArgs = append(append([]string{}, nodeArgs...), app.NodeArgs...)
+		if app.NodeVersion != "" {
+			config.Interpreter = filepath.Join(NodeBinDir(app.NodeVersion), "node")
+		}
+	} else if len(app.NodeArgs) > 0 {
+		config.Env["NODE_OPTIONS"] = strings.Join(app.NodeArgs, " ")
+	}
+	// Los comandos como 'npm run start' o 'next start' encuentran la versión del sitio en el PATH
+	if app.NodeVersion != "" {
+		config.Env["PATH"] = app.Path()
+	}
+
+	if app.Cluster() {
+		if config.Script == app.Command {
+			fmt.Printf("Advertencia: el modo cluster requiere un comando 'node <script>'; '%s' se ejecutará en modo fork\n", app.Command)
+		} else {
+			config.ExecMode = ExecModeCluster
+			config.Instances = app.EffectiveInstances()
+		}
+	}
+	return config, nil
+}
+
+// Start vuelve a registrar la aplicación en PM2 a partir de su archivo de configuración
+func (m *PM2Manager) Start(app AppProcess) error {
+	// Detener la aplicación si ya está en ejecución (tanto en root como en el usuario)
+	exec.Command("pm2", "delete", app.Name).Run()                         // Ignorar errores aquí
+	exec.Command("sudo", "-u", app.User, "pm2", "delete", app.Name).Run() // Ignorar errores aquí
+
+	// Registrar el servicio pm2-<usuario> que restaura sus procesos al arrancar el servidor
+	m.enableStartup(app)
+
+	// Iniciar la aplicación como el usuario
+	output, err := exec.Command("sudo", "-u", app.User, "pm2", "start", m.ConfigPath(app)).CombinedOutput()
+	if len(output) > 0 {
+		fmt.Printf("Salida de PM2: %s\n", output)
+	}
+	if err != nil {
+		return NewError(ErrorComando, "error al iniciar la aplicación con PM2", fmt.Errorf("%v\n%s", err, output))
+	}
+	m.save(app)
+	return nil
+}
+
+// Stop detiene la aplicación
+func (m *PM2Manager) Stop(app AppProcess) error {
+	return m.run(app, "stop", app.Name)
+}
+
+// Restart reinicia la aplicación
+func (m *PM2Manager) Restart(app AppProcess) error {
+	return m.run(app, "restart", app.Name)
+}
+
+// Reload reinicia las instancias de la aplicación una a una (sin cortar el servicio en modo cluster)
+// aplicando la configuración y el entorno actuales
+func (m *PM2Manager) Reload(app AppProcess) error {
+	args := []string{"reload", app.Name}
+	if _, err := os.Stat(m.ConfigPath(app)); err == nil {
+		args = []string{"reload", m.ConfigPath(app), "--update-env"}
+	}
+	if err := m.run(app, args...); err != nil {
+		return err
+	}
+	m.save(app)
+	return nil
+}
+
+// Scale cambia la cantidad de instancias de la aplicación
+func (m *PM2Manager) Scale(app AppProcess, instances int) error {
+	processes, err := m.list(app)
+	if err != nil {
+		return err
+	}
+	if len(processes) == 0 {
+		return NewError(ErrorValidacion, fmt.Sprintf("la aplicación %s no está registrada en PM2", app.Name), nil)
+	}
+	// En modo fork todas las instancias intentarían escuchar en el mismo puerto
+	if processes[0].Env.ExecMode != "cluster_mode" {
+		return NewError(ErrorValidacion, fmt.Sprintf("la aplicación %s se ejecuta en modo fork; el escalado requiere modo cluster ('sm deploy reset-pm2 -d %s --cluster')", app.Name, app.Name), nil)
+	}
+	if err := m.run(app, "scale", app.Name, strconv.Itoa(instances)); err != nil {
+		return err
+	}
+	m.save(app)
+	return nil
+}
+
+// Info obtiene el estado de la aplicación a partir de 'pm2 jlist', sumando todas sus instancias
+func (m *PM2Manager) Info(app AppProcess) (*ProcessInfo, error) {
+	processes, err := m.list(app)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ProcessInfo{Status: "no registrado"}
+	for _, process := range processes {
+		info.Instances++
+		info.Status = process.Env.Status
+		if process.PID > 0 {
+			info.PIDs = append(info.PIDs, process.PID)
+		}
+		info.CPU += process.Monit.CPU
+		info.Memory += process.Monit.Memory
+		info.Restarts += process.Env.Restarts
+		if process.Env.Status == "online" && process.Env.Uptime > 0 {
+			uptime := time.Since(time.UnixMilli(process.Env.Uptime)).Truncate(time.Second)
+			if uptime > info.Uptime {
+				info.Uptime = uptime
+			}
+		}
+	}
+	return info, nil
+}
+
+// Remove elimina la aplicación de PM2 y su archivo de configuración
+func (m *PM2Manager) Remove(app AppProcess) error {
+	exec.Command("sudo", "-u", app.User, "pm2", "stop", app.Name).Run()
+	if output, err := exec.Command("sudo", "-u", app.User, "pm2", "delete", app.Name).CombinedOutput(); err != nil {
+		fmt.Printf("Advertencia: error al eliminar aplicación de PM2: %v\n%s\n", err, output)
+	}
+
+	// Guardar la lista de procesos para que la eliminación persista después de reiniciar
+	m.save(app)
+
+	if err := os.Remove(m.ConfigPath(app)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error al eliminar la configuración de PM2: %v", err)
+	}
+	return nil
+}
+
+// enableStartup registra como root el servicio de systemd que inicia el PM2 del usuario al
+// arrancar el servidor; ejecutado como el usuario, 'pm2 startup' solo muestra el comando
+func (m *PM2Manager) enableStartup(app AppProcess) {
+	output, err := exec.Command("pm2", "startup", "systemd", "-u", app.User, "--hp", app.HomeDir).CombinedOutput()
+	if err != nil {
+		fmt.Printf("Advertencia: no se pudo configurar el inicio de PM2 con el sistema: %v\n%s\n", err, output)
+	}
+}
+
+// save guarda la lista de procesos del usuario que PM2 restaura al arrancar el servidor
+func (m *PM2Manager) save(app AppProcess) {
+	output, err := exec.Command("sudo", "-u", app.User, "pm2", "save").CombinedOutput()
+	if err != nil {
+		fmt.Printf("Advertencia: no se pudo guardar la lista de procesos de PM2: %v\n%s\n", err, output)
+	}
+}
+
+// run ejecuta un comando de PM2 como el usuario del sitio mostrando su salida
+func (m *PM2Manager) run(app AppProcess, args ...string) error {
+	cmd := exec.Command("sudo", append([]string{"-u", app.User, "pm2"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("error al ejecutar 'pm2 %s'", args[0]), err)
+	}
+	return nil
+}
+
+// pm2Process es la parte de la salida de 'pm2 jlist' que utiliza SiteManager
+type pm2Process struct {
+	Name string `json:"name"`
+	PID  int    `json:"pid"`
+	Env  struct {
+		Status   string `json:"status"`
+		ExecMode string `json:"exec_mode"`
+		Uptime   int64  `json:"pm_uptime"`
+		Restarts int    `json:"restart_time"`
+	} `json:"pm2_env"`
+	Monit struct {
+		Memory uint64  `json:"memory"`
+		CPU    float64 `json:"cpu"`
+	} `json:"monit"`
+}
+
+// list devuelve las instancias de la aplicación registradas en el PM2 del usuario
+func (m *PM2Manager) list(app AppProcess) ([]pm2Process, error) {
+	output, err := exec.Command("sudo", "-u", app.User, "pm2", "jlist").Output()
+	if err != nil {
+		return nil, NewError(ErrorComando, "error al ejecutar 'pm2 jlist'", err)
+	}
+
+	// PM2 puede imprimir avisos antes del JSON
+	if start := bytes.IndexByte(output, '['); start > 0 {
+		output = output[start:]
+	}
+
+	var all []pm2Process
+	if err := json.Unmarshal(output, &all); err != nil {
+		return nil, fmt.Errorf("error al interpretar la salida de 'pm2 jlist': %v", err)
+	}
+
+	var processes []pm2Process
+	for _, process := range all {
+		if process.Name == app.Name {
+			processes = append(processes, process)
+		}
+	}
+	return processes, nil
+}
@@ -0,0 +1,250 @@
+// internal/utils/process.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Gestores de procesos soportados
+const (
+	ProcessManagerPM2     = "pm2"
+	ProcessManagerSystemd = "systemd"
+)
+
+// Valores por defecto del proceso de una aplicación
+const (
+	DefaultMaxMemory    = "200M"
+	DefaultRestartDelay = 3000 // milisegundos
+)
+
+// Modos de ejecución de PM2
+const (
+	ExecModeFork    = "fork"
+	ExecModeCluster = "cluster"
+)
+
+// ProcessTuning guarda los ajustes del proceso de una aplicación que se conservan entre despliegues
+type ProcessTuning struct {
+	ExecMode string `yaml:"exec_mode,omitempty"`
+	// Instances es la cantidad de instancias en modo cluster; 0 usa una por CPU
+	Instances    int      `yaml:"instances,omitempty"`
+	MaxMemory    string   `yaml:"max_memory,omitempty"`
+	RestartDelay int      `yaml:"restart_delay,omitempty"`
+	NodeArgs     []string `yaml:"node_args,omitempty"`
+}
+
+// Validate comprueba los ajustes del proceso
+func (t ProcessTuning) Validate() error {
+	if t.ExecMode != "" && t.ExecMode != ExecModeFork && t.ExecMode != ExecModeCluster {
+		return NewError(ErrorValidacion, fmt.Sprintf("modo de ejecución no válido: %s (fork, cluster)", t.ExecMode), nil)
+	}
+	if t.Instances < 0 {
+		return NewError(ErrorValidacion, "la cantidad de instancias no puede ser negativa", nil)
+	}
+	if t.RestartDelay < 0 {
+		return NewError(ErrorValidacion, "la espera entre reinicios no puede ser negativa", nil)
+	}
+	if t.MaxMemory != "" && !memoryLimitPattern.MatchString(t.MaxMemory) {
+		return NewError(ErrorValidacion, fmt.Sprintf("límite de memoria no válido: %s (por ejemplo 512M o 1G)", t.MaxMemory), nil)
+	}
+	return nil
+}
+
+// memoryLimitPattern acepta los límites de memoria comunes a PM2 y systemd
+var memoryLimitPattern = regexp.MustCompile(`^[0-9]+[KMG]$`)
+
+// Cluster indica si la aplicación se ejecuta en modo cluster
+func (t ProcessTuning) Cluster() bool {
+	return t.ExecMode == ExecModeCluster
+}
+
+// EffectiveInstances devuelve la cantidad de instancias a ejecutar
+func (t ProcessTuning) EffectiveInstances() int {
+	if !t.Cluster() {
+		return 1
+	}
+	if t.Instances > 0 {
+		return t.Instances
+	}
+	return runtime.NumCPU()
+}
+
+// EffectiveMaxMemory devuelve el límite de memoria por instancia
+func (t ProcessTuning) EffectiveMaxMemory() string {
+	if t.MaxMemory != "" {
+		return t.MaxMemory
+	}
+	return DefaultMaxMemory
+}
+
+// EffectiveRestartDelay devuelve la espera entre reinicios en milisegundos
+func (t ProcessTuning) EffectiveRestartDelay() int {
+	if t.RestartDelay > 0 {
+		return t.RestartDelay
+	}
+	return DefaultRestartDelay
+}
+
+// AppProcess describe el proceso de una aplicación Node.js
+type AppProcess struct {
+	// Name identifica el proceso; se usa el dominio del sitio
+	Name    string
+	User    string
+	HomeDir string
+	// WorkDir es la ruta estable de la aplicación (enlace a la release activa)
+	WorkDir string
+	Command string
+	Port    int
+	// NodeVersion es la versión de Node.js administrada; vacía usa el node del sistema
+	NodeVersion string
+	// Env contiene variables de entorno adicionales del proceso (por ejemplo HOSTNAME)
+	Env map[string]string
+	ProcessTuning
+}
+
+// ErrorLog devuelve la ruta del log de errores de la aplicación
+func (a AppProcess) ErrorLog() string {
+	return filepath.Join(a.HomeDir, "logs", fmt.Sprintf("%s_error.log", a.Name))
+}
+
+// OutputLog devuelve la ruta del log de salida de la aplicación
+func (a AppProcess) OutputLog() string {
+	return filepath.Join(a.HomeDir, "logs", fmt.Sprintf("%s_output.log", a.Name))
+}
+
+// EnvFile devuelve la ruta del archivo .env de la aplicación
+func (a AppProcess) EnvFile() string {
+	return filepath.Join(a.WorkDir, ".env")
+}
+
+// nodeValueOptions son las opciones de node que reciben su valor en el argumento siguiente
+var nodeValueOptions = map[string]bool{"-r": true, "--require": true, "--import": true, "--loader": true}
+
+// systemPath es el PATH base de los procesos de las aplicaciones
+const systemPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Path devuelve el PATH del proceso, con la versión de Node.js del sitio por delante
+func (a AppProcess) Path() string {
+	if a.NodeVersion == "" {
+		return systemPath
+	}
+	return NodeBinDir(a.NodeVersion) + ":" + systemPath
+}
+
+// NodeEntry separa un comando 'node [opciones] <script> [args]' en sus partes.
+// Devuelve ok=false si el comando no ejecuta un script con node directamente.
+func (a AppProcess) NodeEntry() (nodeArgs []string, script string, args []string, ok bool) {
+	fields := strings.Fields(a.Command)
+	if len(fields) < 2 || fields[0] != "node" {
+		return nil, "", nil, false
+	}
+
+	i := 1
+	for i < len(fields) && strings.HasPrefix(fields[i], "-") {
+		if nodeValueOptions[fields[i]] && i+1 < len(fields) {
+			i++
+		}
+		i++
+	}
+	if i >= len(fields) {
+		return nil, "", nil, false
+	}
+	return fields[1:i], fields[i], fields[i+1:], true
+}
+
+// ProcessManager administra el ciclo de vida del proceso de una aplicación
+type ProcessManager interface {
+	// Name devuelve el nombre del gestor (pm2, systemd)
+	Name() string
+	// Install escribe la configuración del proceso sin iniciarlo
+	Install(app AppProcess) error
+	// Start inicia (o vuelve a iniciar desde cero) el proceso con su configuración actual
+	Start(app AppProcess) error
+	Stop(app AppProcess) error
+	Restart(app AppProcess) error
+	// Reload reinicia el proceso de forma ordenada cuando el gestor lo permite
+	Reload(app AppProcess) error
+	// Scale cambia la cantidad de instancias del proceso
+	Scale(app AppProcess, instances int) error
+	// Info devuelve el estado y el consumo de recursos del proceso
+	Info(app AppProcess) (*ProcessInfo, error)
+	// Remove detiene el proceso y elimina su configuración
+	Remove(app AppProcess) error
+}
+
+// ProcessInfo resume el estado de un proceso
+type ProcessInfo struct {
+	Status    string
+	PIDs      []int
+	Instances int
+	// CPU es el porcentaje de uso actual (PM2); CPUTime el tiempo acumulado (systemd)
+	CPU      float64
+	CPUTime  time.Duration
+	Memory   uint64
+	Restarts int
+	Uptime   time.Duration
+}
+
+// NewProcessManager devuelve el gestor de procesos indicado
+func NewProcessManager(name string) (ProcessManager, error) {
+	switch name {
+	case "", ProcessManagerPM2:
+		return &PM2Manager{}, nil
+	case ProcessManagerSystemd:
+		return &SystemdManager{}, nil
+	default:
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("gestor de procesos no soportado: %s (pm2, systemd)", name), nil)
+	}
+}
+
+// PrepareAppLogs crea el directorio y los archivos de log de la aplicación con el propietario correcto
+func PrepareAppLogs(app AppProcess) error {
+	logsDir := filepath.Join(app.HomeDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	}
+
+	// Los archivos se crean vacíos solo si no existen, para conservar el historial
+	for _, path := range []string{app.ErrorLog(), app.OutputLog()} {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("error al crear archivo de log %s: %v", path, err)
+		}
+		file.Close()
+	}
+
+	cmd := exec.Command("chown", fmt.Sprintf("%s:%s", app.User, app.User), logsDir, app.ErrorLog(), app.OutputLog())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error al cambiar propietario de los logs: %v\n%s", err, output)
+	}
+	return nil
+}
+
+// TailLogs muestra las últimas líneas de uno o más archivos de log, opcionalmente en tiempo real
+func TailLogs(files []string, lines int, follow bool) error {
+	if len(files) == 0 {
+		return NewError(ErrorValidacion, "no se encontraron archivos de log", nil)
+	}
+
+	args := []string{"-n", strconv.Itoa(lines)}
+	if follow {
+		args = append(args, "-F")
+	}
+	args = append(args, files...)
+
+	cmd := exec.Command("tail", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return NewError(ErrorComando, "error al leer los logs de la aplicación", err)
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+// internal/utils/queue.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Gestores de los workers de colas de Laravel
+const (
+	QueueManagerSystemd    = "systemd"
+	QueueManagerSupervisor = "supervisor"
+)
+
+// Valores por defecto de 'php artisan queue:work'
+const (
+	DefaultQueueTries   = 3
+	DefaultQueueTimeout = 60
+	DefaultQueueSleep   = 3
+	// DefaultQueueMaxTime recicla los workers cada hora para liberar memoria
+	DefaultQueueMaxTime = 3600
+)
+
+// supervisorConfDir es el directorio de configuración de programas de supervisor
+const supervisorConfDir = "/etc/supervisor/conf.d"
+
+// queueWorkerNamePattern valida los nombres de los workers, que forman parte de las unidades
+var queueWorkerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// QueueWorker describe un grupo de workers de 'php artisan queue:work'
+type QueueWorker struct {
+	Name       string `yaml:"name,omitempty"`
+	Connection string `yaml:"connection,omitempty"`
+	Queue      string `yaml:"queue,omitempty"`
+	Processes  int    `yaml:"processes,omitempty"`
+	Tries      int    `yaml:"tries,omitempty"`
+	Timeout    int    `yaml:"timeout,omitempty"`
+	Sleep      int    `yaml:"sleep,omitempty"`
+	Memory     int    `yaml:"memory,omitempty"`
+}
+
+// QueueConfig agrupa los workers de un sitio y el gestor que los ejecuta
+type QueueConfig struct {
+	Manager string        `yaml:"manager,omitempty"`
+	Workers []QueueWorker `yaml:"workers,omitempty"`
+}
+
+// QueueSite contiene los datos del sitio necesarios para ejecutar sus workers
+type QueueSite struct {
+	Domain  string
+	User    string
+	HomeDir string
+	// AppDir es la ruta estable de la aplicación: los workers reiniciados usan la release activa
+	AppDir string
+	// PHP es el binario de PHP con el que se ejecuta artisan
+	PHP string
+}
+
+// LogFile devuelve el log de los workers del sitio
+func (s QueueSite) LogFile() string {
+	return filepath.Join(s.HomeDir, "logs", fmt.Sprintf("%s_queue.log", s.Domain))
+}
+
+// EffectiveName devuelve el nombre del worker o "default"
+func (w QueueWorker) EffectiveName() string {
+	if w.Name == "" {
+		return "default"
+	}
+	return w.Name
+}
+
+// EffectiveProcesses devuelve la cantidad de procesos del worker (al menos uno)
+func (w QueueWorker) EffectiveProcesses() int {
+	if w.Processes < 1 {
+		return 1
+	}
+	return w.Processes
+}
+
+// EffectiveTimeout devuelve el tiempo máximo de un trabajo en segundos
+func (w QueueWorker) EffectiveTimeout() int {
+	if w.Timeout > 0 {
+		return w.Timeout
+	}
+	return DefaultQueueTimeout
+}
+
+// Command devuelve el comando 'queue:work' del worker
+func (w QueueWorker) Command(php string) string {
+	args := []string{php, "artisan", "queue:work"}
+	if w.Connection != "" {
+		args = append(args, w.Connection)
+	}
+	if w.Queue != "" {
+		args = append(args, "--queue="+w.Queue)
+	}
+	tries, sleep := w.Tries, w.Sleep
+	if tries == 0 {
+		tries = DefaultQueueTries
+	}
+	if sleep == 0 {
+		sleep = DefaultQueueSleep
+	}
+	args = append(args,
+		fmt.Sprintf("--sleep=%d", sleep),
+		fmt.Sprintf("--tries=%d", tries),
+		fmt.Sprintf("--timeout=%d", w.EffectiveTimeout()),
+		fmt.Sprintf("--max-time=%d", DefaultQueueMaxTime))
+	if w.Memory > 0 {
+		args = append(args, fmt.Sprintf("--memory=%d", w.Memory))
+	}
+	return strings.Join(args, " ")
+}
+
+// String describe el worker en una línea
+func (w QueueWorker) String() string {
+	connection := w.Connection
+	if connection == "" {
+		connection = "por defecto"
+	}
+	queue := w.Queue
+	if queue == "" {
+		queue = "default"
+	}
+	return fmt.Sprintf("%s (conexión %s, colas %s) x%d", w.EffectiveName(), connection, queue, w.EffectiveProcesses())
+}
+
+// Validate verifica la configuración de los workers
+func (c QueueConfig) Validate() error {
+	switch c.Manager {
+	case "", QueueManagerSystemd, QueueManagerSupervisor:
+	default:
+		return fmt.Errorf("gestor de colas no soportado: %s (use systemd o supervisor)", c.Manager)
+	}
+
+	names := make(map[string]bool)
+	for i, w := range c.Workers {
+		name := w.EffectiveName()
+		if !queueWorkerNamePattern.MatchString(name) {
+			return fmt.Errorf("queue.workers[%d]: nombre inválido: %q", i, name)
+		}
+		if names[name] {
+			return fmt.Errorf("queue.workers[%d]: el nombre %q está repetido", i, name)
+		}
+		names[name] = true
+		if w.Processes < 0 || w.Tries < 0 || w.Timeout < 0 || w.Sleep < 0 || w.Memory < 0 {
+			return fmt.Errorf("queue.workers[%d]: los valores numéricos no pueden ser negativos", i)
+		}
+		if strings.ContainsAny(w.Connection+w.Queue, " \t\n'\"`$;&|") || HasControlChars(w.Connection+w.Queue) {
+			return fmt.Errorf("queue.workers[%d]: la conexión y las colas no pueden contener espacios ni caracteres especiales", i)
+		}
+	}
+	return nil
+}
+
+// EffectiveManager devuelve el gestor de los workers (systemd por defecto)
+func (c QueueConfig) EffectiveManager() string {
+	if c.Manager == "" {
+		return QueueManagerSystemd
+	}
+	return c.Manager
+}
+
+// QueueManager ejecuta los workers de colas de un sitio
+type QueueManager interface {
+	Name() string
+	// Apply deja en ejecución exactamente los workers indicados; sin workers elimina todos
+	Apply(site QueueSite, workers []QueueWorker) error
+}
+
+// NewQueueManager crea el gestor de colas indicado
+func NewQueueManager(name string) (QueueManager, error) {
+	switch name {
+	case "", QueueManagerSystemd:
+		return &SystemdQueueManager{}, nil
+	case QueueManagerSupervisor:
+		return &SupervisorQueueManager{}, nil
+	default:
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("gestor de colas no soportado: %s (use systemd o supervisor)", name), nil)
+	}
+}
+
+// PrepareQueueLog crea el log de los workers con el usuario del sitio como propietario
+func PrepareQueueLog(site QueueSite) error {
+	logFile := site.LogFile()
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de logs: %v", err)
+	}
+	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error al crear el log de las colas: %v", err)
+	}
+	file.Close()
+	exec.Command("chown", fmt.Sprintf("%s:%s", site.User, site.User), logFile).Run()
+	return nil
+}
+
+// systemdQueueUnitTemplate es la unidad plantilla de un worker; cada instancia (@1, @2...) es un proceso
+var systemdQueueUnitTemplate = template.Must(template.New("queue").Parse(`# Generado por SiteManager para {{.Domain}}
+[Unit]
+Description=SiteManager: worker {{.Name}} de {{.Domain}} (%i)
+After=network.target
+
+[Service]
+Type=simple
+User={{.User}}
+Group={{.User}}
+WorkingDirectory={{.AppDir}}
+ExecStart=/bin/sh -c "exec {{.Command}}"
+Restart=always
+RestartSec=3
+KillSignal=SIGTERM
+TimeoutStopSec={{.StopTimeout}}
+StandardOutput=append:{{.LogFile}}
+StandardError=append:{{.LogFile}}
+
+# Endurecimiento
+NoNewPrivileges=true
+PrivateTmp=true
+ProtectSystem=full
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// SystemdQueueManager ejecuta cada worker como una unidad plantilla de systemd
+type SystemdQueueManager struct{}
+
+// Name devuelve el nombre del gestor
+func (m *SystemdQueueManager) Name() string {
+	return QueueManagerSystemd
+}
+
+// unitPrefix devuelve el prefijo de las unidades de los workers del sitio
+func (m *SystemdQueueManager) unitPrefix(domain string) string {
+	return fmt.Sprintf("sm-%s-queue-", domain)
+}
+
+// Apply instala las unidades de los workers, inicia las instancias necesarias y elimina las sobrantes
+func (m *SystemdQueueManager) Apply(site QueueSite, workers []QueueWorker) error {
+	systemd := &SystemdManager{}
+	prefix := m.unitPrefix(site.Domain)
+
+	wanted := make(map[string]QueueWorker)
+	for _, w := range workers {
+		wanted[prefix+w.EffectiveName()+"@.service"] = w
+	}
+
+	// Eliminar los workers que ya no están configurados
+	existing, _ := filepath.Glob(filepath.Join(systemdUnitDir, prefix+"*@.service"))
+	reload := false
+	for _, path := range existing {
+		unit := filepath.Base(path)
+		if _, ok := wanted[unit]; ok {
+			continue
+		}
+		fmt.Printf("Eliminando worker %s...\n", strings.TrimSuffix(strings.TrimPrefix(unit, prefix), "@.service"))
+		for _, instance := range m.instances(unit) {
+			exec.Command("systemctl", "disable", "--now", instance).Run()
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error al eliminar la unidad %s: %v", unit, err)
+		}
+		reload = true
+	}
+
+	if len(workers) > 0 {
+		if err := PrepareQueueLog(site); err != nil {
+			return err
+		}
+	}
+
+	changed := make(map[string]bool)
+	for unit, w := range wanted {
+		command, err := systemdEscape(w.Command(site.PHP))
+		if err != nil {
+			return err
+		}
+		data := map[string]interface{}{
+			"Domain":      site.Domain,
+			"Name":        w.EffectiveName(),
+			"User":        site.User,
+			"AppDir":      site.AppDir,
+			"Command":     command,
+			"StopTimeout": w.EffectiveTimeout() + 30,
+			"LogFile":     site.LogFile(),
+		}
+		var buf bytes.Buffer
+		if err := systemdQueueUnitTemplate.Execute(&buf, data); err != nil {
+			return fmt.Errorf("error al generar la unidad del worker: %v", err)
+		}
+		path := filepath.Join(systemdUnitDir, unit)
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, buf.Bytes()) {
+			continue
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error al escribir la unidad del worker: %v", err)
+		}
+		changed[unit] = true
+		reload = true
+	}
+
+	if reload {
+		if err := systemd.systemctl("daemon-reload"); err != nil {
+			return err
+		}
+	}
+
+	for unit, w := range wanted {
+		base := strings.TrimSuffix(unit, "@.service")
+		processes := w.EffectiveProcesses()
+
+		// Detener las instancias que exceden la cantidad de procesos
+		for _, instance := range m.instances(unit) {
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(instance, base+"@"), ".service"))
+			if err != nil || n > processes {
+				exec.Command("systemctl", "disable", "--now", instance).Run()
+			}
+		}
+
+		for i := 1; i <= processes; i++ {
+			instance := fmt.Sprintf("%s@%d.service", base, i)
+			if err := systemd.systemctl("enable", instance); err != nil {
+				return err
+			}
+			// Las instancias con una unidad modificada se reinician para aplicar los cambios
+			action := "start"
+			if changed[unit] {
+				action = "restart"
+			}
+			if err := systemd.systemctl(action, instance); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Worker %s: %d proceso(s) con systemd\n", w.EffectiveName(), processes)
+	}
+	return nil
+}
+
+// instances devuelve las instancias cargadas de una unidad plantilla
+func (m *SystemdQueueManager) instances(unit string) []string {
+	pattern := strings.TrimSuffix(unit, ".service") + "*"
+	output, err := exec.Command("systemctl", "list-units", "--all", "--plain", "--no-legend", pattern).Output()
+	if err != nil {
+		return nil
+	}
+	var instances []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			instances = append(instances, fields[0])
+		}
+	}
+	return instances
+}
+
+// supervisorQueueTemplate define un programa de supervisor por worker con numprocs procesos
+var supervisorQueueTemplate = template.Must(template.New("supervisor").Parse(`; Generado por SiteManager para {{.Domain}}
+{{- range .Workers}}
+
+[program:{{.Program}}]
+process_name=%(program_name)s_%(process_num)02d
+command={{.Command}}
+directory={{$.AppDir}}
+user={{$.User}}
+numprocs={{.Processes}}
+autostart=true
+autorestart=true
+stopasgroup=true
+killasgroup=true
+stopwaitsecs={{.StopTimeout}}
+redirect_stderr=true
+stdout_logfile={{$.LogFile}}
+{{- end}}
+`))
+
+// SupervisorQueueManager ejecuta los workers como programas de supervisor
+type SupervisorQueueManager struct{}
+
+// Name devuelve el nombre del gestor
+func (m *SupervisorQueueManager) Name() string {
+	return QueueManagerSupervisor
+}
+
+// confPath devuelve el archivo de supervisor con los workers del sitio
+func (m *SupervisorQueueManager) confPath(domain string) string {
+	return filepath.Join(supervisorConfDir, fmt.Sprintf("sm-%s-queue.conf", domain))
+}
+
+// Apply escribe la configuración de supervisor del sitio y aplica los cambios. supervisorctl
+// update solo reinicia los programas cuya configuración cambió.
+func (m *SupervisorQueueManager) Apply(site QueueSite, workers []QueueWorker) error {
+	path := m.confPath(site.Domain)
+
+	if len(workers) == 0 {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		fmt.Println("Eliminando los workers de supervisor...")
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error al eliminar %s: %v", path, err)
+		}
+		return m.update()
+	}
+
+	if _, err := exec.LookPath("supervisorctl"); err != nil {
+		return NewError(ErrorValidacion, "supervisor no está instalado (apt install supervisor)", nil)
+	}
+	if err := PrepareQueueLog(site); err != nil {
+		return err
+	}
+
+	type program struct {
+		Program     string
+		Command     string
+		Processes   int
+		StopTimeout int
+	}
+	var programs []program
+	for _, w := range workers {
+		programs = append(programs, program{
+			Program:     fmt.Sprintf("sm-%s-queue-%s", site.Domain, w.EffectiveName()),
+			Command:     w.Command(site.PHP),
+			Processes:   w.EffectiveProcesses(),
+			StopTimeout: w.EffectiveTimeout() + 30,
+		})
+	}
+
+	var buf bytes.Buffer
+	err := supervisorQueueTemplate.Execute(&buf, map[string]interface{}{
+		"Domain":  site.Domain,
+		"AppDir":  site.AppDir,
+		"User":    site.User,
+		"LogFile": site.LogFile(),
+		"Workers": programs,
+	})
+	if err != nil {
+		return fmt.Errorf("error al generar la configuración de supervisor: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error al escribir %s: %v", path, err)
+	}
+	if err := m.update(); err != nil {
+		return err
+	}
+
+	for _, w := range workers {
+		fmt.Printf("Worker %s: %d proceso(s) con supervisor\n", w.EffectiveName(), w.EffectiveProcesses())
+	}
+	return nil
+}
+
+// update relee la configuración de supervisor y aplica los cambios
+func (m *SupervisorQueueManager) update() error {
+	for _, args := range [][]string{{"reread"}, {"update"}} {
+		if output, err := exec.Command("supervisorctl", args...).CombinedOutput(); err != nil {
+			return NewError(ErrorComando, fmt.Sprintf("error al ejecutar 'supervisorctl %s'", args[0]), fmt.Errorf("%v\n%s", err, output))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,463 @@
+// internal/utils/secrets.go
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretsKeyDir es el directorio de la clave maestra; el archivo de la clave solo lo lee root
+const SecretsKeyDir = "/etc/sitemanager"
+
+// secretsKeyFile es la clave maestra con la que se cifran las claves de los sitios
+const secretsKeyFile = "secrets.key"
+
+// secretsFile es el archivo cifrado con los secretos de un sitio
+const secretsFile = "secrets.enc"
+
+// secretsVersion es la versión del formato del archivo de secretos
+const secretsVersion = 1
+
+// secretCharset son los caracteres de los secretos generados: seguros en URLs y en archivos .env
+const secretCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// secretsEnvelope es el contenido del archivo de secretos. Cada sitio tiene su propia clave de
+// datos, cifrada con la clave maestra; los secretos se cifran con la clave de datos. Ambos
+// cifrados usan AES-256-GCM y el dominio como dato asociado, por lo que el archivo de un sitio
+// no puede copiarse a otro.
+type secretsEnvelope struct {
+	Version   int       `yaml:"version"`
+	KeyID     string    `yaml:"key_id"`
+	DataKey   string    `yaml:"data_key"`
+	Payload   string    `yaml:"payload"`
+	UpdatedAt time.Time `yaml:"updated_at"`
+}
+
+// SecretStore son los secretos descifrados de un sitio
+type SecretStore struct {
+	Domain    string
+	UpdatedAt time.Time
+
+	values  map[string]string
+	dataKey []byte
+}
+
+// secretsKeyPath devuelve la ruta de la clave maestra
+func secretsKeyPath() string {
+	return filepath.Join(SecretsKeyDir, secretsKeyFile)
+}
+
+// secretsPath devuelve el archivo de secretos de un sitio
+func secretsPath(domain string) string {
+	return filepath.Join(SiteStateDir(domain), secretsFile)
+}
+
+// keyID identifica una clave maestra sin revelarla
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readMasterKey lee una clave maestra. Devuelve el error de os.ReadFile si no existe.
+func readMasterKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("la clave maestra %s está dañada", path)
+	}
+	return key, nil
+}
+
+// writeMasterKey guarda una clave maestra con permisos de solo lectura para root
+func writeMasterKey(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error al crear %s: %v", filepath.Dir(path), err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("error al guardar la clave maestra: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error al guardar la clave maestra: %v", err)
+	}
+	return nil
+}
+
+// masterKeys devuelve las claves maestras disponibles por identificador. Además de la clave
+// actual incluye la que deja una rotación interrumpida, para poder abrir los sitios que ya
+// se volvieron a cifrar con ella.
+func masterKeys() (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, path := range []string{secretsKeyPath(), secretsKeyPath() + ".new"} {
+		key, err := readMasterKey(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys[keyID(key)] = key
+	}
+	return keys, nil
+}
+
+// currentMasterKey devuelve la clave maestra actual y la crea en el primer uso
+func currentMasterKey() ([]byte, error) {
+	key, err := readMasterKey(secretsKeyPath())
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, _, err = createMasterKey(secretsKeyPath())
+	return key, err
+}
+
+// createMasterKey genera una clave nueva y la guarda en path sin reemplazar una existente: si
+// otro proceso la creó antes, devuelve la suya. created indica si la clave es nueva.
+func createMasterKey(path string) (key []byte, created bool, err error) {
+	if key, err = randomKey(); err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, false, fmt.Errorf("error al crear %s: %v", filepath.Dir(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, false, fmt.Errorf("error al guardar la clave: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		tmp.Close()
+		return nil, false, fmt.Errorf("error al guardar la clave: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, false, fmt.Errorf("error al guardar la clave: %v", err)
+	}
+
+	// A diferencia de Rename, Link falla si la clave ya existe y nunca deja un archivo a medias
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			key, err = readMasterKey(path)
+			return key, false, err
+		}
+		return nil, false, fmt.Errorf("error al guardar la clave: %v", err)
+	}
+	return key, true, nil
+}
+
+// randomKey genera una clave AES-256
+func randomKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error al generar una clave: %v", err)
+	}
+	return key, nil
+}
+
+// sealSecret cifra datos con AES-256-GCM y devuelve el nonce seguido del texto cifrado en base64
+func sealSecret(key, plaintext []byte, aad string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error al generar el nonce: %v", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(aad))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret descifra datos cifrados con sealSecret
+func openSecret(key []byte, encoded, aad string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("datos cifrados incompletos")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(aad))
+}
+
+// dataKeyAAD y payloadAAD vinculan cada parte del archivo al dominio del sitio
+func dataKeyAAD(domain string) string { return "sitemanager data key " + domain }
+func payloadAAD(domain string) string { return "sitemanager secrets " + domain }
+
+// LoadSecretStore descifra los secretos de un sitio. Si el sitio no tiene secretos devuelve
+// un almacén vacío.
+func LoadSecretStore(domain string) (*SecretStore, error) {
+	store := &SecretStore{Domain: domain, values: make(map[string]string)}
+	data, err := os.ReadFile(secretsPath(domain))
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer los secretos de %s: %v", domain, err)
+	}
+
+	var envelope secretsEnvelope
+	if err := yaml.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("el archivo de secretos de %s está dañado: %v", domain, err)
+	}
+	if envelope.Version != secretsVersion {
+		return nil, fmt.Errorf("versión no soportada del archivo de secretos de %s: %d", domain, envelope.Version)
+	}
+
+	keys, err := masterKeys()
+	if err != nil {
+		return nil, err
+	}
+	master, ok := keys[envelope.KeyID]
+	if !ok {
+		return nil, NewError(ErrorValidacion,
+			fmt.Sprintf("los secretos de %s se cifraron con una clave maestra que no está en %s", domain, SecretsKeyDir), nil)
+	}
+	if store.dataKey, err = openSecret(master, envelope.DataKey, dataKeyAAD(domain)); err != nil {
+		return nil, fmt.Errorf("no se pudo descifrar la clave de %s: %v", domain, err)
+	}
+	plaintext, err := openSecret(store.dataKey, envelope.Payload, payloadAAD(domain))
+	if err != nil {
+		return nil, fmt.Errorf("no se pudieron descifrar los secretos de %s: %v", domain, err)
+	}
+	if err := yaml.Unmarshal(plaintext, &store.values); err != nil {
+		return nil, fmt.Errorf("los secretos de %s están dañados: %v", domain, err)
+	}
+	if store.values == nil {
+		store.values = make(map[string]string)
+	}
+	store.UpdatedAt = envelope.UpdatedAt
+	return store, nil
+}
+
+// Get devuelve el valor de un secreto
+func (s *SecretStore) Get(key string) (string, bool) {
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Set define un secreto
+func (s *SecretStore) Set(key, value string) {
+	s.values[key] = value
+}
+
+// Unset elimina un secreto. Devuelve false si no existía.
+func (s *SecretStore) Unset(key string) bool {
+	if _, ok := s.values[key]; !ok {
+		return false
+	}
+	delete(s.values, key)
+	return true
+}
+
+// Keys devuelve los nombres de los secretos ordenados
+func (s *SecretStore) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len devuelve el número de secretos
+func (s *SecretStore) Len() int {
+	return len(s.values)
+}
+
+// Save cifra y guarda los secretos del sitio. La clave maestra se crea en el primer uso.
+func (s *SecretStore) Save() error {
+	master, err := currentMasterKey()
+	if err != nil {
+		return err
+	}
+	return s.save(master)
+}
+
+// RotateKey vuelve a cifrar los secretos del sitio con una clave de datos nueva
+func (s *SecretStore) RotateKey() error {
+	key, err := randomKey()
+	if err != nil {
+		return err
+	}
+	s.dataKey = key
+	return s.Save()
+}
+
+// save cifra los secretos con la clave de datos del sitio y esta con la clave maestra indicada
+func (s *SecretStore) save(master []byte) error {
+	if s.dataKey == nil {
+		key, err := randomKey()
+		if err != nil {
+			return err
+		}
+		s.dataKey = key
+	}
+
+	plaintext, err := yaml.Marshal(s.values)
+	if err != nil {
+		return fmt.Errorf("error al codificar los secretos de %s: %v", s.Domain, err)
+	}
+	envelope := secretsEnvelope{Version: secretsVersion, KeyID: keyID(master), UpdatedAt: time.Now()}
+	if envelope.DataKey, err = sealSecret(master, s.dataKey, dataKeyAAD(s.Domain)); err != nil {
+		return fmt.Errorf("error al cifrar la clave de %s: %v", s.Domain, err)
+	}
+	if envelope.Payload, err = sealSecret(s.dataKey, plaintext, payloadAAD(s.Domain)); err != nil {
+		return fmt.Errorf("error al cifrar los secretos de %s: %v", s.Domain, err)
+	}
+	data, err := yaml.Marshal(&envelope)
+	if err != nil {
+		return fmt.Errorf("error al codificar los secretos de %s: %v", s.Domain, err)
+	}
+
+	if _, err := EnsureSiteStateDir(s.Domain); err != nil {
+		return err
+	}
+	path := secretsPath(s.Domain)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("error al guardar los secretos de %s: %v", s.Domain, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error al guardar los secretos de %s: %v", s.Domain, err)
+	}
+	s.UpdatedAt = envelope.UpdatedAt
+	return nil
+}
+
+// SecretStoreDomains devuelve los dominios que tienen secretos guardados
+func SecretStoreDomains() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(stateDir, "sites"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al listar los sitios: %v", err)
+	}
+	var domains []string
+	for _, entry := range entries {
+		if entry.IsDir() && PathExists(secretsPath(entry.Name())) {
+			domains = append(domains, entry.Name())
+		}
+	}
+	return domains, nil
+}
+
+// RotateSecretsMasterKey genera una clave maestra nueva y vuelve a cifrar con ella la clave
+// de datos de cada sitio. La clave nueva se guarda aparte hasta que todos los sitios se
+// actualizan, de modo que una rotación interrumpida puede repetirse sin perder secretos.
+// Los bloqueos de los sitios se toman antes de empezar y se mantienen hasta activar la clave
+// nueva, para que ningún comando guarde sus secretos con la clave anterior. Devuelve el
+// número de sitios actualizados.
+func RotateSecretsMasterKey(wait bool) (int, error) {
+	locks := make(map[string]*SiteLock)
+	defer func() {
+		for _, lock := range locks {
+			lock.Release()
+		}
+	}()
+	domains, err := lockSecretStores(locks, wait)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := secretsKeyPath() + ".new"
+	master, err := readMasterKey(pending)
+	if os.IsNotExist(err) {
+		if master, err = randomKey(); err != nil {
+			return 0, err
+		}
+		if err := writeMasterKey(pending, master); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Los sitios que guardan sus primeros secretos durante la rotación se cifran en otra vuelta
+	for len(domains) > 0 {
+		for _, domain := range domains {
+			store, err := LoadSecretStore(domain)
+			if err != nil {
+				return 0, err
+			}
+			if err := store.save(master); err != nil {
+				return 0, err
+			}
+		}
+		if domains, err = lockSecretStores(locks, wait); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(pending, secretsKeyPath()); err != nil {
+		return 0, fmt.Errorf("error al activar la clave maestra nueva: %v", err)
+	}
+	return len(locks), nil
+}
+
+// lockSecretStores bloquea los sitios con secretos que aún no están en locks y devuelve sus
+// dominios
+func lockSecretStores(locks map[string]*SiteLock, wait bool) ([]string, error) {
+	domains, err := SecretStoreDomains()
+	if err != nil {
+		return nil, err
+	}
+	var locked []string
+	for _, domain := range domains {
+		if locks[domain] != nil {
+			continue
+		}
+		lock, err := AcquireSiteLock(domain, "secret rotate --master", wait)
+		if err != nil {
+			return nil, err
+		}
+		locks[domain] = lock
+		locked = append(locked, domain)
+	}
+	return locked, nil
+}
+
+// GenerateSecret genera un valor aleatorio con letras y números
+func GenerateSecret(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(secretCharset)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("error al generar un valor aleatorio: %v", err)
+		}
+		b[i] = secretCharset[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,233 @@
+// internal/utils/sitedb.go
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// siteDatabasesFile es el archivo con las bases de datos vinculadas a un sitio
+const siteDatabasesFile = "databases.yaml"
+
+// PrimaryDatabaseEnvPrefix es el prefijo de las variables de la base de datos principal, que
+// además define DB_CONNECTION y DATABASE_URL
+const PrimaryDatabaseEnvPrefix = "DB"
+
+// dbNameInvalidChars reconoce los caracteres que no pueden formar parte de un nombre de base de datos
+var dbNameInvalidChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// SiteDatabase es una base de datos creada por SiteManager para un sitio. La contraseña de su
+// usuario se guarda en los secretos del sitio, nunca aquí.
+type SiteDatabase struct {
+	Engine DatabaseType `yaml:"engine"`
+	Name   string       `yaml:"name"`
+	User   string       `yaml:"user"`
+	Host   string       `yaml:"host"`
+	Port   int          `yaml:"port"`
+	// EnvPrefix es el prefijo de las variables del .env con sus credenciales (DB_HOST, DB_PORT...)
+	EnvPrefix string    `yaml:"env_prefix"`
+	CreatedAt time.Time `yaml:"created_at"`
+}
+
+// DatabaseNameForDomain deriva un nombre de base de datos válido a partir de un dominio:
+// minúsculas, con los puntos y guiones convertidos en guiones bajos
+func DatabaseNameForDomain(domain string) string {
+	return DatabaseIdentifier(domain)
+}
+
+// DatabaseIdentifier convierte un texto cualquiera en un identificador válido en PostgreSQL y
+// MySQL, que no necesita comillas
+func DatabaseIdentifier(text string) string {
+	name := strings.Trim(dbNameInvalidChars.ReplaceAllString(strings.ToLower(text), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "db_" + name
+	}
+	return truncateIdentifier(name, 63)
+}
+
+// DatabaseUserForName deriva el nombre del usuario de una base de datos. MySQL limita los
+// nombres de usuario a 32 caracteres.
+func DatabaseUserForName(name string) string {
+	return truncateIdentifier(name, 32)
+}
+
+// truncateIdentifier acorta un identificador a max caracteres. Los nombres recortados
+// terminan en un hash del nombre completo para que dos nombres largos con el mismo comienzo
+// no den el mismo identificador.
+func truncateIdentifier(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return strings.TrimRight(name[:max-len(suffix)], "_") + suffix
+}
+
+// Validate verifica el motor, los nombres y el prefijo de variables de la base de datos
+func (d SiteDatabase) Validate() error {
+	if _, err := NewDatabaseServer(d.Engine); err != nil {
+		return err
+	}
+	if err := ValidateDatabaseIdentifier("base de datos", d.Name, d.Engine); err != nil {
+		return err
+	}
+	if err := ValidateDatabaseIdentifier("usuario", d.User, d.Engine); err != nil {
+		return err
+	}
+	if err := ValidateEnvKey(d.EnvPrefix); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PasswordKey devuelve la variable que guarda la contraseña del usuario
+func (d SiteDatabase) PasswordKey() string {
+	return d.EnvPrefix + "_PASSWORD"
+}
+
+// EnvKeys devuelve las variables del .env que corresponden a la base de datos
+func (d SiteDatabase) EnvKeys() []string {
+	if d.EnvPrefix == PrimaryDatabaseEnvPrefix {
+		return []string{"DB_CONNECTION", "DB_HOST", "DB_PORT", "DB_DATABASE", "DB_USERNAME", "DB_PASSWORD", "DATABASE_URL"}
+	}
+	p := d.EnvPrefix + "_"
+	return []string{p + "HOST", p + "PORT", p + "DATABASE", p + "USERNAME", p + "PASSWORD", p + "URL"}
+}
+
+// EnvVars devuelve las variables del .env con las credenciales de la base de datos
+func (d SiteDatabase) EnvVars(password string) map[string]string {
+	url := BuildDatabaseURL(&DatabaseOptions{
+		Type: d.Engine, Host: d.Host, Port: d.Port, Name: d.Name, User: d.User, Password: password,
+	})
+	p := d.EnvPrefix + "_"
+	vars := map[string]string{
+		p + "HOST":     d.Host,
+		p + "PORT":     strconv.Itoa(d.Port),
+		p + "DATABASE": d.Name,
+		p + "USERNAME": d.User,
+		p + "PASSWORD": password,
+	}
+	if d.EnvPrefix == PrimaryDatabaseEnvPrefix {
+		vars["DB_CONNECTION"] = "pgsql"
+		if d.Engine == DBTypeMySQL {
+			vars["DB_CONNECTION"] = "mysql"
+		}
+		vars["DATABASE_URL"] = url
+	} else {
+		vars[p+"URL"] = url
+	}
+	return vars
+}
+
+// LoadSiteDatabases devuelve las bases de datos vinculadas a un sitio
+func LoadSiteDatabases(domain string) ([]SiteDatabase, error) {
+	data, err := os.ReadFile(filepath.Join(SiteStateDir(domain), siteDatabasesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer las bases de datos de %s: %v", domain, err)
+	}
+	var databases []SiteDatabase
+	if err := yaml.Unmarshal(data, &databases); err != nil {
+		return nil, fmt.Errorf("el archivo de bases de datos de %s está dañado: %v", domain, err)
+	}
+	return databases, nil
+}
+
+// SaveSiteDatabases guarda las bases de datos vinculadas a un sitio de forma atómica
+func SaveSiteDatabases(domain string, databases []SiteDatabase) error {
+	dir, err := EnsureSiteStateDir(domain)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, siteDatabasesFile)
+	if len(databases) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error al guardar las bases de datos de %s: %v", domain, err)
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(databases)
+	if err != nil {
+		return fmt.Errorf("error al codificar las bases de datos de %s: %v", domain, err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0640); err != nil {
+		return fmt.Errorf("error al guardar las bases de datos de %s: %v", domain, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// FindSiteDatabase busca una base de datos vinculada al sitio. Sin nombre devuelve la única
+// base de datos del sitio o la principal si tiene varias.
+func FindSiteDatabase(domain, name string) (*SiteDatabase, error) {
+	databases, err := LoadSiteDatabases(domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(databases) == 0 {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("el sitio %s no tiene bases de datos (cree una con 'sm db create -d %s')", domain, domain), nil)
+	}
+	for i := range databases {
+		if databases[i].Name == name || (name == "" && (len(databases) == 1 || databases[i].EnvPrefix == PrimaryDatabaseEnvPrefix)) {
+			return &databases[i], nil
+		}
+	}
+	if name == "" {
+		return nil, NewError(ErrorValidacion, fmt.Sprintf("el sitio %s tiene varias bases de datos; indique una con --name", domain), nil)
+	}
+	return nil, NewError(ErrorValidacion, fmt.Sprintf("la base de datos %s no está vinculada a %s", name, domain), nil)
+}
+
+// DatabaseLinkedElsewhere devuelve el sitio, distinto de domain, que tiene vinculada una base
+// de datos con el mismo nombre o el mismo usuario que db en el mismo motor. Devuelve una
+// cadena vacía si ningún otro sitio la usa.
+func DatabaseLinkedElsewhere(domain string, db SiteDatabase) (string, error) {
+	domains, err := SiteDatabaseDomains()
+	if err != nil {
+		return "", err
+	}
+	for _, other := range domains {
+		if other == domain {
+			continue
+		}
+		databases, err := LoadSiteDatabases(other)
+		if err != nil {
+			return "", err
+		}
+		for _, linked := range databases {
+			if linked.Engine == db.Engine && (linked.Name == db.Name || linked.User == db.User) {
+				return other, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// SiteDatabaseDomains devuelve los dominios que tienen bases de datos vinculadas
+func SiteDatabaseDomains() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(stateDir, "sites"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al listar los sitios: %v", err)
+	}
+	var domains []string
+	for _, entry := range entries {
+		if entry.IsDir() && PathExists(filepath.Join(SiteStateDir(entry.Name()), siteDatabasesFile)) {
+			domains = append(domains, entry.Name())
+		}
+	}
+	return domains, nil
+}
@@ -0,0 +1,116 @@
+// internal/utils/sitestate.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// siteStateFile es el nombre del archivo con el estado de un sitio
+const siteStateFile = "site.yaml"
+
+// SiteState guarda cómo está desplegada y cómo se ejecuta la aplicación de un sitio
+type SiteState struct {
+	Domain         string    `yaml:"domain"`
+	Type           string    `yaml:"type"`
+	User           string    `yaml:"user"`
+	HomeDir        string    `yaml:"home_dir"`
+	SiteDir        string    `yaml:"site_dir,omitempty"` // directorio creado por sm site
+	AppDir         string    `yaml:"app_dir"`
+	Port           int       `yaml:"port,omitempty"`
+	ProcessManager string    `yaml:"process_manager,omitempty"`
+	StartCommand   string    `yaml:"start_command,omitempty"`
+	PHPVersion     string    `yaml:"php_version,omitempty"`
+	NodeVersion    string    `yaml:"node_version,omitempty"`
+	UpdatedAt      time.Time `yaml:"updated_at"`
+
+	// Pool dedicado de PHP-FPM; nil si el sitio usa el pool compartido de su versión
+	PHPPool *PHPPoolSettings `yaml:"php_pool,omitempty"`
+
+	// Workers de colas y programador de tareas de Laravel
+	Queue     QueueConfig `yaml:"queue,omitempty"`
+	Scheduler bool        `yaml:"scheduler,omitempty"`
+	// Octane ejecuta la aplicación Laravel como proceso propio en lugar de PHP-FPM
+	Octane OctaneConfig `yaml:"octane,omitempty"`
+
+	// Variables de entorno adicionales del proceso de la aplicación
+	ProcessEnv map[string]string `yaml:"process_env,omitempty"`
+
+	// Ajustes del proceso de la aplicación (modo cluster, memoria, argumentos de node)
+	ProcessTuning `yaml:",inline"`
+}
+
+// LoadSiteState carga el estado de un sitio. Devuelve nil sin error si no existe.
+func LoadSiteState(domain string) (*SiteState, error) {
+	data, err := os.ReadFile(filepath.Join(SiteStateDir(domain), siteStateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el estado de %s: %v", domain, err)
+	}
+
+	var state SiteState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("el estado de %s está dañado: %v", domain, err)
+	}
+	return &state, nil
+}
+
+// SaveSiteState guarda el estado de un sitio de forma atómica
+func SaveSiteState(state *SiteState) error {
+	dir, err := EnsureSiteStateDir(state.Domain)
+	if err != nil {
+		return err
+	}
+
+	state.UpdatedAt = time.Now()
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error al codificar el estado de %s: %v", state.Domain, err)
+	}
+
+	path := filepath.Join(dir, siteStateFile)
+	if err := os.WriteFile(path+".tmp", data, 0640); err != nil {
+		return fmt.Errorf("error al guardar el estado de %s: %v", state.Domain, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// RunsProcess indica si el sitio ejecuta un proceso propio con PM2 o systemd
+func (s *SiteState) RunsProcess() bool {
+	return s.ProcessManager != "" && (s.Type == "nodejs" || (s.Type == "laravel" && s.Octane.Enabled()))
+}
+
+// PHPFPMPool devuelve el pool dedicado de PHP-FPM del sitio, si lo tiene. Sin el directorio
+// del sitio registrado no se puede describir el pool.
+func (s *SiteState) PHPFPMPool() (PHPFPMPool, bool) {
+	if s.PHPPool == nil || s.PHPVersion == "" {
+		return PHPFPMPool{}, false
+	}
+	pool, err := NewPHPFPMPool(s.Domain, s.User, s.SiteDir, s.PHPVersion, *s.PHPPool)
+	if err != nil {
+		return PHPFPMPool{}, false
+	}
+	return pool, true
+}
+
+// AppProcess devuelve la descripción del proceso de la aplicación según el estado guardado
+func (s *SiteState) AppProcess() AppProcess {
+	return AppProcess{
+		Name:    s.Domain,
+		User:    s.User,
+		HomeDir: s.HomeDir,
+		WorkDir: s.AppDir,
+		Command: s.StartCommand,
+		Port:    s.Port,
+
+		NodeVersion:   s.NodeVersion,
+		Env:           s.ProcessEnv,
+		ProcessTuning: s.ProcessTuning,
+	}
+}
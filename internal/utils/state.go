@@ -0,0 +1,36 @@
+// internal/utils/state.go
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultStateDir es el directorio base donde SiteManager guarda el estado de los sitios
+const DefaultStateDir = "/var/lib/sitemanager"
+
+// stateDir es el directorio base configurado (state_dir en config.yaml)
+var stateDir = DefaultStateDir
+
+// SetStateDir establece el directorio base del estado de los sitios
+func SetStateDir(dir string) {
+	if dir != "" {
+		stateDir = dir
+	}
+}
+
+// SiteStateDir devuelve el directorio de estado de un sitio
+func SiteStateDir(domain string) string {
+	return filepath.Join(stateDir, "sites", domain)
+}
+
+// EnsureSiteStateDir crea el directorio de estado de un sitio si no existe.
+// Solo root puede leerlo, ya que puede contener salidas con información sensible.
+func EnsureSiteStateDir(domain string) (string, error) {
+	dir := SiteStateDir(domain)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("error al crear el directorio de estado %s: %v", dir, err)
+	}
+	return dir, nil
+}
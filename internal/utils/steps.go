@@ -0,0 +1,65 @@
+// internal/utils/steps.go
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// UserCommand describe un comando que se ejecuta como el usuario de un sitio
+type UserCommand struct {
+	User    string
+	Dir     string
+	Command string
+	Env     []string
+	Timeout time.Duration
+	// Output recibe una copia de la salida además de la terminal
+	Output io.Writer
+}
+
+// RunUserCommand ejecuta un comando como el usuario indicado mostrando la salida
+// en tiempo real. El proceso y sus hijos se terminan si se excede el timeout.
+func RunUserCommand(uc UserCommand) error {
+	cmd := exec.Command("su", "-c", uc.Command, uc.User)
+	cmd.Dir = uc.Dir
+	cmd.Env = append(os.Environ(), uc.Env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var out io.Writer = os.Stdout
+	if uc.Output != nil {
+		out = io.MultiWriter(os.Stdout, uc.Output)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Start(); err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("no se pudo iniciar '%s'", uc.Command), err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	timeout := uc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStepTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return NewError(ErrorComando, fmt.Sprintf("'%s' falló", uc.Command), err)
+		}
+		return nil
+	case <-timer.C:
+		// Terminar todo el grupo de procesos (su y sus hijos)
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return NewError(ErrorComando, fmt.Sprintf("'%s' excedió el tiempo máximo de %s", uc.Command, timeout), nil)
+	}
+}
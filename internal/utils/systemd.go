@@ -0,0 +1,270 @@
+// internal/utils/systemd.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// systemdUnitDir es el directorio donde se instalan las unidades de las aplicaciones
+const systemdUnitDir = "/etc/systemd/system"
+
+// systemdUnitTemplate es la unidad endurecida que ejecuta una aplicación como el usuario del sitio
+var systemdUnitTemplate = template.Must(template.New("unit").Parse(`# Generado por SiteManager para {{.Name}}
+[Unit]
+Description=SiteManager: {{.Name}}
+After=network.target
+
+[Service]
+Type=simple
+User={{.User}}
+Group={{.User}}
+WorkingDirectory={{.WorkDir}}
+EnvironmentFile=-{{.EnvFile}}
+Environment=NODE_ENV=production
+Environment=PORT={{.Port}}
+Environment=PATH={{.Path}}
+{{- range .Env}}
+Environment="{{.}}"
+{{- end}}
+{{- if .NodeOptions}}
+Environment="NODE_OPTIONS={{.NodeOptions}}"
+{{- end}}
+ExecStart=/bin/sh -c "exec {{.ExecStart}}"
+Restart=on-failure
+RestartSec={{.RestartSec}}
+MemoryMax={{.MemoryMax}}
+StandardOutput=append:{{.OutputLog}}
+StandardError=append:{{.ErrorLog}}
+
+# Endurecimiento
+NoNewPrivileges=true
+PrivateTmp=true
+ProtectSystem=full
+ProtectKernelTunables=true
+ProtectKernelModules=true
+ProtectControlGroups=true
+RestrictSUIDSGID=true
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// systemdQuoter escapa un valor para usarlo dentro de una directiva Environment entre comillas
+var systemdQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`)
+
+// systemdQuote escapa un valor de una directiva Environment. Rechaza los caracteres de
+// control: un salto de línea terminaría la directiva y permitiría agregar otras a la unidad.
+func systemdQuote(field, value string) (string, error) {
+	if HasControlChars(value) {
+		return "", NewError(ErrorValidacion, fmt.Sprintf("%s contiene caracteres de control", field), nil)
+	}
+	return systemdQuoter.Replace(value), nil
+}
+
+// systemdEnv convierte las variables adicionales en asignaciones ordenadas para la unidad
+func systemdEnv(env map[string]string) ([]string, error) {
+	assignments := make([]string, 0, len(env))
+	for key, value := range env {
+		assignment, err := systemdQuote("la variable "+key, key+"="+value)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	sort.Strings(assignments)
+	return assignments, nil
+}
+
+// SystemdManager ejecuta las aplicaciones como servicios de systemd
+type SystemdManager struct{}
+
+// Name devuelve el nombre del gestor
+func (m *SystemdManager) Name() string {
+	return ProcessManagerSystemd
+}
+
+// UnitName devuelve el nombre de la unidad de systemd de la aplicación
+func (m *SystemdManager) UnitName(app AppProcess) string {
+	return fmt.Sprintf("sm-%s.service", app.Name)
+}
+
+// UnitPath devuelve la ruta del archivo de la unidad
+func (m *SystemdManager) UnitPath(app AppProcess) string {
+	return filepath.Join(systemdUnitDir, m.UnitName(app))
+}
+
+// Install escribe la unidad de systemd de la aplicación
+func (m *SystemdManager) Install(app AppProcess) error {
+	if err := PrepareAppLogs(app); err != nil {
+		return err
+	}
+	if app.Cluster() {
+		fmt.Println("Advertencia: el modo cluster solo está disponible con PM2; systemd ejecutará una instancia")
+	}
+
+	execStart, err := systemdEscape(app.Command)
+	if err != nil {
+		return err
+	}
+	env, err := systemdEnv(app.Env)
+	if err != nil {
+		return err
+	}
+	nodeOptions, err := systemdQuote("NODE_OPTIONS", strings.Join(app.NodeArgs, " "))
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"Name":        app.Name,
+		"User":        app.User,
+		"WorkDir":     app.WorkDir,
+		"EnvFile":     app.EnvFile(),
+		"Port":        app.Port,
+		"ExecStart":   execStart,
+		"Path":        app.Path(),
+		"MemoryMax":   app.EffectiveMaxMemory(),
+		"RestartSec":  fmt.Sprintf("%dms", app.EffectiveRestartDelay()),
+		"Env":         env,
+		"NodeOptions": nodeOptions,
+		"OutputLog":   app.OutputLog(),
+		"ErrorLog":    app.ErrorLog(),
+	}
+
+	var buf bytes.Buffer
+	if err := systemdUnitTemplate.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error al generar la unidad de systemd: %v", err)
+	}
+	if err := os.WriteFile(m.UnitPath(app), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error al escribir la unidad de systemd: %v", err)
+	}
+
+	return m.systemctl("daemon-reload")
+}
+
+// Start habilita e inicia (o reinicia) el servicio
+func (m *SystemdManager) Start(app AppProcess) error {
+	if err := m.systemctl("enable", m.UnitName(app)); err != nil {
+		return err
+	}
+	return m.systemctl("restart", m.UnitName(app))
+}
+
+// Stop detiene el servicio
+func (m *SystemdManager) Stop(app AppProcess) error {
+	return m.systemctl("stop", m.UnitName(app))
+}
+
+// Restart reinicia el servicio
+func (m *SystemdManager) Restart(app AppProcess) error {
+	return m.systemctl("restart", m.UnitName(app))
+}
+
+// Reload recarga el servicio si lo soporta o lo reinicia en caso contrario
+func (m *SystemdManager) Reload(app AppProcess) error {
+	return m.systemctl("reload-or-restart", m.UnitName(app))
+}
+
+// Scale no está disponible con systemd: cada aplicación es una única unidad
+func (m *SystemdManager) Scale(app AppProcess, instances int) error {
+	return NewError(ErrorValidacion, "el escalado de instancias solo está disponible con PM2", nil)
+}
+
+// Info obtiene el estado del servicio desde systemd
+func (m *SystemdManager) Info(app AppProcess) (*ProcessInfo, error) {
+	return systemdUnitInfo(m.UnitName(app))
+}
+
+// Remove detiene, deshabilita y elimina la unidad
+func (m *SystemdManager) Remove(app AppProcess) error {
+	if _, err := os.Stat(m.UnitPath(app)); os.IsNotExist(err) {
+		return nil
+	}
+
+	exec.Command("systemctl", "disable", "--now", m.UnitName(app)).Run()
+	if err := os.Remove(m.UnitPath(app)); err != nil {
+		return fmt.Errorf("error al eliminar la unidad de systemd: %v", err)
+	}
+	return m.systemctl("daemon-reload")
+}
+
+// systemctl ejecuta un comando de systemctl
+func (m *SystemdManager) systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return NewError(ErrorComando, fmt.Sprintf("error al ejecutar 'systemctl %s'", strings.Join(args, " ")), fmt.Errorf("%v\n%s", err, output))
+	}
+	return nil
+}
+
+// systemdEscape escapa un comando para incluirlo entre comillas dobles en ExecStart. Rechaza
+// los caracteres de control, que permitirían agregar directivas a la unidad.
+func systemdEscape(command string) (string, error) {
+	if HasControlChars(command) {
+		return "", NewError(ErrorValidacion, fmt.Sprintf("el comando %q contiene caracteres de control", command), nil)
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`, `$`, `$$`)
+	return replacer.Replace(command), nil
+}
+
+// HasControlChars indica si el texto contiene saltos de línea u otros caracteres de control
+// (se admite el tabulador)
+func HasControlChars(value string) bool {
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\t' {
+			return true
+		}
+	}
+	return false
+}
+
+// systemdUnitInfo obtiene el estado y el consumo de recursos de una unidad con 'systemctl show'
+func systemdUnitInfo(unit string) (*ProcessInfo, error) {
+	output, err := exec.Command("systemctl", "show", unit,
+		"--property=ActiveState,SubState,MainPID,MemoryCurrent,CPUUsageNSec,NRestarts,ActiveEnterTimestamp").Output()
+	if err != nil {
+		return nil, NewError(ErrorComando, fmt.Sprintf("error al consultar el estado de %s", unit), err)
+	}
+
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = strings.TrimSpace(value)
+		}
+	}
+
+	info := &ProcessInfo{Status: props["ActiveState"]}
+	if sub := props["SubState"]; sub != "" && sub != info.Status {
+		info.Status = fmt.Sprintf("%s (%s)", info.Status, sub)
+	}
+	if pid, err := strconv.Atoi(props["MainPID"]); err == nil && pid > 0 {
+		info.PIDs = []int{pid}
+		info.Instances = 1
+	}
+	// systemd informa [not set] o un valor máximo cuando no hay contabilidad de recursos
+	if memory, err := strconv.ParseUint(props["MemoryCurrent"], 10, 64); err == nil && memory < 1<<62 {
+		info.Memory = memory
+	}
+	if cpu, err := strconv.ParseUint(props["CPUUsageNSec"], 10, 64); err == nil && cpu < 1<<62 {
+		info.CPUTime = time.Duration(cpu)
+	}
+	if restarts, err := strconv.Atoi(props["NRestarts"]); err == nil {
+		info.Restarts = restarts
+	}
+	if props["ActiveState"] == "active" {
+		if since, err := time.Parse("Mon 2006-01-02 15:04:05 MST", props["ActiveEnterTimestamp"]); err == nil {
+			info.Uptime = time.Since(since).Truncate(time.Second)
+		}
+	}
+	return info, nil
+}
@@ -4,6 +4,7 @@ package utils
 import (
 	"fmt"
 	"os"
+	"runtime"
 )
 
 // PathExists verifica si una ruta existe
@@ -63,7 +64,7 @@ func GetSystemInfo() (*SystemInfo, error) {
 	}
 
 	return &SystemInfo{
-		CPU:       4, // Valor por defecto
+		CPU:       runtime.NumCPU(),
 		Memory:    memory,
 		Hostname:  hostname,
 		IPAddress: "127.0.0.1", // Valor por defecto